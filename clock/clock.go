@@ -0,0 +1,109 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clock
+
+import "time"
+
+// Clock the source of time, the limiters use it instead of the time
+// package, so that the tests can replace it with Fake and advance time
+// exactly.
+type Clock interface {
+	// Now return the current time.
+	Now() time.Time
+	// Since return the time elapsed since t.
+	Since(t time.Time) time.Duration
+	// NewTicker return the ticker sending the time every d.
+	NewTicker(d time.Duration) Ticker
+	// NewTimer return the timer sending the time after d.
+	NewTimer(d time.Duration) Timer
+	// After wait for d and then send the time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ticker the ticker of Clock, it is the same as time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+// Timer the timer of Clock, it is the same as time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+var _ Clock = realClock{}
+
+// realClock the Clock based on the time package.
+type realClock struct{}
+
+// Real return the Clock based on the time package, it is the default clock.
+func Real() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{t: time.NewTicker(d)}
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{t: time.NewTimer(d)}
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (r *realTicker) C() <-chan time.Time {
+	return r.t.C
+}
+
+func (r *realTicker) Stop() {
+	r.t.Stop()
+}
+
+func (r *realTicker) Reset(d time.Duration) {
+	r.t.Reset(d)
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (r *realTimer) C() <-chan time.Time {
+	return r.t.C
+}
+
+func (r *realTimer) Stop() bool {
+	return r.t.Stop()
+}
+
+func (r *realTimer) Reset(d time.Duration) bool {
+	return r.t.Reset(d)
+}
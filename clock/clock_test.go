@@ -0,0 +1,107 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFake_Timer(t *testing.T) {
+	c := NewFake(start)
+	timer := c.NewTimer(time.Second)
+	assert.Equal(t, 1, c.Waiters())
+
+	c.Advance(999 * time.Millisecond)
+	assert.Len(t, timer.C(), 0)
+
+	c.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-timer.C())
+	assert.Equal(t, 0, c.Waiters())
+	assert.False(t, timer.Stop())
+
+	// reset the fired timer.
+	assert.False(t, timer.Reset(time.Second))
+	assert.True(t, timer.Stop())
+	c.Advance(time.Hour)
+	assert.Len(t, timer.C(), 0)
+
+	// the expired timer fires at once.
+	assert.Equal(t, c.Now(), <-c.After(0))
+	assert.Equal(t, time.Hour+time.Second, c.Since(start))
+}
+
+func TestFake_Ticker(t *testing.T) {
+	c := NewFake(start)
+	ticker := c.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	c.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), <-ticker.C())
+
+	// the ticks are dropped while the receiver is slow.
+	c.Advance(3 * time.Second)
+	assert.Equal(t, start.Add(2*time.Second), <-ticker.C())
+	assert.Len(t, ticker.C(), 0)
+
+	ticker.Reset(time.Minute)
+	c.Advance(time.Second)
+	assert.Len(t, ticker.C(), 0)
+	c.Set(start.Add(4*time.Second + time.Minute))
+	assert.Equal(t, start.Add(4*time.Second+time.Minute), <-ticker.C())
+
+	// set to the past does nothing.
+	c.Set(start)
+	assert.Equal(t, start.Add(4*time.Second+time.Minute), c.Now())
+}
+
+func TestFake_Order(t *testing.T) {
+	c := NewFake(start)
+	late := c.NewTimer(2 * time.Second)
+	early := c.NewTimer(time.Second)
+
+	c.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Second), <-early.C())
+	assert.Equal(t, start.Add(2*time.Second), <-late.C())
+}
+
+func TestFake_BlockUntil(t *testing.T) {
+	c := NewFake(start)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-c.After(time.Second)
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	<-done
+}
+
+func TestReal(t *testing.T) {
+	c := Real()
+	now := c.Now()
+	timer := c.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.True(t, c.Since(now) >= time.Millisecond)
+
+	ticker := c.NewTicker(time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+}
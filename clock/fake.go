@@ -0,0 +1,239 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+var _ Clock = (*Fake)(nil)
+
+// Fake the manual Clock for tests, the time only moves by Advance or Set,
+// and the tickers and timers fire synchronously while moving.
+type Fake struct {
+	now time.Time
+	// the active tickers and timers.
+	waiters []*waiter
+	mu      *sync.Mutex
+	// broadcast when the waiters changed.
+	cond *sync.Cond
+}
+
+// NewFake return the Fake clock starting at now.
+func NewFake(now time.Time) *Fake {
+	mu := new(sync.Mutex)
+	return &Fake{
+		now:  now,
+		mu:   mu,
+		cond: sync.NewCond(mu),
+	}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	return &fakeTicker{w: f.add(d, d)}
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.add(d, 0)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// Advance move the time forward by d, the tickers and timers expired are
+// fired in order of deadline.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.moveTo(f.now.Add(d))
+}
+
+// Set move the time to t, it does nothing if t is before now.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if t.After(f.now) {
+		f.moveTo(t)
+	}
+}
+
+// BlockUntil block until there are n active tickers and timers at least,
+// it is used to make sure the goroutine under test is waiting on the
+// clock before advancing.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// Waiters return the count of active tickers and timers.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.waiters)
+}
+
+func (f *Fake) add(d, period time.Duration) *waiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &waiter{
+		f:      f,
+		period: period,
+		ch:     make(chan time.Time, 1),
+	}
+	f.schedule(w, d)
+
+	return w
+}
+
+// schedule activate the waiter firing after d, the expired one fires at once.
+func (f *Fake) schedule(w *waiter, d time.Duration) {
+	w.deadline = f.now.Add(d)
+	if d <= 0 && w.period == 0 {
+		w.fire(f.now)
+		return
+	}
+
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+}
+
+// remove deactivate the waiter, it returns false if the waiter is inactive.
+func (f *Fake) remove(w *waiter) bool {
+	for i, v := range f.waiters {
+		if v == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.cond.Broadcast()
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *Fake) moveTo(t time.Time) {
+	for {
+		// fire the earliest expired waiter until none.
+		var next *waiter
+		for _, w := range f.waiters {
+			if !w.deadline.After(t) && (next == nil || w.deadline.Before(next.deadline)) {
+				next = w
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		f.now = next.deadline
+		next.fire(next.deadline)
+		if next.period > 0 {
+			next.deadline = next.deadline.Add(next.period)
+		} else {
+			f.remove(next)
+		}
+	}
+
+	f.now = t
+}
+
+// fakeTicker the ticker of Fake.
+type fakeTicker struct {
+	w *waiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.w.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.w.Stop()
+}
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+
+	t.w.Reset(d)
+}
+
+// waiter the ticker or timer of Fake, the period is zero if it is timer.
+type waiter struct {
+	f        *Fake
+	deadline time.Time
+	period   time.Duration
+	ch       chan time.Time
+}
+
+// fire send the time without blocking, the tick is dropped if the
+// receiver is slow, the same as time.Ticker.
+func (w *waiter) fire(t time.Time) {
+	select {
+	case w.ch <- t:
+	default:
+	}
+}
+
+func (w *waiter) C() <-chan time.Time {
+	return w.ch
+}
+
+// Stop stop the ticker or timer, it returns false if the timer has
+// already fired or been stopped.
+func (w *waiter) Stop() bool {
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+
+	return w.f.remove(w)
+}
+
+// Reset reschedule the ticker or timer to fire after d, it returns true if
+// the timer was active.
+func (w *waiter) Reset(d time.Duration) bool {
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+
+	active := w.f.remove(w)
+	if w.period > 0 {
+		w.period = d
+	}
+	w.f.schedule(w, d)
+
+	return active
+}
@@ -23,14 +23,25 @@ var (
 
 // ErrOverMaxLimit Over limit
 var (
-	ErrOverMaxLimit = errors.New("over max limit")
-	ErrClosed       = errors.New("limiter closed")
+	ErrOverMaxLimit   = errors.New("over max limit")
+	ErrClosed         = errors.New("limiter closed")
+	ErrExceedDeadline = errors.New("wait would exceed context deadline")
+	// ErrExceedCapacity the cost of request exceeds the capacity of limiter,
+	// the request is never allowed no matter how long to wait.
+	ErrExceedCapacity = errors.New("request cost exceeds limiter capacity")
+	ErrInvalidCost    = errors.New("request cost must not be negative")
+	ErrMissingKey     = errors.New("limiter key must not be empty")
+	// ErrInvalidRate the rate of limiter is out of the range it supports.
+	ErrInvalidRate = errors.New("limiter rate out of range")
+	// ErrInvalidInterval the interval of limiter is not positive.
+	ErrInvalidInterval = errors.New("limiter interval must be positive")
 )
 
 var (
 	ErrMetricsChannelNotExists = errors.New("metrics channel not exists")
 	ErrDelConfig               = errors.New("delete rate config error")
 	ErrFileType                = errors.New("unsupported file type")
+	ErrInvalidPin              = errors.New("pin must expire in the future")
 )
 
 var (
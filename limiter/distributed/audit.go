@@ -0,0 +1,254 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package distributed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TimeWtr/gox/limiter/distributed/engine"
+	"github.com/redis/go-redis/v9"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// AuditRecord the decision of adjusting the rate of latitude, it records
+// why the rate is changed for the post-incident review.
+type AuditRecord struct {
+	// the time of the decision.
+	Timestamp time.Time `json:"timestamp"`
+	// the latitude whose rate is adjusted.
+	Latitude string `json:"latitude"`
+	// the latitude whose trigger fires or recovers, it is the latitude
+	// itself or an ancestor.
+	TriggerLatitude string              `json:"trigger_latitude"`
+	Priority        engine.PriorityType `json:"priority,omitempty"`
+	// the metrics of trigger latitude as input.
+	Metrics engine.Metrics `json:"metrics"`
+	// the evaluated trigger tree.
+	Trace *engine.Trace `json:"trace,omitempty"`
+	// the rate before adjusting, zero if unknown.
+	OldRate uint64 `json:"old_rate"`
+	NewRate uint64 `json:"new_rate"`
+	// the status of trigger latitude before and after the decision.
+	From engine.CircuitState `json:"from"`
+	To   engine.CircuitState `json:"to"`
+	// the rule is in shadow mode, the rate is not modified.
+	Shadow bool `json:"shadow,omitempty"`
+	// the node made the decision.
+	Node string `json:"node"`
+	// the error of modifying the rate, empty if succeeded.
+	Err string `json:"error,omitempty"`
+}
+
+// Auditor the sink of the audit records.
+type Auditor interface {
+	Record(ctx context.Context, r AuditRecord) error
+}
+
+var _ Auditor = (*AuditLog)(nil)
+
+// AuditLog the in memory audit log, the records are appended to the ring
+// of latitude, the oldest ones are overwritten if the ring is full.
+type AuditLog struct {
+	capacity int
+	rings    map[string]*auditRing
+	mu       *sync.RWMutex
+}
+
+type auditRing struct {
+	records []AuditRecord
+	// the index of the next record.
+	next int
+	full bool
+}
+
+// NewAuditLog create the audit log keeps capacity records per latitude at most.
+func NewAuditLog(capacity int) *AuditLog {
+	return &AuditLog{
+		capacity: max(1, capacity),
+		rings:    map[string]*auditRing{},
+		mu:       new(sync.RWMutex),
+	}
+}
+
+func (a *AuditLog) Record(_ context.Context, r AuditRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ring, ok := a.rings[r.Latitude]
+	if !ok {
+		ring = &auditRing{records: make([]AuditRecord, a.capacity)}
+		a.rings[r.Latitude] = ring
+	}
+
+	ring.records[ring.next] = r
+	ring.next = (ring.next + 1) % a.capacity
+	ring.full = ring.full || ring.next == 0
+
+	return nil
+}
+
+// Query return the records of latitude since the time in order, zero
+// since means all.
+func (a *AuditLog) Query(latitude string, since time.Time) []AuditRecord {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	ring, ok := a.rings[latitude]
+	if !ok {
+		return nil
+	}
+
+	ordered := ring.records[:ring.next]
+	if ring.full {
+		ordered = append(append([]AuditRecord{}, ring.records[ring.next:]...), ordered...)
+	}
+
+	var res []AuditRecord
+	for _, r := range ordered {
+		if !r.Timestamp.Before(since) {
+			res = append(res, r)
+		}
+	}
+
+	return res
+}
+
+// Latitudes return the latitudes audited in order.
+func (a *AuditLog) Latitudes() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	res := make([]string, 0, len(a.rings))
+	for latitude := range a.rings {
+		res = append(res, latitude)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+const DefaultAuditPrefix = "audit"
+
+var _ Auditor = (*RedisAuditor)(nil)
+
+// RedisAuditor persist the records to the redis stream of latitude, the
+// key is <prefix>:<latitude>, and the record is encoded as json in the
+// field "record". The stream is trimmed to maxLen approximately.
+type RedisAuditor struct {
+	client redis.Cmdable
+	prefix string
+	maxLen int64
+}
+
+func NewRedisAuditor(client redis.Cmdable, prefix string, maxLen int64) *RedisAuditor {
+	if prefix == "" {
+		prefix = DefaultAuditPrefix
+	}
+
+	return &RedisAuditor{client: client, prefix: prefix, maxLen: maxLen}
+}
+
+func (ra *RedisAuditor) Record(ctx context.Context, r AuditRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return ra.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: ra.prefix + ":" + r.Latitude,
+		MaxLen: ra.maxLen,
+		Approx: ra.maxLen > 0,
+		Values: []any{"record", data},
+	}).Err()
+}
+
+var _ Auditor = (*EtcdAuditor)(nil)
+
+// EtcdAuditor persist the records to etcd, the key is
+// <prefix>/<latitude>/<unix nano>, so that the records of latitude can be
+// listed in order by prefix. The records expire after ttl if not zero, the
+// records in the same ttl bucket share a lease of 2*ttl, so that every
+// record lives for ttl at least.
+type EtcdAuditor struct {
+	kv     clientv3.KV
+	lease  clientv3.Lease
+	prefix string
+	ttl    time.Duration
+	// the lease of the current ttl bucket, zero if not granted.
+	leaseID clientv3.LeaseID
+	bucket  int64
+	mu      *sync.Mutex
+}
+
+// NewEtcdAuditor create the etcd auditor, lease is only used if ttl is not zero.
+func NewEtcdAuditor(kv clientv3.KV, lease clientv3.Lease, prefix string, ttl time.Duration) *EtcdAuditor {
+	if prefix == "" {
+		prefix = DefaultAuditPrefix
+	}
+
+	return &EtcdAuditor{kv: kv, lease: lease, prefix: prefix, ttl: ttl, mu: new(sync.Mutex)}
+}
+
+func (ea *EtcdAuditor) Record(ctx context.Context, r AuditRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	var opts []clientv3.OpOption
+	if ea.ttl > 0 && ea.lease != nil {
+		id, err := ea.grant(ctx, r.Timestamp.UnixNano()/ea.ttl.Nanoseconds())
+		if err != nil {
+			return err
+		}
+		opts = append(opts, clientv3.WithLease(id))
+	}
+
+	key := fmt.Sprintf("%s/%s/%s", ea.prefix, r.Latitude, strconv.FormatInt(r.Timestamp.UnixNano(), 10))
+	if _, err = ea.kv.Put(ctx, key, string(data), opts...); err != nil && len(opts) > 0 {
+		// the lease may be revoked, grant a new one for the next record.
+		ea.mu.Lock()
+		ea.leaseID = 0
+		ea.mu.Unlock()
+	}
+
+	return err
+}
+
+// grant return the lease of the ttl bucket, it is granted on the first
+// record of bucket.
+func (ea *EtcdAuditor) grant(ctx context.Context, bucket int64) (clientv3.LeaseID, error) {
+	ea.mu.Lock()
+	defer ea.mu.Unlock()
+
+	if ea.leaseID != 0 && ea.bucket == bucket {
+		return ea.leaseID, nil
+	}
+
+	resp, err := ea.lease.Grant(ctx, max(1, int64(math.Ceil(2*ea.ttl.Seconds()))))
+	if err != nil {
+		return 0, err
+	}
+	ea.leaseID, ea.bucket = resp.ID, bucket
+
+	return resp.ID, nil
+}
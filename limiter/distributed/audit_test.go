@@ -0,0 +1,260 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package distributed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/limiter/distributed/engine"
+	"github.com/TimeWtr/gox/log"
+	"github.com/redis/go-redis/v9"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := NewAuditLog(3)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, a.Record(context.Background(), AuditRecord{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Latitude:  "order",
+			NewRate:   uint64(i),
+		}))
+	}
+	require.NoError(t, a.Record(context.Background(), AuditRecord{Timestamp: start, Latitude: "user"}))
+
+	rates := func(records []AuditRecord) []uint64 {
+		var res []uint64
+		for _, r := range records {
+			res = append(res, r.NewRate)
+		}
+		return res
+	}
+	// the oldest records are overwritten.
+	assert.Equal(t, []uint64{2, 3, 4}, rates(a.Query("order", time.Time{})))
+	assert.Equal(t, []uint64{3, 4}, rates(a.Query("order", start.Add(3*time.Second))))
+	assert.Len(t, a.Query("user", time.Time{}), 1)
+	assert.Empty(t, a.Query("unknown", time.Time{}))
+	assert.Equal(t, []string{"order", "user"}, a.Latitudes())
+}
+
+// failConf the Configuration always fails to set the rate.
+type failConf struct {
+	*memConf
+	err error
+}
+
+func (f *failConf) Set(ctx context.Context, latitude string, rate uint64) error {
+	if latitude != "order_service" {
+		return f.err
+	}
+	return f.memConf.Set(ctx, latitude, rate)
+}
+
+func TestExecutor_Audit(t *testing.T) {
+	fs := engine.NewFileSource("./engine/examples/rule.json", engine.DataTypeJson)
+	p, err := engine.NewParser(fs)
+	require.NoError(t, err)
+	bs, err := NewBS(p)
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := NewAuditLog(10)
+	e := NewExecutor(newMemConf(), bs, WithClock(clock.NewFake(now)), WithAuditor(a),
+		WithNode("node-1"), WithLogger(log.NewNopLogger())).(*Executor)
+	defer e.Close()
+	require.NoError(t, e.Register(context.Background(), "/api/v1/order", 500, 1))
+
+	metrics := engine.Metrics{CPUUsage: 0.9, MemUsage: 0.5}
+	e.adjust(context.Background(), "order_service", metrics)
+
+	records := a.Query("/api/v1/order", time.Time{})
+	require.Len(t, records, 1)
+	r := records[0]
+	assert.Equal(t, now, r.Timestamp)
+	assert.Equal(t, "order_service", r.TriggerLatitude)
+	assert.Equal(t, engine.PriorityTypeLow, r.Priority)
+	assert.Equal(t, metrics, r.Metrics)
+	require.NotNil(t, r.Trace)
+	assert.True(t, r.Trace.Result)
+	assert.Equal(t, uint64(500), r.OldRate)
+	assert.Equal(t, uint64(100), r.NewRate)
+	assert.Equal(t, engine.StatusNormal, r.From)
+	assert.Equal(t, engine.StatusThrottling, r.To)
+	assert.Equal(t, "node-1", r.Node)
+	assert.Empty(t, r.Err)
+
+	// the latitude not registered has the unknown old rate.
+	records = a.Query("/api/v1/user", time.Time{})
+	require.Len(t, records, 1)
+	assert.Zero(t, records[0].OldRate)
+
+	// recovered.
+	e.adjust(context.Background(), "order_service", engine.Metrics{CPUUsage: 0.1})
+	records = a.Query("/api/v1/order", time.Time{})
+	require.Len(t, records, 2)
+	assert.Equal(t, uint64(100), records[1].OldRate)
+	assert.Equal(t, uint64(500), records[1].NewRate)
+	assert.Equal(t, engine.StatusThrottling, records[1].From)
+	assert.Equal(t, engine.StatusNormal, records[1].To)
+}
+
+// TestExecutor_Audit_Status the records carry the LimitStatus transition
+// of trigger latitude, the status keeps throttling while escalating, and
+// recovers step by step.
+func TestExecutor_Audit_Status(t *testing.T) {
+	fs := engine.NewFileSource("./engine/examples/rule.json", engine.DataTypeJson)
+	p, err := engine.NewParser(fs)
+	require.NoError(t, err)
+	bs, err := NewBS(p)
+	require.NoError(t, err)
+
+	a := NewAuditLog(10)
+	e := NewExecutor(newMemConf(), bs, WithClock(clock.NewFake(time.Now())), WithAuditor(a),
+		WithRecoverSteps(false, []int{1, 2}), WithLogger(log.NewNopLogger())).(*Executor)
+	defer e.Close()
+
+	high, low := engine.Metrics{CPUUsage: 0.9}, engine.Metrics{CPUUsage: 0.1}
+	for _, m := range []engine.Metrics{high, high, low, low, low} {
+		e.adjust(context.Background(), "order_service", m)
+	}
+
+	type step struct {
+		latitude string
+		from, to engine.CircuitState
+	}
+	var got []step
+	for _, latitude := range []string{"order_service", "/api/v1/order"} {
+		for _, r := range a.Query(latitude, time.Time{}) {
+			got = append(got, step{r.Latitude, r.From, r.To})
+		}
+	}
+	assert.Equal(t, []step{
+		// the medium priority is shed while throttling.
+		{"order_service", engine.StatusThrottling, engine.StatusThrottling},
+		{"order_service", engine.StatusThrottling, engine.StatusRecovering},
+		{"/api/v1/order", engine.StatusNormal, engine.StatusThrottling},
+		{"/api/v1/order", engine.StatusRecovering, engine.StatusRecovering},
+	}, got)
+
+	// all the recover steps done.
+	e.amu.Lock()
+	defer e.amu.Unlock()
+	assert.Equal(t, engine.StatusNormal, e.statuses["order_service"].State())
+}
+
+func TestExecutor_Audit_Error(t *testing.T) {
+	setErr := errors.New("set error")
+	a := NewAuditLog(10)
+	e := NewExecutor(&failConf{memConf: newMemConf(), err: setErr}, newStubStrategy(),
+		WithAuditor(a), WithLogger(log.NewNopLogger())).(*Executor)
+	defer e.Close()
+
+	e.adjust(context.Background(), "order", engine.Metrics{CPUUsage: 0.5})
+	records := a.Query("order", time.Time{})
+	require.Len(t, records, 1)
+	assert.Equal(t, setErr.Error(), records[0].Err)
+	assert.Equal(t, uint64(50), records[0].NewRate)
+
+	// the status is kept since the rate is not modified.
+	e.amu.Lock()
+	defer e.amu.Unlock()
+	assert.Zero(t, e.rates["order"])
+}
+
+// streamStub the redis client records the stream entries added.
+type streamStub struct {
+	redis.Cmdable
+	args []*redis.XAddArgs
+}
+
+func (s *streamStub) XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd {
+	s.args = append(s.args, a)
+	return redis.NewStringResult("1-0", nil)
+}
+
+func TestRedisAuditor(t *testing.T) {
+	stub := &streamStub{}
+	ra := NewRedisAuditor(stub, "", 100)
+	r := AuditRecord{Latitude: "order", NewRate: 100, To: engine.StatusThrottling}
+	require.NoError(t, ra.Record(context.Background(), r))
+
+	require.Len(t, stub.args, 1)
+	assert.Equal(t, "audit:order", stub.args[0].Stream)
+	assert.Equal(t, int64(100), stub.args[0].MaxLen)
+	assert.True(t, stub.args[0].Approx)
+
+	var got AuditRecord
+	values := stub.args[0].Values.([]any)
+	require.NoError(t, json.Unmarshal(values[1].([]byte), &got))
+	assert.Equal(t, r, got)
+}
+
+// kvStub the etcd kv records the keys put.
+type kvStub struct {
+	clientv3.KV
+	puts map[string]string
+	opts int
+}
+
+func (k *kvStub) Put(_ context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	k.puts[key] = val
+	k.opts += len(opts)
+	return &clientv3.PutResponse{}, nil
+}
+
+// leaseStub the etcd lease grants the ids in sequence.
+type leaseStub struct {
+	clientv3.Lease
+	ttl    int64
+	grants int
+}
+
+func (l *leaseStub) Grant(_ context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	l.ttl = ttl
+	l.grants++
+	return &clientv3.LeaseGrantResponse{ID: clientv3.LeaseID(l.grants), TTL: ttl}, nil
+}
+
+func TestEtcdAuditor(t *testing.T) {
+	kv, lease := &kvStub{puts: map[string]string{}}, &leaseStub{}
+	ea := NewEtcdAuditor(kv, lease, "/gox/audit", time.Hour)
+	ts := time.Unix(0, 42)
+	require.NoError(t, ea.Record(context.Background(), AuditRecord{Timestamp: ts, Latitude: "order"}))
+
+	val, ok := kv.puts["/gox/audit/order/42"]
+	require.True(t, ok)
+	var got AuditRecord
+	require.NoError(t, json.Unmarshal([]byte(val), &got))
+	assert.Equal(t, "order", got.Latitude)
+	assert.Equal(t, int64(7200), lease.ttl)
+	assert.Equal(t, 1, kv.opts)
+
+	// the records in the same ttl bucket share the lease.
+	for i := 1; i <= 10; i++ {
+		require.NoError(t, ea.Record(context.Background(), AuditRecord{Timestamp: ts.Add(time.Duration(i) * time.Minute), Latitude: "order"}))
+	}
+	assert.Equal(t, 1, lease.grants)
+	require.NoError(t, ea.Record(context.Background(), AuditRecord{Timestamp: ts.Add(time.Hour), Latitude: "order"}))
+	assert.Equal(t, 2, lease.grants)
+}
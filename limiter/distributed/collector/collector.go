@@ -0,0 +1,216 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/limiter/distributed/engine"
+	"github.com/TimeWtr/gox/log"
+	"github.com/TimeWtr/gox/proc"
+)
+
+// CPUSampler sample the cpu usage in [0, 1] since the last sample.
+type CPUSampler interface {
+	Sample() (float64, error)
+}
+
+// Notifier return the channel to report the metrics of latitude, the
+// distributed.Executor implements it.
+type Notifier interface {
+	Notify(ctx context.Context, latitude string) (chan<- engine.Metrics, error)
+}
+
+type Option func(*Collector)
+
+// WithInterval set the interval to collect the metrics, the default is 1s.
+func WithInterval(d time.Duration) Option {
+	return func(c *Collector) {
+		if d > 0 {
+			c.interval = d
+		}
+	}
+}
+
+// WithProcFS read the system metrics from fs instead of /proc, the tests
+// can use a fixture tree.
+func WithProcFS(fs proc.FS) Option {
+	return func(c *Collector) {
+		c.fs = fs
+	}
+}
+
+// WithCgroup read the cpu and memory from cgroup instead of the whole
+// system, it is used in containers.
+func WithCgroup(cg *proc.Cgroup) Option {
+	return func(c *Collector) {
+		c.cg = cg
+	}
+}
+
+// WithRecorder set the source of the request latency and error rate, they
+// are not reported if not set.
+func WithRecorder(r Recorder) Option {
+	return func(c *Collector) {
+		c.recorder = r
+	}
+}
+
+// WithClock set the source of time.
+func WithClock(cl clock.Clock) Option {
+	return func(c *Collector) {
+		if cl != nil {
+			c.clock = cl
+		}
+	}
+}
+
+func WithLogger(lg log.Logger) Option {
+	return func(c *Collector) {
+		c.lg = lg
+	}
+}
+
+// Collector the collector of the metrics of the process, it reads the cpu,
+// the memory and the connections from /proc or cgroup, and the request
+// latency and error rate from Recorder, and publishes engine.Metrics every
+// interval. The metrics failed to read are not reported in the sample.
+type Collector struct {
+	interval time.Duration
+	fs       proc.FS
+	cg       *proc.Cgroup
+	cpu      CPUSampler
+	recorder Recorder
+	clock    clock.Clock
+	lg       log.Logger
+}
+
+func New(opts ...Option) *Collector {
+	c := &Collector{
+		interval: time.Second,
+		fs:       proc.DefaultFS(),
+		clock:    clock.Real(),
+		lg:       log.NewNopLogger(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.cpu = proc.NewSystemCPUUsage(c.fs)
+	if c.cg != nil {
+		c.cpu = proc.NewCgroupCPUUsage(c.cg, c.clock)
+	}
+
+	return c
+}
+
+// Collect collect the metrics once, the error joins the errors of the
+// metrics failed to read, and the others are still reported.
+func (c *Collector) Collect() (engine.Metrics, error) {
+	m := engine.Metrics{Timestamp: c.clock.Now(), Tracked: true}
+	var errs []error
+
+	if usage, err := c.cpu.Sample(); err != nil {
+		errs = append(errs, err)
+	} else {
+		_ = m.Set("cpu_usage", usage)
+	}
+
+	if c.cg != nil {
+		if mem, err := c.cg.Memory(); err != nil {
+			errs = append(errs, err)
+		} else {
+			_ = m.Set("mem_used", float64(mem.Used))
+			// the usage is unknown without limit.
+			if mem.Limit > 0 {
+				_ = m.Set("mem_usage", mem.Usage())
+			}
+		}
+	} else {
+		if mem, err := c.fs.Memory(); err != nil {
+			errs = append(errs, err)
+		} else {
+			_ = m.Set("mem_used", float64(mem.Used()))
+			_ = m.Set("mem_usage", mem.Usage())
+		}
+	}
+
+	if conns, err := c.fs.Connections(); err != nil {
+		errs = append(errs, err)
+	} else {
+		_ = m.Set("active_conns", float64(conns))
+	}
+
+	if c.recorder != nil {
+		if latency, errRate, ok := c.recorder.Snapshot(); ok {
+			_ = m.Set("request_latency", latency)
+			_ = m.Set("err_rate", errRate)
+		}
+	}
+
+	return m, errors.Join(errs...)
+}
+
+// Run collect the metrics every interval and publish to chs until ctx is
+// done, the sample is dropped for the channel full, so that the slow
+// consumer never blocks the others.
+func (c *Collector) Run(ctx context.Context, chs ...chan<- engine.Metrics) error {
+	ticker := c.clock.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C():
+		}
+
+		m, err := c.Collect()
+		if err != nil {
+			c.lg.Warnf("failed to collect metrics", log.Field{Key: "error", Value: err})
+		}
+		// nothing is read.
+		if m.Reported == 0 {
+			continue
+		}
+
+		for _, ch := range chs {
+			select {
+			case ch <- m:
+			default:
+				c.lg.Warnf("metrics channel is full, drop the sample")
+			}
+		}
+	}
+}
+
+// RunNotify publish the metrics to the channels of latitudes returned by
+// n, such as distributed.Executor.
+func (c *Collector) RunNotify(ctx context.Context, n Notifier, latitudes ...string) error {
+	chs := make([]chan<- engine.Metrics, 0, len(latitudes))
+	for _, latitude := range latitudes {
+		ch, err := n.Notify(ctx, latitude)
+		if err != nil {
+			return err
+		}
+		chs = append(chs, ch)
+	}
+
+	return c.Run(ctx, chs...)
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+	"github.com/TimeWtr/gox/limiter/distributed/engine"
+	"github.com/TimeWtr/gox/proc"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const fixture = "../../../proc/testdata"
+
+var start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestCollector_Collect(t *testing.T) {
+	r := NewRequestRecorder()
+	r.Record(100*time.Millisecond, nil)
+	r.Record(300*time.Millisecond, errors.New("timeout"))
+
+	c := New(WithProcFS(proc.NewFS(fixture+"/proc")), WithRecorder(r), WithClock(clock.NewFake(start)))
+	m, err := c.Collect()
+	assert.NoError(t, err)
+	assert.Equal(t, start, m.Timestamp)
+
+	want := map[string]float64{
+		"cpu_usage":       1 - 3722.0/9384,
+		"mem_usage":       0.75,
+		"mem_used":        6000000 * 1024,
+		"active_conns":    3,
+		"request_latency": 200,
+		"err_rate":        0.5,
+	}
+	for field, value := range want {
+		v, ok := m.Get(field)
+		assert.True(t, ok, field)
+		assert.InDelta(t, value, v, 1e-9, field)
+	}
+
+	// the recorder is reset by the snapshot.
+	m, err = c.Collect()
+	assert.NoError(t, err)
+	_, ok := m.Get("request_latency")
+	assert.False(t, ok)
+}
+
+func TestCollector_Collect_Cgroup(t *testing.T) {
+	c := New(WithProcFS(proc.NewFS(fixture+"/proc")),
+		WithCgroup(proc.NewCgroup(fixture+"/cgroup/v2")), WithClock(clock.NewFake(start)))
+	m, err := c.Collect()
+	assert.NoError(t, err)
+
+	v, _ := m.Get("mem_used")
+	assert.Equal(t, float64(500000000), v)
+	v, _ = m.Get("mem_usage")
+	assert.InDelta(t, 500000000.0/(1<<30), v, 1e-9)
+	// the first sample of cgroup cpu is zero.
+	v, ok := m.Get("cpu_usage")
+	assert.True(t, ok)
+	assert.Zero(t, v)
+}
+
+func TestCollector_Collect_Missing(t *testing.T) {
+	c := New(WithProcFS(proc.NewFS(t.TempDir())))
+	m, err := c.Collect()
+	assert.Error(t, err)
+	assert.Zero(t, m.Reported)
+	_, ok := m.Get("mem_usage")
+	assert.False(t, ok, "nothing is reported")
+}
+
+// notifier return the channels by latitude.
+type notifier map[string]chan engine.Metrics
+
+func (n notifier) Notify(_ context.Context, latitude string) (chan<- engine.Metrics, error) {
+	ch, ok := n[latitude]
+	if !ok {
+		return nil, errorx.ErrMetricsChannelNotExists
+	}
+
+	return ch, nil
+}
+
+func TestCollector_RunNotify(t *testing.T) {
+	fc := clock.NewFake(start)
+	c := New(WithProcFS(proc.NewFS(fixture+"/proc")), WithInterval(time.Second), WithClock(fc))
+	n := notifier{"order_service": make(chan engine.Metrics, 1), "user_service": make(chan engine.Metrics)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- c.RunNotify(ctx, n, "order_service", "user_service")
+	}()
+
+	// the full channel of user_service never blocks the others.
+	for i := 1; i <= 2; i++ {
+		fc.BlockUntil(1)
+		fc.Advance(time.Second)
+		m := <-n["order_service"]
+		assert.NotZero(t, m.Reported&engine.MetricsMemUsage)
+		assert.Equal(t, start.Add(time.Duration(i)*time.Second), m.Timestamp)
+	}
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+
+	err := c.RunNotify(context.Background(), n, "pay_service")
+	assert.Equal(t, errorx.ErrMetricsChannelNotExists, err)
+}
+
+func TestRequestRecorder_Snapshot(t *testing.T) {
+	r := NewRequestRecorder()
+	_, _, ok := r.Snapshot()
+	assert.False(t, ok)
+
+	r.Record(10*time.Millisecond, nil)
+	latency, errRate, ok := r.Snapshot()
+	assert.True(t, ok)
+	assert.Equal(t, 10.0, latency)
+	assert.Zero(t, errRate)
+}
@@ -0,0 +1,73 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// Recorder the in-process recorder of the request latency and the error
+// rate, the collector takes the snapshot every interval.
+type Recorder interface {
+	// Snapshot return the average latency in milliseconds and the error
+	// rate since the last snapshot, ok is false if there is no request.
+	Snapshot() (latency float64, errRate float64, ok bool)
+}
+
+var _ Recorder = (*RequestRecorder)(nil)
+
+// RequestRecorder the default Recorder, the application records every
+// request done by Record.
+type RequestRecorder struct {
+	count   int64
+	errs    int64
+	latency time.Duration
+	mu      *sync.Mutex
+}
+
+func NewRequestRecorder() *RequestRecorder {
+	return &RequestRecorder{mu: new(sync.Mutex)}
+}
+
+// Record record the request done with latency d, err not nil means the
+// request failed.
+func (r *RequestRecorder) Record(d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.count++
+	r.latency += d
+	if err != nil {
+		r.errs++
+	}
+}
+
+// Snapshot return the average latency and the error rate of the requests
+// recorded since the last snapshot, and reset the recorder.
+func (r *RequestRecorder) Snapshot() (float64, float64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.count == 0 {
+		return 0, 0, false
+	}
+
+	latency := float64(r.latency) / float64(r.count) / float64(time.Millisecond)
+	errRate := float64(r.errs) / float64(r.count)
+	r.count, r.errs, r.latency = 0, 0, 0
+
+	return latency, errRate, true
+}
@@ -16,7 +16,12 @@ package distributed
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"strconv"
+	"time"
 
 	"github.com/TimeWtr/gox/errorx"
 	"github.com/redis/go-redis/v9"
@@ -28,6 +33,29 @@ type Configuration interface {
 	Del(ctx context.Context, latitude string) error
 }
 
+// Pin the manual override or freeze of the rate of latitude, the
+// decisions of the strategy are suppressed for latitude until it expires.
+type Pin struct {
+	// the rate is overridden to Rate, otherwise the rate is frozen as is.
+	Override bool   `json:"override"`
+	Rate     uint64 `json:"rate"`
+	// the time the pin expires.
+	Until time.Time `json:"until"`
+}
+
+// PinConfiguration the Configuration stores the pins of latitudes, so that
+// all the nodes suppress the decisions of the latitude pinned. The pin
+// expires automatically after ttl, it is computed from Pin.Until by the
+// clock of the Executor, so that the wall clock is never relied on.
+type PinConfiguration interface {
+	Configuration
+	SetPin(ctx context.Context, latitude string, pin Pin, ttl time.Duration) error
+	// GetPin return the pin of latitude, false if not pinned or expired.
+	GetPin(ctx context.Context, latitude string) (Pin, bool, error)
+}
+
+const DefaultPinPrefix = "pin"
+
 const DefaultHashtableName = "metadata"
 
 const (
@@ -41,6 +69,8 @@ const (
 	DefaultActiveConnsKey    = "Active Conns"
 )
 
+var _ PinConfiguration = (*RedisConf)(nil)
+
 // RedisConf Use redis as the configuration center to request
 // current limiting original data and the storage structure is a hash
 // table. the default table name is metadata.
@@ -77,6 +107,42 @@ func (rc *RedisConf) Del(ctx context.Context, latitude string) error {
 	return nil
 }
 
+// pinKey the key of the pin of latitude, <hashTableName>:pin:<latitude>.
+func (rc *RedisConf) pinKey(latitude string) string {
+	return fmt.Sprintf("%s:%s:%s", rc.hashTableName, DefaultPinPrefix, latitude)
+}
+
+// SetPin set the pin expires after ttl, the ttl is rounded up to
+// milliseconds.
+func (rc *RedisConf) SetPin(ctx context.Context, latitude string, pin Pin, ttl time.Duration) error {
+	data, err := json.Marshal(pin)
+	if err != nil {
+		return err
+	}
+
+	ttl = max(time.Millisecond, (ttl + time.Millisecond - 1).Truncate(time.Millisecond))
+	return rc.client.SetArgs(ctx, rc.pinKey(latitude), data, redis.SetArgs{TTL: ttl}).Err()
+}
+
+func (rc *RedisConf) GetPin(ctx context.Context, latitude string) (Pin, bool, error) {
+	data, err := rc.client.Get(ctx, rc.pinKey(latitude)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Pin{}, false, nil
+	}
+	if err != nil {
+		return Pin{}, false, err
+	}
+
+	var pin Pin
+	if err = json.Unmarshal(data, &pin); err != nil {
+		return Pin{}, false, err
+	}
+
+	return pin, true, nil
+}
+
+var _ PinConfiguration = (*EtcdConf)(nil)
+
 // EtcdConf Use etcd as the configuration center to request
 // current limiting original data and the storage structure is a hash
 // table.
@@ -104,3 +170,34 @@ func (e *EtcdConf) Del(ctx context.Context, latitude string) error {
 	_, err := e.client.Delete(ctx, latitude)
 	return err
 }
+
+// SetPin put the pin to <pin>/<latitude> with the lease expires after
+// ttl, the lease is rounded up to seconds.
+func (e *EtcdConf) SetPin(ctx context.Context, latitude string, pin Pin, ttl time.Duration) error {
+	data, err := json.Marshal(pin)
+	if err != nil {
+		return err
+	}
+
+	grant, err := e.client.Grant(ctx, max(1, int64(math.Ceil(ttl.Seconds()))))
+	if err != nil {
+		return err
+	}
+
+	_, err = e.client.Put(ctx, DefaultPinPrefix+"/"+latitude, string(data), clientv3.WithLease(grant.ID))
+	return err
+}
+
+func (e *EtcdConf) GetPin(ctx context.Context, latitude string) (Pin, bool, error) {
+	resp, err := e.client.Get(ctx, DefaultPinPrefix+"/"+latitude)
+	if err != nil || len(resp.Kvs) == 0 {
+		return Pin{}, false, err
+	}
+
+	var pin Pin
+	if err = json.Unmarshal(resp.Kvs[0].Value, &pin); err != nil {
+		return Pin{}, false, err
+	}
+
+	return pin, true, nil
+}
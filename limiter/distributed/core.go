@@ -16,9 +16,13 @@ package distributed
 
 import (
 	"context"
+	"errors"
+	"os"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/TimeWtr/gox/clock"
 	"github.com/TimeWtr/gox/limiter/distributed/engine"
 
 	limiter2 "github.com/TimeWtr/gox/limiter"
@@ -34,10 +38,19 @@ type EI interface {
 	Register(ctx context.Context, latitude string, rate uint64, capacity int) error
 	// Unregister the method to unregister latitude request rate.
 	Unregister(ctx context.Context, latitude string) error
+	// Override the method to pin the request rate of latitude to rate for
+	// ttl, the rate decided by the strategy is applied when expired.
+	Override(ctx context.Context, latitude string, rate uint64, ttl time.Duration) error
+	// Freeze the method to keep the request rate of latitude as is until
+	// the time.
+	Freeze(ctx context.Context, latitude string, until time.Time) error
 	// Notify the method to get the specified channel of sending metrics.
 	Notify(ctx context.Context, latitude string) (chan<- engine.Metrics, error)
+	// Run the method to dynamic adjust request rate according to received
+	// metrics until ctx is done or closed.
+	Run(ctx context.Context) error
 	// DynamicController the method to dynamic adjust request
-	// rate according to received metrics.
+	// rate according to received metrics every interval until closed.
 	DynamicController(interval time.Duration) error
 	// Close the method to close distributed Executor.
 	Close() error
@@ -57,6 +70,79 @@ func WithLogger(lg log.Logger) Options {
 	}
 }
 
+// WithClock set the source of time of the dynamic controller, the tests can
+// use clock.Fake to advance time exactly.
+func WithClock(c clock.Clock) Options {
+	return func(e *Executor) {
+		if c != nil {
+			e.clock = c
+		}
+	}
+}
+
+// WithShadowRecorder record the adjustments of the rules in shadow mode,
+// the latitude whose rate would be cut down is recorded as rejected.
+func WithShadowRecorder(r limiter2.ShadowRecorder) Options {
+	return func(e *Executor) {
+		e.shadow = r
+	}
+}
+
+// WithInterval set the interval to consume the metrics, the default is 1s.
+func WithInterval(d time.Duration) Options {
+	return func(e *Executor) {
+		if d > 0 {
+			e.interval = d
+		}
+	}
+}
+
+// WithWorkers bound the latitudes adjusted concurrently, the default is 4.
+func WithWorkers(n int) Options {
+	return func(e *Executor) {
+		if n > 0 {
+			e.workers = n
+		}
+	}
+}
+
+// WithErrorHandler handle the errors of adjusting the rate of latitude,
+// such as the failure of judging or setting rate. It is called by the
+// workers concurrently.
+func WithErrorHandler(fn func(latitude string, err error)) Options {
+	return func(e *Executor) {
+		e.onError = fn
+	}
+}
+
+// WithAuditor record the decisions of adjusting the rates to the auditors,
+// such as AuditLog in memory and RedisAuditor to persist them.
+func WithAuditor(a ...Auditor) Options {
+	return func(e *Executor) {
+		e.auditors = append(e.auditors, a...)
+	}
+}
+
+// WithRecoverSteps set the recover steps of the LimitStatus of the trigger
+// latitudes in the audit records, rollback allows going back to the
+// previous step if the trigger fires again while recovering.
+func WithRecoverSteps(rollback bool, steps []int) Options {
+	return func(e *Executor) {
+		e.rollback = rollback
+		e.steps = steps
+	}
+}
+
+// WithNode set the name of the node making the decisions in the audit
+// records, the default is the hostname.
+func WithNode(node string) Options {
+	return func(e *Executor) {
+		if node != "" {
+			e.node = node
+		}
+	}
+}
+
 type Executor struct {
 	// the channel collection for reporting metrics data.
 	ch map[string]chan engine.Metrics
@@ -70,20 +156,69 @@ type Executor struct {
 	stg DecisionStrategy
 	// logger
 	lg log.Logger
+	// the recorder of the adjustments in shadow mode, optional.
+	shadow limiter2.ShadowRecorder
+	// the source of time
+	clock clock.Clock
+	// the interval to consume the metrics.
+	interval time.Duration
+	// the max latitudes adjusted concurrently.
+	workers int
+	// the handler of the adjusting errors, optional.
+	onError func(latitude string, err error)
+	// the sinks of the audit records, optional.
+	auditors []Auditor
+	// the name of the node in the audit records.
+	node string
+	// the current rates of the latitudes, and the status of the trigger
+	// latitudes for auditing.
+	rates    map[string]uint64
+	statuses map[string]*engine.LimitStatus
+	// the LimitStatus config of the trigger latitudes.
+	rollback bool
+	steps    []int
+	// the rates decided by the strategy, including the ones suppressed by
+	// pins, they are applied when the pins are lifted.
+	desired map[string]uint64
+	// the latitudes pinned by this node.
+	pins map[string]Pin
+	// the latitudes whose decisions are suppressed by the pins.
+	suppressed map[string]struct{}
+	// the locks serializing the rates set of the latitudes, and the
+	// sequence of the latest decision applied to the latitudes, so that
+	// the stale decisions are never applied.
+	locks   map[string]*latitudeLock
+	applied map[string]uint64
+	seq     uint64
+	amu     *sync.Mutex
 	// close channel
 	closeCh chan struct{}
+	once    sync.Once
 }
 
 func NewExecutor(cf Configuration, stg DecisionStrategy, opts ...Options) EI {
 	logger, _ := zap.NewDevelopment()
+	node, _ := os.Hostname()
 
 	e := &Executor{
-		ch:      map[string]chan engine.Metrics{},
-		mu:      new(sync.RWMutex),
-		cf:      cf,
-		stg:     stg,
-		lg:      log.NewZapLogger(logger),
-		closeCh: make(chan struct{}),
+		ch:         map[string]chan engine.Metrics{},
+		mu:         new(sync.RWMutex),
+		cf:         cf,
+		stg:        stg,
+		lg:         log.NewZapLogger(logger),
+		clock:      clock.Real(),
+		interval:   time.Second,
+		workers:    4,
+		node:       node,
+		rates:      map[string]uint64{},
+		statuses:   map[string]*engine.LimitStatus{},
+		desired:    map[string]uint64{},
+		pins:       map[string]Pin{},
+		suppressed: map[string]struct{}{},
+		locks:      map[string]*latitudeLock{},
+		applied:    map[string]uint64{},
+		amu:        new(sync.Mutex),
+		closeCh:    make(chan struct{}),
 	}
 
 	for _, opt := range opts {
@@ -99,7 +234,14 @@ func (e *Executor) Register(ctx context.Context, latitude string, rate uint64, c
 	defer e.mu.Unlock()
 
 	e.ch[latitude] = make(chan engine.Metrics, capacity)
-	return e.cf.Set(ctx, latitude, rate)
+	if err := e.cf.Set(ctx, latitude, rate); err != nil {
+		return err
+	}
+
+	e.amu.Lock()
+	e.rates[latitude], e.desired[latitude] = rate, rate
+	e.amu.Unlock()
+	return nil
 }
 
 // Unregister unregister latitude and request rate.
@@ -108,9 +250,237 @@ func (e *Executor) Unregister(ctx context.Context, latitude string) error {
 	defer e.mu.Unlock()
 
 	delete(e.ch, latitude)
+	e.amu.Lock()
+	delete(e.rates, latitude)
+	delete(e.statuses, latitude)
+	delete(e.desired, latitude)
+	delete(e.pins, latitude)
+	delete(e.suppressed, latitude)
+	delete(e.applied, latitude)
+	e.amu.Unlock()
 	return e.cf.Del(ctx, latitude)
 }
 
+// Override pin the request rate of latitude to rate for ttl, the decisions
+// of the strategy for latitude are suppressed meanwhile. When expired, the
+// rate decided by the strategy is applied, it is the registered rate if
+// never adjusted, and the rate is kept if unknown.
+func (e *Executor) Override(ctx context.Context, latitude string, rate uint64, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errorx.ErrInvalidPin
+	}
+
+	unlock := e.lock(latitude)
+	defer unlock()
+
+	// pin first, so that the rate is never modified by the adjusting in flight.
+	if err := e.pin(ctx, latitude, Pin{Override: true, Rate: rate, Until: e.clock.Now().Add(ttl)}); err != nil {
+		return err
+	}
+	if err := e.cf.Set(ctx, latitude, rate); err != nil {
+		return err
+	}
+
+	e.amu.Lock()
+	e.rates[latitude] = rate
+	e.amu.Unlock()
+	return nil
+}
+
+// Freeze keep the request rate of latitude as is until the time, the
+// decisions of the strategy for latitude are suppressed meanwhile, and the
+// latest one is applied when expired.
+func (e *Executor) Freeze(ctx context.Context, latitude string, until time.Time) error {
+	if !until.After(e.clock.Now()) {
+		return errorx.ErrInvalidPin
+	}
+
+	return e.pin(ctx, latitude, Pin{Until: until})
+}
+
+// pin store the pin of latitude to the configuration center if supported,
+// so that the other nodes suppress the decisions too. The pin expires in
+// the configuration center after the ttl measured by the clock.
+func (e *Executor) pin(ctx context.Context, latitude string, p Pin) error {
+	if pc, ok := e.cf.(PinConfiguration); ok {
+		if err := pc.SetPin(ctx, latitude, p, p.Until.Sub(e.clock.Now())); err != nil {
+			return err
+		}
+	}
+
+	e.amu.Lock()
+	e.pins[latitude] = p
+	e.amu.Unlock()
+	return nil
+}
+
+// pinned report whether the latitude is pinned by this node or the others,
+// the latitude is regarded as pinned if failed to get the pin, so that the
+// decisions are suppressed until the pin is known.
+func (e *Executor) pinned(ctx context.Context, latitude string) bool {
+	now := e.clock.Now()
+	e.amu.Lock()
+	p, ok := e.pins[latitude]
+	e.amu.Unlock()
+	if ok && now.Before(p.Until) {
+		return true
+	}
+
+	pc, ok := e.cf.(PinConfiguration)
+	if !ok {
+		return false
+	}
+
+	p, ok, err := pc.GetPin(ctx, latitude)
+	if err != nil {
+		e.lg.Warnf("get pin error", log.Field{
+			Key:   "latitude",
+			Value: latitude,
+		}, log.Field{
+			Key:   "error",
+			Value: err.Error(),
+		})
+		return true
+	}
+
+	return ok && now.Before(p.Until)
+}
+
+// expire remove the pins expired, and apply the rates decided by the
+// strategy to the latitudes no longer pinned by this node or the others.
+func (e *Executor) expire(ctx context.Context) {
+	now := e.clock.Now()
+	var candidates []string
+	e.amu.Lock()
+	for latitude, p := range e.pins {
+		if !now.Before(p.Until) {
+			delete(e.pins, latitude)
+			candidates = append(candidates, latitude)
+			e.lg.Infof("pin expired", log.Field{
+				Key:   "latitude",
+				Value: latitude,
+			}, log.Field{
+				Key:   "override",
+				Value: p.Override,
+			})
+		}
+	}
+	for latitude := range e.suppressed {
+		if _, ok := e.pins[latitude]; !ok && !slices.Contains(candidates, latitude) {
+			candidates = append(candidates, latitude)
+		}
+	}
+	e.amu.Unlock()
+
+	for _, latitude := range candidates {
+		e.restore(ctx, latitude)
+	}
+}
+
+// restore apply the rate decided by the strategy to latitude if it is no
+// longer pinned.
+func (e *Executor) restore(ctx context.Context, latitude string) {
+	unlock := e.lock(latitude)
+	defer unlock()
+
+	if e.pinned(ctx, latitude) {
+		// try again when the pin is lifted or known.
+		e.amu.Lock()
+		e.suppressed[latitude] = struct{}{}
+		e.amu.Unlock()
+		return
+	}
+
+	e.amu.Lock()
+	delete(e.suppressed, latitude)
+	rate, ok := e.desired[latitude]
+	current, known := e.rates[latitude]
+	e.amu.Unlock()
+	if !ok || (known && rate == current) {
+		return
+	}
+
+	ctx1, cancel := context.WithTimeout(ctx, 2*time.Second)
+	err := e.cf.Set(ctx1, latitude, rate)
+	cancel()
+	if err != nil {
+		e.lg.Errorf("restore request rate error", log.Field{
+			Key:   "latitude",
+			Value: latitude,
+		}, log.Field{
+			Key:   "error",
+			Value: err.Error(),
+		})
+		e.handleError(latitude, err)
+		return
+	}
+
+	e.amu.Lock()
+	e.rates[latitude] = rate
+	e.amu.Unlock()
+	e.lg.Infof("request rate restored after pin", log.Field{
+		Key:   "latitude",
+		Value: latitude,
+	}, log.Field{
+		Key:   "rate",
+		Value: rate,
+	})
+}
+
+// latitudeLock the lock of latitude referenced by the adjusting in flight.
+type latitudeLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock serialize setting the rate of latitude, the workers adjusting the
+// same latitude for the different trigger latitudes never set the rates
+// concurrently. It returns the function to unlock.
+func (e *Executor) lock(latitude string) (unlock func()) {
+	e.amu.Lock()
+	l, ok := e.locks[latitude]
+	if !ok {
+		l = &latitudeLock{}
+		e.locks[latitude] = l
+	}
+	l.refs++
+	e.amu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		e.amu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(e.locks, latitude)
+		}
+		e.amu.Unlock()
+	}
+}
+
+// next return the sequence of the decision to make, the later decisions
+// have the greater sequences.
+func (e *Executor) next() uint64 {
+	e.amu.Lock()
+	defer e.amu.Unlock()
+
+	e.seq++
+	return e.seq
+}
+
+// stale report whether a later decision than seq is applied to latitude,
+// otherwise seq is recorded as the latest one, it must be called with the
+// lock of latitude held.
+func (e *Executor) stale(latitude string, seq uint64) bool {
+	e.amu.Lock()
+	defer e.amu.Unlock()
+
+	if e.applied[latitude] > seq {
+		return true
+	}
+	e.applied[latitude] = seq
+	return false
+}
+
 // Notify the function to get the specified channel reported metrics.
 func (e *Executor) Notify(ctx context.Context, latitude string) (chan<- engine.Metrics, error) {
 	e.mu.RLock()
@@ -124,61 +494,377 @@ func (e *Executor) Notify(ctx context.Context, latitude string) (chan<- engine.M
 	return ch, nil
 }
 
+// DynamicController run the controller every interval until closed, it
+// is the same as Run without context, the non-positive interval means the
+// one set by WithInterval.
 func (e *Executor) DynamicController(interval time.Duration) error {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	if interval <= 0 {
+		interval = e.interval
+	}
 
-	errCh := make(chan error, len(e.ch))
+	return e.run(context.Background(), interval)
+}
 
-	for range ticker.C {
+// job the latest metrics of latitude to adjust.
+type job struct {
+	latitude string
+	metrics  engine.Metrics
+}
+
+// Run consume the metrics every interval until ctx is done or closed, the
+// metrics received of a latitude are coalesced to the latest one, and the
+// latitudes are adjusted by the bounded workers, one latitude is adjusted
+// by one worker at a time. It returns nil if closed, and waits for the
+// workers to exit before returning.
+func (e *Executor) Run(ctx context.Context) error {
+	return e.run(ctx, e.interval)
+}
+
+func (e *Executor) run(ctx context.Context, interval time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	ticker := e.clock.NewTicker(interval)
+	// the jobs dispatched are bounded by the workers, so that sending
+	// never blocks.
+	jobs := make(chan job, e.workers)
+	done := make(chan string, e.workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < e.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				// the jobs left are dropped after stopped.
+				if ctx.Err() == nil {
+					e.adjust(ctx, j.latitude, j.metrics)
+				}
+				done <- j.latitude
+			}
+		}()
+	}
+
+	defer func() {
+		// abort the adjusting in flight, and wait for the workers.
+		cancel()
+		ticker.Stop()
+		close(jobs)
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		for range done {
+		}
+	}()
+
+	// the latest metrics waiting for adjusting, and the latitudes adjusting.
+	pending := map[string]engine.Metrics{}
+	busy := map[string]struct{}{}
+	dispatch := func() {
+		for latitude, metrics := range pending {
+			// all the workers are busy, try again when one is done.
+			if len(busy) >= e.workers {
+				return
+			}
+			if _, ok := busy[latitude]; ok {
+				continue
+			}
+
+			jobs <- job{latitude: latitude, metrics: metrics}
+			busy[latitude] = struct{}{}
+			delete(pending, latitude)
+		}
+	}
+
+	for {
 		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case <-e.closeCh:
 			e.lg.Infof("receive closed signal")
-			break
-		default:
-			for latitude, ch := range e.ch {
-				select {
-				case metrics := <-ch:
-					go func() {
-						ctx1, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-						res := e.stg.AdjustRate(ctx1, metrics)
-						cancel()
-						if res.Err != nil {
-							// log error message
-							e.lg.Errorf("judge request rate error", log.Field{
-								Key:   "latitude",
-								Value: latitude,
-							}, log.Field{
-								Key:   "error",
-								Value: res.Err.Error(),
-							})
-
-							errCh <- res.Err
-							return
-						}
-
-						if !res.Adjust {
-							return
-						}
-						// modify
-						e.lg.Infof("judge request rate adjusted", log.Field{
-							Key:   "latitude",
-							Value: latitude,
-						}, log.Field{
-							Key:   "rate",
-							Value: res.Rate,
-						})
-					}()
-				default:
+			return nil
+		case latitude := <-done:
+			delete(busy, latitude)
+			dispatch()
+		case <-ticker.C():
+			e.expire(ctx)
+			e.receive(pending)
+			dispatch()
+		}
+	}
+}
+
+// receive drain the metrics channels, only the latest metrics of every
+// latitude is kept, the stale ones are dropped.
+func (e *Executor) receive(pending map[string]engine.Metrics) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for latitude, ch := range e.ch {
+		var stale int
+		for drained := false; !drained; {
+			select {
+			case metrics := <-ch:
+				if _, ok := pending[latitude]; ok {
+					stale++
 				}
+				pending[latitude] = metrics
+			default:
+				drained = true
 			}
 		}
+
+		if stale > 0 {
+			e.lg.Debugf("coalesce stale metrics", log.Field{
+				Key:   "latitude",
+				Value: latitude,
+			}, log.Field{
+				Key:   "stale",
+				Value: stale,
+			})
+		}
 	}
+}
 
-	return nil
+// adjust judge the request rate of latitude by metrics, and modify the
+// rates of the latitudes shed or restored.
+func (e *Executor) adjust(ctx context.Context, latitude string, metrics engine.Metrics) {
+	seq := e.next()
+	ctx1, cancel := context.WithTimeout(ctx, 2*time.Second)
+	res := e.stg.AdjustRate(ctx1, latitude, metrics)
+	cancel()
+	if res.Err != nil {
+		// log error message
+		e.lg.Errorf("judge request rate error", append([]log.Field{{
+			Key:   "latitude",
+			Value: latitude,
+		}, {
+			Key:   "error",
+			Value: res.Err.Error(),
+		}}, traceFields(res.Trace)...)...)
+		e.handleError(latitude, res.Err)
+		return
+	}
+
+	st := e.transit(latitude, res.Trace)
+	if !res.Adjust {
+		return
+	}
+	for _, adj := range res.Adjustments {
+		e.apply(ctx, seq, adj, latitude, metrics, res.Trace, st)
+	}
+}
+
+// apply the adjustment decided for the trigger latitude with the sequence
+// seq, the adjustment is dropped if a later decision is applied to the
+// adjusted latitude.
+func (e *Executor) apply(ctx context.Context, seq uint64, adj Adjustment, latitude string,
+	metrics engine.Metrics, trace *engine.Trace, st transition) {
+	unlock := e.lock(adj.Latitude)
+	defer unlock()
+
+	if !adj.Shadow {
+		if e.stale(adj.Latitude, seq) {
+			e.lg.Debugf("judge request rate stale", log.Field{
+				Key:   "latitude",
+				Value: adj.Latitude,
+			}, log.Field{
+				Key:   "trigger_latitude",
+				Value: latitude,
+			})
+			return
+		}
+
+		e.amu.Lock()
+		e.desired[adj.Latitude] = uint64(adj.Rate)
+		e.amu.Unlock()
+	}
+
+	if e.pinned(ctx, adj.Latitude) {
+		// the decision is applied when the pin is lifted.
+		e.amu.Lock()
+		e.suppressed[adj.Latitude] = struct{}{}
+		e.amu.Unlock()
+		e.lg.Infof("judge request rate suppressed by pin", log.Field{
+			Key:   "latitude",
+			Value: adj.Latitude,
+		}, log.Field{
+			Key:   "trigger_latitude",
+			Value: latitude,
+		})
+		return
+	}
+
+	if adj.Shadow {
+		e.recordShadow(adj, latitude, trace)
+		e.audit(ctx, adj, latitude, metrics, trace, st, nil)
+		return
+	}
+
+	ctx2, cancel2 := context.WithTimeout(ctx, 2*time.Second)
+	err := e.cf.Set(ctx2, adj.Latitude, uint64(adj.Rate))
+	cancel2()
+	if err != nil {
+		e.lg.Errorf("set request rate error", log.Field{
+			Key:   "latitude",
+			Value: adj.Latitude,
+		}, log.Field{
+			Key:   "error",
+			Value: err.Error(),
+		})
+		e.handleError(adj.Latitude, err)
+		e.audit(ctx, adj, latitude, metrics, trace, st, err)
+		return
+	}
+
+	e.audit(ctx, adj, latitude, metrics, trace, st, nil)
+	e.lg.Infof("judge request rate adjusted", append([]log.Field{{
+		Key:   "latitude",
+		Value: adj.Latitude,
+	}, {
+		Key:   "trigger_latitude",
+		Value: latitude,
+	}, {
+		Key:   "priority",
+		Value: adj.Priority,
+	}, {
+		Key:   "rate",
+		Value: adj.Rate,
+	}}, traceFields(trace)...)...)
+}
+
+func (e *Executor) handleError(latitude string, err error) {
+	if e.onError != nil {
+		e.onError(latitude, err)
+	}
+}
+
+// recordShadow record the adjustment of the rule in shadow mode, the rate
+// is never modified.
+func (e *Executor) recordShadow(adj Adjustment, latitude string, trace *engine.Trace) {
+	if e.shadow != nil {
+		e.shadow.Record(adj.Latitude, adj.Shed)
+	}
+
+	e.lg.Infof("judge request rate would adjust in shadow mode", append([]log.Field{{
+		Key:   "latitude",
+		Value: adj.Latitude,
+	}, {
+		Key:   "trigger_latitude",
+		Value: latitude,
+	}, {
+		Key:   "priority",
+		Value: adj.Priority,
+	}, {
+		Key:   "rate",
+		Value: adj.Rate,
+	}, {
+		Key:   "mode",
+		Value: engine.ModeShadow,
+	}}, traceFields(trace)...)...)
+}
+
+// transition the status of trigger latitude changed by a decision.
+type transition struct {
+	from, to engine.CircuitState
+}
+
+// transit move the LimitStatus of trigger latitude by the trigger result,
+// the latitude without trigger never fires.
+func (e *Executor) transit(latitude string, trace *engine.Trace) transition {
+	e.amu.Lock()
+	defer e.amu.Unlock()
+
+	ls, ok := e.statuses[latitude]
+	if !ok {
+		ls = engine.NewLimitStatus(e.rollback, e.steps)
+		e.statuses[latitude] = ls
+	}
+	st := transition{from: ls.State()}
+	ls.Transit(trace != nil && trace.Result, e.clock.Now())
+	st.to = ls.State()
+
+	return st
+}
+
+// audit record the decision of adjustment to the auditors with the status
+// transition of trigger latitude, the rate of latitude is updated if the
+// adjustment is applied.
+func (e *Executor) audit(ctx context.Context, adj Adjustment, latitude string,
+	metrics engine.Metrics, trace *engine.Trace, st transition, err error) {
+	newRate := uint64(adj.Rate)
+
+	e.amu.Lock()
+	oldRate := e.rates[adj.Latitude]
+	if err == nil && !adj.Shadow {
+		e.rates[adj.Latitude] = newRate
+	}
+	e.amu.Unlock()
+
+	if len(e.auditors) == 0 {
+		return
+	}
+
+	r := AuditRecord{
+		Timestamp:       e.clock.Now(),
+		Latitude:        adj.Latitude,
+		TriggerLatitude: latitude,
+		Priority:        adj.Priority,
+		Metrics:         metrics,
+		Trace:           trace,
+		OldRate:         oldRate,
+		NewRate:         newRate,
+		From:            st.from,
+		To:              st.to,
+		Shadow:          adj.Shadow,
+		Node:            e.node,
+	}
+	if err != nil {
+		r.Err = err.Error()
+	}
+
+	// the auditing is best effort, the failure never blocks adjusting.
+	var errs []error
+	for _, a := range e.auditors {
+		ctx1, cancel := context.WithTimeout(ctx, 2*time.Second)
+		errs = append(errs, a.Record(ctx1, r))
+		cancel()
+	}
+	if err = errors.Join(errs...); err != nil {
+		e.lg.Warnf("record audit error", log.Field{
+			Key:   "latitude",
+			Value: adj.Latitude,
+		}, log.Field{
+			Key:   "error",
+			Value: err.Error(),
+		})
+	}
+}
+
+// traceFields convert the evaluated trigger tree to log fields, the fired
+// conditions are listed separately for quick reading.
+func traceFields(trace *engine.Trace) []log.Field {
+	if trace == nil || trace.Expr == "" {
+		return nil
+	}
+
+	fired := trace.Fired()
+	conditions := make([]string, 0, len(fired))
+	for _, c := range fired {
+		conditions = append(conditions, c.String())
+	}
+
+	return []log.Field{
+		{Key: "trigger", Value: trace.Expr},
+		{Key: "trigger_result", Value: trace.Result},
+		{Key: "trigger_trace", Value: trace.String()},
+		{Key: "fired_conditions", Value: conditions},
+	}
 }
 
+// Close stop the running controller, it can be called more than once.
 func (e *Executor) Close() error {
-	close(e.closeCh)
+	e.once.Do(func() {
+		close(e.closeCh)
+	})
 	return nil
 }
@@ -13,3 +13,629 @@
 // limitations under the License.
 
 package distributed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+	"github.com/TimeWtr/gox/limiter/distributed/engine"
+	"github.com/TimeWtr/gox/log"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// memConf the in memory Configuration for tests.
+type memConf struct {
+	rates map[string]uint64
+	mu    sync.Mutex
+}
+
+func newMemConf() *memConf {
+	return &memConf{rates: map[string]uint64{}}
+}
+
+func (m *memConf) Set(_ context.Context, latitude string, rate uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rates[latitude] = rate
+	return nil
+}
+
+func (m *memConf) Del(_ context.Context, latitude string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.rates, latitude)
+	return nil
+}
+
+func (m *memConf) Get(latitude string) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.rates[latitude]
+}
+
+func TestExecutor_DynamicController_Clock(t *testing.T) {
+	fs := engine.NewFileSource("./engine/examples/rule.json", engine.DataTypeJson)
+	p, err := engine.NewParser(fs)
+	require.NoError(t, err)
+	bs, err := NewBS(p)
+	require.NoError(t, err)
+
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	cf := newMemConf()
+	e := NewExecutor(cf, bs, WithClock(c), WithLogger(log.NewNopLogger()))
+	defer e.Close()
+	require.NoError(t, e.Register(context.Background(), "order_service", 1000, 1))
+	ch, err := e.Notify(context.Background(), "order_service")
+	require.NoError(t, err)
+
+	go func() {
+		_ = e.DynamicController(time.Second)
+	}()
+	c.BlockUntil(1)
+
+	ch <- engine.Metrics{CPUUsage: 0.9, MemUsage: 0.5}
+	assert.Never(t, func() bool {
+		return cf.Get("/api/v1/order") != 0
+	}, 50*time.Millisecond, 5*time.Millisecond)
+
+	// the metrics are consumed at the next tick.
+	c.Advance(time.Second)
+	assert.Eventually(t, func() bool {
+		return cf.Get("/api/v1/order") == 100 && cf.Get("/api/v1/user") == 100
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(1000), cf.Get("order_service"))
+}
+
+// TestExecutor_DynamicController_Interval run with -race, the interval of
+// DynamicController is not shared with Run.
+func TestExecutor_DynamicController_Interval(t *testing.T) {
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	e := NewExecutor(newMemConf(), newStubStrategy(), WithClock(c), WithClock(nil),
+		WithInterval(time.Minute), WithLogger(log.NewNopLogger()))
+
+	done := make(chan error, 2)
+	go func() {
+		done <- e.DynamicController(time.Second)
+	}()
+	go func() {
+		done <- e.Run(context.Background())
+	}()
+	c.BlockUntil(2)
+	assert.Equal(t, time.Minute, e.(*Executor).interval)
+
+	assert.NoError(t, e.Close())
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-done)
+}
+
+// stubStrategy record the metrics received, and block the adjusting until
+// release is closed if set.
+type stubStrategy struct {
+	mu       sync.Mutex
+	received map[string][]engine.Metrics
+	running  atomic.Int64
+	peak     atomic.Int64
+	release  chan struct{}
+	err      error
+}
+
+func newStubStrategy() *stubStrategy {
+	return &stubStrategy{received: map[string][]engine.Metrics{}}
+}
+
+func (s *stubStrategy) AdjustRate(ctx context.Context, latitude string, metrics engine.Metrics) Value {
+	n := s.running.Add(1)
+	defer s.running.Add(-1)
+	for p := s.peak.Load(); n > p && !s.peak.CompareAndSwap(p, n); p = s.peak.Load() {
+	}
+
+	s.mu.Lock()
+	s.received[latitude] = append(s.received[latitude], metrics)
+	s.mu.Unlock()
+
+	if s.release != nil {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return Value{Err: ctx.Err()}
+		}
+	}
+	if s.err != nil {
+		return Value{Err: s.err}
+	}
+
+	return Value{Adjust: true, Adjustments: []Adjustment{{Latitude: latitude, Rate: metrics.CPUUsage * 100}}}
+}
+
+func (s *stubStrategy) get(latitude string) []engine.Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.received[latitude]
+}
+
+func (s *stubStrategy) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for _, ms := range s.received {
+		n += len(ms)
+	}
+	return n
+}
+
+// assertNoLeak wait for the goroutines to exit, assert.Eventually is not
+// used since it runs the condition in a new goroutine.
+func assertNoLeak(t *testing.T, goroutines int) {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if runtime.NumGoroutine() <= goroutines {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("goroutines leak, want %d, got %d", goroutines, runtime.NumGoroutine())
+}
+
+// runExecutor run the executor in background and return the result.
+func runExecutor(ctx context.Context, e EI) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- e.Run(ctx)
+	}()
+	return done
+}
+
+func TestExecutor_Run_Close(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	stg := newStubStrategy()
+	stg.release = make(chan struct{})
+	e := NewExecutor(newMemConf(), stg, WithClock(c), WithLogger(log.NewNopLogger()))
+	require.NoError(t, e.Register(context.Background(), "order_service", 1000, 1))
+	ch, err := e.Notify(context.Background(), "order_service")
+	require.NoError(t, err)
+
+	done := runExecutor(context.Background(), e)
+	c.BlockUntil(1)
+	ch <- engine.Metrics{CPUUsage: 0.9}
+	c.Advance(time.Second)
+	assert.Eventually(t, func() bool {
+		return stg.running.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	// the adjusting in flight is aborted, and the workers exit.
+	assert.NoError(t, e.Close())
+	assert.NoError(t, e.Close())
+	select {
+	case err = <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("run not exit after closed")
+	}
+	assertNoLeak(t, goroutines)
+
+	// the closed executor exits at once.
+	assert.NoError(t, <-runExecutor(context.Background(), e))
+}
+
+func TestExecutor_Run_Context(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	e := NewExecutor(newMemConf(), newStubStrategy(), WithLogger(log.NewNopLogger()))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := runExecutor(ctx, e)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assertNoLeak(t, goroutines)
+}
+
+func TestExecutor_Run_Coalesce(t *testing.T) {
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	stg := newStubStrategy()
+	cf := newMemConf()
+	e := NewExecutor(cf, stg, WithClock(c), WithLogger(log.NewNopLogger()))
+	defer e.Close()
+	require.NoError(t, e.Register(context.Background(), "order_service", 1000, 3))
+	ch, err := e.Notify(context.Background(), "order_service")
+	require.NoError(t, err)
+
+	runExecutor(context.Background(), e)
+	c.BlockUntil(1)
+	for _, cpu := range []float64{0.5, 0.6, 0.7} {
+		ch <- engine.Metrics{CPUUsage: cpu}
+	}
+	c.Advance(time.Second)
+
+	// only the latest metrics is adjusted.
+	assert.Eventually(t, func() bool {
+		return cf.Get("order_service") == 70
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []engine.Metrics{{CPUUsage: 0.7}}, stg.get("order_service"))
+}
+
+func TestExecutor_Run_Workers(t *testing.T) {
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	stg := newStubStrategy()
+	stg.release = make(chan struct{})
+	var (
+		mu   sync.Mutex
+		errs = map[string]error{}
+	)
+	e := NewExecutor(newMemConf(), stg, WithClock(c), WithWorkers(2), WithLogger(log.NewNopLogger()),
+		WithErrorHandler(func(latitude string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs[latitude] = err
+		}))
+	defer e.Close()
+
+	var chs []chan<- engine.Metrics
+	for i := 0; i < 5; i++ {
+		latitude := fmt.Sprintf("service_%d", i)
+		require.NoError(t, e.Register(context.Background(), latitude, 1000, 1))
+		ch, err := e.Notify(context.Background(), latitude)
+		require.NoError(t, err)
+		chs = append(chs, ch)
+	}
+
+	runExecutor(context.Background(), e)
+	c.BlockUntil(1)
+	for _, ch := range chs {
+		ch <- engine.Metrics{CPUUsage: 0.9}
+	}
+	c.Advance(time.Second)
+
+	// at most 2 latitudes are adjusted at a time.
+	assert.Eventually(t, func() bool {
+		return stg.running.Load() == 2
+	}, time.Second, time.Millisecond)
+	assert.Never(t, func() bool {
+		return stg.count() > 2
+	}, 20*time.Millisecond, time.Millisecond)
+
+	// the rest are adjusted when the workers are free.
+	stg.err = errors.New("judge failed")
+	close(stg.release)
+	assert.Eventually(t, func() bool {
+		return stg.count() == 5
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int64(2), stg.peak.Load())
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(errs) == 5
+	}, time.Second, time.Millisecond)
+}
+
+// fanStrategy adjust the latitude "shared" to the rate of the trigger
+// latitude, the adjusting of the trigger latitude blocks until its channel
+// in wait is closed if set.
+type fanStrategy struct {
+	rates map[string]float64
+	wait  map[string]chan struct{}
+}
+
+func (s *fanStrategy) AdjustRate(_ context.Context, latitude string, _ engine.Metrics) Value {
+	if ch, ok := s.wait[latitude]; ok {
+		<-ch
+	}
+
+	return Value{Adjust: true, Adjustments: []Adjustment{{Latitude: "shared", Rate: s.rates[latitude]}}}
+}
+
+// seqConf record the rates set in order and the peak of the concurrent
+// setting, the setting of rate blocks until release is closed.
+type seqConf struct {
+	*memConf
+	rate    uint64
+	release chan struct{}
+	running atomic.Int64
+	peak    atomic.Int64
+	setting chan uint64
+}
+
+func (c *seqConf) Set(ctx context.Context, latitude string, rate uint64) error {
+	n := c.running.Add(1)
+	defer c.running.Add(-1)
+	for p := c.peak.Load(); n > p && !c.peak.CompareAndSwap(p, n); p = c.peak.Load() {
+	}
+
+	c.setting <- rate
+	if rate == c.rate {
+		<-c.release
+	}
+	return c.memConf.Set(ctx, latitude, rate)
+}
+
+func TestExecutor_Adjust_Serialize(t *testing.T) {
+	ctx := context.Background()
+	cf := &seqConf{memConf: newMemConf(), rate: 10, release: make(chan struct{}), setting: make(chan uint64, 2)}
+	stg := &fanStrategy{rates: map[string]float64{"a": 10, "b": 20}}
+	e := NewExecutor(cf, stg, WithLogger(log.NewNopLogger())).(*Executor)
+	defer e.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		e.adjust(ctx, "a", engine.Metrics{})
+	}()
+	assert.Equal(t, uint64(10), <-cf.setting)
+	go func() {
+		defer wg.Done()
+		e.adjust(ctx, "b", engine.Metrics{})
+	}()
+	// the rate decided later is set after the earlier one.
+	assert.Never(t, func() bool {
+		return len(cf.setting) > 0
+	}, 50*time.Millisecond, 5*time.Millisecond)
+	close(cf.release)
+	wg.Wait()
+	assert.Equal(t, uint64(20), <-cf.setting)
+	assert.Equal(t, int64(1), cf.peak.Load())
+	assert.Equal(t, uint64(20), cf.Get("shared"))
+}
+
+func TestExecutor_Adjust_Stale(t *testing.T) {
+	ctx := context.Background()
+	cf := newMemConf()
+	stg := &fanStrategy{
+		rates: map[string]float64{"a": 10, "b": 20},
+		wait:  map[string]chan struct{}{"a": make(chan struct{})},
+	}
+	e := NewExecutor(cf, stg, WithLogger(log.NewNopLogger())).(*Executor)
+	defer e.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.adjust(ctx, "a", engine.Metrics{})
+	}()
+	// the decision of a is made before b, but finished after b.
+	assert.Eventually(t, func() bool {
+		e.amu.Lock()
+		defer e.amu.Unlock()
+		return e.seq == 1
+	}, time.Second, time.Millisecond)
+	e.adjust(ctx, "b", engine.Metrics{})
+	assert.Equal(t, uint64(20), cf.Get("shared"))
+
+	close(stg.wait["a"])
+	<-done
+	assert.Equal(t, uint64(20), cf.Get("shared"))
+	e.amu.Lock()
+	assert.Equal(t, uint64(20), e.desired["shared"])
+	e.amu.Unlock()
+}
+
+// pinConf the in memory PinConfiguration shared by the nodes.
+type pinConf struct {
+	*memConf
+	pins map[string]Pin
+	err  error
+}
+
+func (p *pinConf) SetPin(_ context.Context, latitude string, pin Pin, _ time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pins[latitude] = pin
+	return nil
+}
+
+func (p *pinConf) GetPin(_ context.Context, latitude string) (Pin, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return Pin{}, false, p.err
+	}
+	pin, ok := p.pins[latitude]
+	return pin, ok, nil
+}
+
+func (p *pinConf) setErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.err = err
+}
+
+func TestExecutor_Override(t *testing.T) {
+	ctx := context.Background()
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	cf := newMemConf()
+	e := NewExecutor(cf, newStubStrategy(), WithClock(c), WithLogger(log.NewNopLogger())).(*Executor)
+	defer e.Close()
+	require.NoError(t, e.Register(ctx, "order", 1000, 1))
+
+	assert.ErrorIs(t, e.Override(ctx, "order", 10, 0), errorx.ErrInvalidPin)
+	require.NoError(t, e.Override(ctx, "order", 2000, time.Minute))
+	assert.Equal(t, uint64(2000), cf.Get("order"))
+
+	// the decisions are suppressed.
+	e.adjust(ctx, "order", engine.Metrics{CPUUsage: 0.5})
+	assert.Equal(t, uint64(2000), cf.Get("order"))
+
+	// the override is extended, the rate decided meanwhile is applied.
+	require.NoError(t, e.Override(ctx, "order", 3000, 2*time.Minute))
+	c.Advance(time.Minute)
+	e.expire(ctx)
+	assert.Equal(t, uint64(3000), cf.Get("order"))
+
+	c.Advance(time.Minute)
+	e.expire(ctx)
+	assert.Equal(t, uint64(50), cf.Get("order"))
+	e.adjust(ctx, "order", engine.Metrics{CPUUsage: 0.6})
+	assert.Equal(t, uint64(60), cf.Get("order"))
+
+	// the registered rate is applied if never adjusted.
+	require.NoError(t, e.Register(ctx, "user", 1000, 1))
+	require.NoError(t, e.Override(ctx, "user", 10, time.Minute))
+	require.NoError(t, e.Override(ctx, "user", 20, time.Minute))
+	c.Advance(time.Minute)
+	e.expire(ctx)
+	assert.Equal(t, uint64(1000), cf.Get("user"))
+}
+
+func TestExecutor_Freeze(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewFake(now)
+	cf := &pinConf{memConf: newMemConf(), pins: map[string]Pin{}}
+	e := NewExecutor(cf, newStubStrategy(), WithClock(c), WithLogger(log.NewNopLogger())).(*Executor)
+	defer e.Close()
+	// the other node shares the configuration center.
+	other := NewExecutor(cf, newStubStrategy(), WithClock(c), WithLogger(log.NewNopLogger())).(*Executor)
+	defer other.Close()
+	require.NoError(t, e.Register(ctx, "order", 1000, 1))
+
+	assert.ErrorIs(t, e.Freeze(ctx, "order", now), errorx.ErrInvalidPin)
+	require.NoError(t, e.Freeze(ctx, "order", now.Add(time.Minute)))
+	assert.Equal(t, uint64(1000), cf.Get("order"))
+
+	e.adjust(ctx, "order", engine.Metrics{CPUUsage: 0.5})
+	other.adjust(ctx, "order", engine.Metrics{CPUUsage: 0.5})
+	assert.Equal(t, uint64(1000), cf.Get("order"))
+	// the other latitudes are not frozen.
+	e.adjust(ctx, "user", engine.Metrics{CPUUsage: 0.5})
+	assert.Equal(t, uint64(50), cf.Get("user"))
+
+	// the latest decision is applied when expired.
+	c.Advance(time.Minute)
+	e.expire(ctx)
+	assert.Equal(t, uint64(50), cf.Get("order"))
+	other.adjust(ctx, "order", engine.Metrics{CPUUsage: 0.6})
+	assert.Equal(t, uint64(60), cf.Get("order"))
+}
+
+// TestExecutor_Pin_Error the decisions are suppressed if failed to get the
+// pin, and applied once the pin is known.
+func TestExecutor_Pin_Error(t *testing.T) {
+	ctx := context.Background()
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	cf := &pinConf{memConf: newMemConf(), pins: map[string]Pin{}}
+	e := NewExecutor(cf, newStubStrategy(), WithClock(c), WithLogger(log.NewNopLogger())).(*Executor)
+	defer e.Close()
+	require.NoError(t, e.Register(ctx, "order", 1000, 1))
+
+	cf.setErr(errors.New("unavailable"))
+	e.adjust(ctx, "order", engine.Metrics{CPUUsage: 0.5})
+	assert.Equal(t, uint64(1000), cf.Get("order"))
+	e.expire(ctx)
+	assert.Equal(t, uint64(1000), cf.Get("order"))
+
+	cf.setErr(nil)
+	e.expire(ctx)
+	assert.Equal(t, uint64(50), cf.Get("order"))
+}
+
+// pinStub the redis client records the arguments of setting the pins.
+type pinStub struct {
+	redis.Cmdable
+	args []redis.SetArgs
+}
+
+func (s *pinStub) SetArgs(_ context.Context, _ string, _ any, a redis.SetArgs) *redis.StatusCmd {
+	s.args = append(s.args, a)
+	return redis.NewStatusResult("OK", nil)
+}
+
+// TestConf_SetPin the ttl of the pins is measured by the clock of the
+// Executor, the fake clock is far behind the wall clock.
+func TestConf_SetPin(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewFake(now)
+
+	rc := &pinStub{}
+	e := NewExecutor(NewRedisConfiguration(rc, "metadata"), newStubStrategy(), WithClock(c),
+		WithLogger(log.NewNopLogger()))
+	defer e.Close()
+	require.NoError(t, e.Freeze(ctx, "order", now.Add(90*time.Second)))
+	require.NoError(t, e.Freeze(ctx, "user", now.Add(1500*time.Microsecond)))
+	require.Len(t, rc.args, 2)
+	assert.Equal(t, 90*time.Second, rc.args[0].TTL)
+	assert.Equal(t, 2*time.Millisecond, rc.args[1].TTL)
+	assert.True(t, rc.args[0].ExpireAt.IsZero())
+
+	kv, lease := &kvStub{puts: map[string]string{}}, &leaseStub{}
+	e = NewExecutor(NewEtcdConfiguration(&clientv3.Client{KV: kv, Lease: lease}), newStubStrategy(),
+		WithClock(c), WithLogger(log.NewNopLogger()))
+	defer e.Close()
+	require.NoError(t, e.Freeze(ctx, "order", now.Add(90*time.Second)))
+	assert.Equal(t, int64(90), lease.ttl)
+	require.NoError(t, e.Override(ctx, "user", 10, 1500*time.Millisecond))
+	assert.Equal(t, int64(2), lease.ttl)
+	assert.Contains(t, kv.puts, DefaultPinPrefix+"/order")
+}
+
+// TestExecutor_Freeze_Trigger the pin expires while the trigger keeps
+// firing, the latitude is shed once the pin is lifted, and restored with
+// the others when the trigger recovers.
+func TestExecutor_Freeze_Trigger(t *testing.T) {
+	fs := engine.NewFileSource("./engine/examples/rule.json", engine.DataTypeJson)
+	p, err := engine.NewParser(fs)
+	require.NoError(t, err)
+	bs, err := NewBS(p)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewFake(now)
+	cf := &pinConf{memConf: newMemConf(), pins: map[string]Pin{}}
+	e := NewExecutor(cf, bs, WithClock(c), WithLogger(log.NewNopLogger())).(*Executor)
+	defer e.Close()
+	// the other node suppresses the decisions by the shared pin.
+	other := NewExecutor(cf, newStubStrategy(), WithClock(c), WithLogger(log.NewNopLogger())).(*Executor)
+	defer other.Close()
+	require.NoError(t, e.Register(ctx, "/api/v1/order", 500, 1))
+	require.NoError(t, e.Register(ctx, "/api/v1/user", 300, 1))
+	require.NoError(t, e.Freeze(ctx, "/api/v1/order", now.Add(1500*time.Millisecond)))
+
+	high, low := engine.Metrics{CPUUsage: 0.9}, engine.Metrics{CPUUsage: 0.1}
+	e.adjust(ctx, "order_service", high)
+	other.adjust(ctx, "/api/v1/order", high)
+	assert.Equal(t, uint64(500), cf.Get("/api/v1/order"))
+	assert.Equal(t, uint64(100), cf.Get("/api/v1/user"))
+
+	for i := 1; i <= 5; i++ {
+		c.Advance(time.Second)
+		e.expire(ctx)
+		e.adjust(ctx, "order_service", high)
+		want := uint64(100)
+		if i == 1 {
+			want = 500
+		}
+		assert.Equal(t, want, cf.Get("/api/v1/order"), "t=%ds", i)
+	}
+	assert.Equal(t, uint64(100), cf.Get("/api/v1/user"))
+
+	// the decision of the other node is applied when the shared pin expires.
+	other.expire(ctx)
+	assert.Equal(t, uint64(90), cf.Get("/api/v1/order"))
+
+	for i := 0; i < 2; i++ {
+		c.Advance(time.Second)
+		e.adjust(ctx, "order_service", low)
+	}
+	assert.Equal(t, uint64(500), cf.Get("/api/v1/order"))
+	assert.Equal(t, uint64(300), cf.Get("/api/v1/user"))
+}
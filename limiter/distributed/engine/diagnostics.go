@@ -0,0 +1,197 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SyntaxError the structured error of lexing or parsing trigger expression,
+// it carries the position of the offending token, the expected token set and
+// the suggestions for misspelled words.
+type SyntaxError struct {
+	// the whole trigger expression.
+	Trigger string
+	// byte offset of the offending token in Trigger.
+	Offset int
+	// line number, starts from 1.
+	Line int
+	// column number in bytes, starts from 1.
+	Column int
+	// the short description of the error.
+	Msg string
+	// the text of the offending token, empty if reached the end of input.
+	Found string
+	// the expected token set at Offset.
+	Expected []string
+	// the candidates for the misspelled word, such as metrics name.
+	Suggestions []string
+}
+
+func newSyntaxError(trigger string, offset int, msg string) *SyntaxError {
+	line, column := position(trigger, offset)
+	return &SyntaxError{
+		Trigger: trigger,
+		Offset:  offset,
+		Line:    line,
+		Column:  column,
+		Msg:     msg,
+	}
+}
+
+func (e *SyntaxError) Error() string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "line %d, column %d: %s", e.Line, e.Column, e.Msg)
+	if len(e.Expected) > 0 {
+		_, _ = fmt.Fprintf(&sb, ", expected %s", strings.Join(e.Expected, ", "))
+	}
+	if len(e.Suggestions) > 0 {
+		_, _ = fmt.Fprintf(&sb, " (did you mean %s?)", quoteJoin(e.Suggestions, " or "))
+	}
+
+	if snippet := e.Snippet(); snippet != "" {
+		sb.WriteString("\n")
+		sb.WriteString(snippet)
+	}
+
+	return sb.String()
+}
+
+// Snippet return the offending line of trigger and a caret under the error column.
+func (e *SyntaxError) Snippet() string {
+	if e.Trigger == "" {
+		return ""
+	}
+
+	lines := strings.Split(e.Trigger, "\n")
+	if e.Line < 1 || e.Line > len(lines) {
+		return ""
+	}
+
+	line := lines[e.Line-1]
+	var caret strings.Builder
+	for i := 0; i < e.Column-1 && i < len(line); i++ {
+		// keep tab width the same as the source line.
+		if line[i] == '\t' {
+			caret.WriteByte('\t')
+			continue
+		}
+		caret.WriteByte(' ')
+	}
+	caret.WriteByte('^')
+
+	return "    " + line + "\n    " + caret.String()
+}
+
+// position convert the byte offset to line and column, both start from 1.
+func position(content string, offset int) (line, column int) {
+	if offset > len(content) {
+		offset = len(content)
+	}
+
+	line = 1 + strings.Count(content[:offset], "\n")
+	column = offset + 1
+	if i := strings.LastIndexByte(content[:offset], '\n'); i >= 0 {
+		column = offset - i
+	}
+
+	return line, column
+}
+
+// suggest return the candidates close to word sorted by edit distance,
+// the max distance allowed is one third of the word length and at least 1.
+func suggest(word string, candidates []string) []string {
+	if word == "" {
+		return nil
+	}
+
+	maxDistance := len(word) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	type candidate struct {
+		value    string
+		distance int
+	}
+
+	var res []candidate
+	lower := strings.ToLower(word)
+	for _, c := range candidates {
+		d := levenshtein(lower, strings.ToLower(c))
+		if d <= maxDistance {
+			res = append(res, candidate{value: c, distance: d})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].distance != res[j].distance {
+			return res[i].distance < res[j].distance
+		}
+		return res[i].value < res[j].value
+	})
+
+	suggestions := make([]string, 0, len(res))
+	for _, c := range res {
+		suggestions = append(suggestions, c.value)
+	}
+
+	return suggestions
+}
+
+// levenshtein calculate the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// metricNames return the sorted supported metrics names.
+func metricNames() []string {
+	names := make([]string, 0, len(metricsMap))
+	for name := range metricsMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func quoteJoin(values []string, sep string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", v))
+	}
+
+	return strings.Join(quoted, sep)
+}
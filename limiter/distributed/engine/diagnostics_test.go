@@ -0,0 +1,169 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTrigger_SyntaxError(t *testing.T) {
+	testCases := []struct {
+		name            string
+		trigger         string
+		wantOffset      int
+		wantLine        int
+		wantColumn      int
+		wantExpected    []string
+		wantSuggestions []string
+	}{
+		{
+			name:            "misspelled metrics",
+			trigger:         "cpu_usag > 0.8",
+			wantOffset:      0,
+			wantLine:        1,
+			wantColumn:      1,
+			wantExpected:    metricNames(),
+			wantSuggestions: []string{"cpu_usage"},
+		},
+		{
+			name:         "missing operator",
+			trigger:      "cpu_usage 0.8",
+			wantOffset:   10,
+			wantLine:     1,
+			wantColumn:   11,
+			wantExpected: []string{">", ">=", "<", "<=", "="},
+		},
+		{
+			name:         "missing number",
+			trigger:      "cpu_usage > OR",
+			wantOffset:   12,
+			wantLine:     1,
+			wantColumn:   13,
+			wantExpected: []string{"number"},
+		},
+		{
+			name:         "unclosed paren",
+			trigger:      "(cpu_usage > 0.8",
+			wantOffset:   16,
+			wantLine:     1,
+			wantColumn:   17,
+			wantExpected: []string{"')'", "AND", "OR"},
+		},
+		{
+			name:            "misspelled logical operator",
+			trigger:         "cpu_usage > 0.8 ANDD mem_usage > 0.8",
+			wantOffset:      16,
+			wantLine:        1,
+			wantColumn:      17,
+			wantExpected:    []string{"AND", "OR", "end of input"},
+			wantSuggestions: []string{"AND"},
+		},
+		{
+			name:            "multi lines",
+			trigger:         "cpu_usage > 0.8\nOR mem_usge > 0.8",
+			wantOffset:      19,
+			wantLine:        2,
+			wantColumn:      4,
+			wantExpected:    metricNames(),
+			wantSuggestions: []string{"mem_usage", "mem_used"},
+		},
+		{
+			name:         "empty trigger",
+			trigger:      "",
+			wantOffset:   0,
+			wantLine:     1,
+			wantColumn:   1,
+			wantExpected: []string{"metrics field", "'('"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseTrigger(tc.trigger)
+			var se *SyntaxError
+			assert.True(t, errors.As(err, &se))
+			assert.Equal(t, tc.wantOffset, se.Offset)
+			assert.Equal(t, tc.wantLine, se.Line)
+			assert.Equal(t, tc.wantColumn, se.Column)
+			assert.Equal(t, tc.wantExpected, se.Expected)
+			assert.Equal(t, tc.wantSuggestions, se.Suggestions)
+			t.Logf("error: %s", err)
+		})
+	}
+}
+
+func TestSyntaxError_Snippet(t *testing.T) {
+	_, err := parseTrigger("cpu_usage > 0.8 OR mem_usag > 0.8")
+	var se *SyntaxError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, "    cpu_usage > 0.8 OR mem_usag > 0.8\n"+
+		"                       ^", se.Snippet())
+}
+
+func TestConf_Check_AllErrors(t *testing.T) {
+	cfg := Conf{
+		RedisCluster: RedisCluster{Addr: []string{"127.0.0.1:6379"}},
+		Rules: Rule{
+			BaseThreshold: 1000,
+			Children: []Rule{
+				{
+					Scope:         Scope{Type: ScopeTypeService, Value: "order_service"},
+					BaseThreshold: 1000,
+					Strategy:      StrategyQPS,
+					Period:        "1s",
+					Priority:      PriorityTypeHigh,
+					Trigger:       "cpu_usage > 0.8",
+				},
+				{
+					Scope:         Scope{Type: ScopeTypeService, Value: "user_service"},
+					BaseThreshold: 1000,
+					Strategy:      "qpss",
+					Period:        "1s",
+					Priority:      PriorityTypeHigh,
+					Trigger:       "cpu_usag > 0.8",
+					Children: []Rule{
+						{
+							Scope:         Scope{Type: ScopeTypeAPI, Value: "/api/v1/user"},
+							BaseThreshold: 100,
+							Strategy:      StrategyQPS,
+							Period:        "1x",
+							Priority:      PriorityTypeLow,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	err := cfg.Check()
+	var errs CheckErrors
+	assert.True(t, errors.As(err, &errs))
+	paths := make([]string, 0, len(errs))
+	for _, e := range errs {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{
+		"rules.children[1].strategy",
+		"rules.children[1].trigger",
+		"rules.children[1].children[0].period",
+	}, paths)
+
+	var se *SyntaxError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, []string{"cpu_usage"}, se.Suggestions)
+}
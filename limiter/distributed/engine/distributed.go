@@ -16,10 +16,16 @@ package engine
 
 import (
 	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
 	"github.com/TimeWtr/gox/limiter"
 
 	"github.com/redis/go-redis/v9"
@@ -38,13 +44,16 @@ func (a *AlgorithmType) String() string {
 	return string(*a)
 }
 
+// Valid check the algorithm type, the latitude is the scope type of rule,
+// the per entity scopes, such as user, ip, tenant and header, require the
+// keyed algorithms.
 func (a *AlgorithmType) Valid(latitude ...string) error {
 	if *a == "" {
 		return nil
 	}
 
-	// latitude is Global，API and Service
-	if len(latitude) == 0 || (latitude[0] != ScopeTypeUser && latitude[0] != ScopeTypeIP) {
+	// latitude is Global，API, Service and the other shared scopes
+	if len(latitude) == 0 || !isPerEntity(latitude[0]) {
 		switch *a {
 		case AlgorithmTypeTokenBucket, AlgorithmTypeLeakBucket, AlgorithmTypeFixedWindow, AlgorithmTypeSlidingWindow:
 			return nil
@@ -53,37 +62,149 @@ func (a *AlgorithmType) Valid(latitude ...string) error {
 		}
 	}
 
-	// latitude is User or IP
+	// latitude is per entity scope
 	switch *a {
 	case AlgorithmTypeTokenBucket, AlgorithmTypeSlidingWindow:
 		return nil
 	default:
-		return errors.New("Latitude is User or IP, Algorithm must be one of TokenBucket, LeakBucket, FixedWindow, SlidingWindow")
+		return errors.Errorf("Latitude %s is per entity, Algorithm must be one of TokenBucket, SlidingWindow",
+			latitude[0])
 	}
 }
 
 var _ limiter.DisLimiter = (*DSlidingWindow)(nil)
 
+// DOption the optional config of distributed limiters.
+type DOption func(*DSlidingWindow)
+
+// WithDClock set the source of time of limiter, the tests can use
+// clock.Fake to advance time exactly.
+func WithDClock(c clock.Clock) DOption {
+	return func(d *DSlidingWindow) {
+		if c != nil {
+			d.clock = c
+		}
+	}
+}
+
+// WithDWindow set the window of limiter allowing rate requests per
+// interval, it is required, the limiter without window allows nothing.
+func WithDWindow(interval time.Duration, rate int64) DOption {
+	return func(d *DSlidingWindow) {
+		if interval > 0 && rate > 0 {
+			d.interval, d.rate = interval, rate
+		}
+	}
+}
+
+// WithDKeyPrefix set the prefix of the redis keys of windows.
+func WithDKeyPrefix(prefix string) DOption {
+	return func(d *DSlidingWindow) {
+		d.prefix = prefix
+	}
+}
+
+// the default prefix of the redis keys of windows.
+const defaultWindowPrefix = "gox:limiter:sliding_window:"
+
+// slidingWindowScript log the requests in the sorted set scored by the
+// time in microseconds, the requests slid out of the window are removed,
+// and n requests are logged if the window has room.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local rate = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - interval)
+if redis.call('ZCARD', KEYS[1]) + n > rate then
+	return 0
+end
+for i = 1, n do
+	redis.call('ZADD', KEYS[1], now, ARGV[5] .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], math.ceil(interval / 1000))
+return 1
+`)
+
 // DSlidingWindow distributed sliding window implement based on redis.
 // this implement supports dynamic adjustment of the limit threshold
 // and reception of the collected machine metrics. sliding window
-// does not provide collection metrics functions.
+// does not provide collection metrics functions. The requests are logged
+// in the sorted set of key by the time of limiter, so that the clocks of
+// the instances sharing the window should be synchronized.
 type DSlidingWindow struct {
 	// redis client
 	client redis.Cmdable
 	// window size
 	interval time.Duration
+	// the request count of this window allowed.
+	rate int64
+	// the prefix of redis keys.
+	prefix string
+	// the unique id of limiter and the sequence of requests, the requests
+	// logged are unique among the instances.
+	id  string
+	seq atomic.Uint64
+	// the source of time
+	clock clock.Clock
 }
 
-func NewDSlidingWindow(client redis.Cmdable) limiter.DisLimiter {
-	return &DSlidingWindow{
+func NewDSlidingWindow(client redis.Cmdable, opts ...DOption) limiter.DisLimiter {
+	d := &DSlidingWindow{
 		client: client,
+		prefix: defaultWindowPrefix,
+		id:     strconv.FormatUint(rand.Uint64(), 36),
+		clock:  clock.Real(),
+	}
+
+	for _, opt := range opts {
+		opt(d)
 	}
+
+	return d
 }
 
 func (d *DSlidingWindow) Allow(ctx context.Context, key ...string) (bool, error) {
+	return d.AllowN(ctx, 1, key...)
+}
+
+// AllowN log n requests at once in the window of key, the cost exceeds
+// the rate of window is never allowed.
+func (d *DSlidingWindow) AllowN(ctx context.Context, n int, key ...string) (bool, error) {
+	if ok, err := limiter.CheckCost(n, d.rate); ok || err != nil {
+		return ok, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+	}
+
+	member := d.id + ":" + strconv.FormatUint(d.seq.Add(1), 36)
+	res, err := slidingWindowScript.Run(ctx, d.client, []string{d.key(key)},
+		d.clock.Now().UnixMicro(), d.interval.Microseconds(), d.rate, n, member).Int()
+	if err != nil {
+		return false, err
+	}
+	if res == 0 {
+		return false, errorx.ErrOverMaxLimit
+	}
 
 	return true, nil
 }
 
+// key return the redis key of the window, the ":" and `\` in the keys are
+// escaped by `\`, so that ["a:b", "c"] and ["a", "b:c"] are different.
+func (d *DSlidingWindow) key(key []string) string {
+	escaped := make([]string, len(key))
+	for i, k := range key {
+		escaped[i] = keyEscaper.Replace(k)
+	}
+
+	return d.prefix + strings.Join(escaped, ":")
+}
+
+var keyEscaper = strings.NewReplacer(`\`, `\\`, ":", `\:`)
+
 func (d *DSlidingWindow) Close() {}
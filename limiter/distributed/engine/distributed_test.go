@@ -0,0 +1,121 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+)
+
+// windowStub the redis client runs the sliding window script on the
+// sorted sets in memory.
+type windowStub struct {
+	redis.Cmdable
+	// the scores of the requests logged by key.
+	logs map[string][]int64
+	keys []string
+	err  error
+}
+
+func (s *windowStub) EvalSha(_ context.Context, _ string, keys []string, args ...interface{}) *redis.Cmd {
+	if s.err != nil {
+		return redis.NewCmdResult(nil, s.err)
+	}
+
+	now, interval, rate, n := args[0].(int64), args[1].(int64), args[2].(int64), args[3].(int)
+	s.keys = append(s.keys, keys[0])
+	log := s.logs[keys[0]][:0]
+	for _, at := range s.logs[keys[0]] {
+		if at > now-interval {
+			log = append(log, at)
+		}
+	}
+	if int64(len(log)+n) > rate {
+		s.logs[keys[0]] = log
+		return redis.NewCmdResult(int64(0), nil)
+	}
+	for i := 0; i < n; i++ {
+		log = append(log, now)
+	}
+	s.logs[keys[0]] = log
+
+	return redis.NewCmdResult(int64(1), nil)
+}
+
+func TestDSlidingWindow_AllowN(t *testing.T) {
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	stub := &windowStub{logs: map[string][]int64{}}
+	d := NewDSlidingWindow(stub, WithDWindow(time.Second, 3), WithDClock(c))
+	defer d.Close()
+
+	ok, err := d.AllowN(context.Background(), 2, "user", "1")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	c.Advance(500 * time.Millisecond)
+	ok, err = d.Allow(context.Background(), "user", "1")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	ok, err = d.Allow(context.Background(), "user", "1")
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+
+	// the window of other key is separate.
+	ok, _ = d.Allow(context.Background(), "user:1")
+	assert.True(t, ok)
+
+	// the first requests slide out of the window.
+	c.Advance(500 * time.Millisecond)
+	ok, err = d.AllowN(context.Background(), 2, "user", "1")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+
+	_, err = d.AllowN(context.Background(), 4, "user", "1")
+	assert.Equal(t, errorx.ErrExceedCapacity, err)
+	assert.Equal(t, []string{
+		"gox:limiter:sliding_window:user:1",
+		"gox:limiter:sliding_window:user:1",
+		"gox:limiter:sliding_window:user:1",
+		`gox:limiter:sliding_window:user\:1`,
+		"gox:limiter:sliding_window:user:1",
+	}, stub.keys)
+}
+
+func TestDSlidingWindow_AllowN_Err(t *testing.T) {
+	stub := &windowStub{err: errors.New("redis down")}
+
+	// the limiter without window allows nothing.
+	_, err := NewDSlidingWindow(stub).Allow(context.Background())
+	assert.Equal(t, errorx.ErrExceedCapacity, err)
+
+	d := NewDSlidingWindow(stub, WithDWindow(time.Second, 1), WithDKeyPrefix("test:"))
+	ok, err := d.Allow(context.Background(), "order")
+	assert.False(t, ok)
+	require.Error(t, err)
+	assert.Equal(t, "redis down", err.Error())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = d.Allow(ctx)
+	assert.Equal(t, context.Canceled, err)
+}
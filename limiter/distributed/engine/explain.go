@@ -0,0 +1,207 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Trace the evaluated node of the trigger expression tree, it records the
+// result of every node and the actual value of every condition, so that
+// we can tell which part of the trigger fired.
+type Trace struct {
+	// the canonical expression of this node.
+	Expr string `json:"expr"`
+	// the node type, logical or condition.
+	Type string `json:"type"`
+	// the logical operator or the condition operator.
+	Operator string `json:"operator"`
+	// the evaluated result of this node.
+	Result bool `json:"result"`
+	// the error of evaluating this node or its children.
+	Err error `json:"-"`
+	// the error message, empty if no error.
+	Error string `json:"error,omitempty"`
+	// the metrics field, only used by condition.
+	Field string `json:"field,omitempty"`
+	// the actual metrics value, nil if the metrics is not reported,
+	// only used by condition.
+	Actual *float64 `json:"actual,omitempty"`
+	// the policy applied while the metrics is not reported, only used by condition.
+	Missing MissingPolicy `json:"missing,omitempty"`
+	// the threshold value, only used by condition.
+	Threshold float64 `json:"threshold,omitempty"`
+	// the evaluated children, only used by logical node.
+	Children []*Trace `json:"children,omitempty"`
+}
+
+func (t *Trace) setErr(err error) {
+	if err == nil {
+		return
+	}
+
+	t.Err = err
+	t.Error = err.Error()
+}
+
+// Fired return the conditions evaluated to true, they are the reason why
+// the trigger fired.
+func (t *Trace) Fired() []*Trace {
+	if t == nil {
+		return nil
+	}
+
+	if t.Type == ExprNodeCondition {
+		if t.Result {
+			return []*Trace{t}
+		}
+		return nil
+	}
+
+	var res []*Trace
+	for _, child := range t.Children {
+		res = append(res, child.Fired()...)
+	}
+
+	return res
+}
+
+// String return the one line description of the evaluated tree, such as
+// [cpu_usage > 0.8 (actual=0.93) => true] OR [mem_usage > 0.8 (actual=0.5) => false] => true
+func (t *Trace) String() string {
+	if t == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	t.format(&sb)
+	if t.Type == ExprNodeLogical {
+		_, _ = fmt.Fprintf(&sb, " => %t", t.Result)
+	}
+
+	return sb.String()
+}
+
+func (t *Trace) format(sb *strings.Builder) {
+	if t.Type == ExprNodeCondition {
+		sb.WriteString("[")
+		sb.WriteString(t.Expr)
+		switch {
+		case t.Actual != nil && t.Missing != "":
+			_, _ = fmt.Fprintf(sb, " (%s=%s)", t.Missing, formatNumber(*t.Actual))
+		case t.Actual != nil:
+			_, _ = fmt.Fprintf(sb, " (actual=%s)", formatNumber(*t.Actual))
+		case t.Missing != "" && t.Missing != MissingPolicyError:
+			_, _ = fmt.Fprintf(sb, " (missing, treat as %s)", t.Missing)
+		default:
+			sb.WriteString(" (missing)")
+		}
+		_, _ = fmt.Fprintf(sb, " => %t]", t.Result)
+		return
+	}
+
+	for i, child := range t.Children {
+		if i > 0 {
+			sb.WriteString(" ")
+			sb.WriteString(t.Operator)
+			sb.WriteString(" ")
+		}
+
+		if child.Type == ExprNodeLogical {
+			sb.WriteString("(")
+			child.format(sb)
+			_, _ = fmt.Fprintf(sb, " => %t)", child.Result)
+			continue
+		}
+		child.format(sb)
+	}
+}
+
+func (e *LogicalExpr) Explain(ctx EvalContext) *Trace {
+	left, right := e.Left.Explain(ctx), e.Right.Explain(ctx)
+	t := &Trace{
+		Expr:     FormatTrigger(e),
+		Type:     ExprNodeLogical,
+		Operator: strings.ToUpper(e.Operator),
+		Children: []*Trace{left, right},
+	}
+
+	// keep the same error as Evaluate does, the left error first.
+	if left.Err != nil {
+		t.setErr(left.Err)
+		return t
+	}
+	if right.Err != nil {
+		t.setErr(right.Err)
+		return t
+	}
+
+	switch e.Operator {
+	case LogicAnd, LogicUpperAnd:
+		t.Result = left.Result && right.Result
+	case LogicOr, LogicUpperOr:
+		t.Result = left.Result || right.Result
+	default:
+		t.setErr(fmt.Errorf("unsupported logical operator: %s", e.Operator))
+	}
+
+	return t
+}
+
+func (c *Condition) Explain(ctx EvalContext) *Trace {
+	t := &Trace{
+		Expr:      FormatTrigger(c),
+		Type:      ExprNodeCondition,
+		Operator:  c.Operator,
+		Field:     c.Field,
+		Threshold: c.Value,
+	}
+
+	actualValue, ok := ctx.metrics[c.Field]
+	if !ok {
+		t.Missing = ctx.policy
+		if t.Missing == "" {
+			t.Missing = MissingPolicyError
+		}
+
+		v, found, res, err := ctx.missing(c.Field)
+		if err != nil || !found {
+			t.Result = res
+			t.setErr(err)
+			return t
+		}
+		actualValue = v
+	}
+
+	t.Actual = &actualValue
+	res, err := c.compare(actualValue)
+	t.Result = res
+	t.setErr(err)
+
+	return t
+}
+
+// NewEvalContext create the evaluation context from the reported fields of metrics.
+func NewEvalContext(m Metrics) EvalContext {
+	values := make(map[string]float64, len(metricsMap))
+	for name := range metricsMap {
+		if v, ok := m.Get(name); ok {
+			values[name] = v
+		}
+	}
+
+	return WithEvalContext(values).WithNow(m.Timestamp)
+}
@@ -0,0 +1,106 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpr_Explain(t *testing.T) {
+	expr, err := parseTrigger("cpu_usage > 0.8 OR (mem_usage > 0.8 AND err_rate > 0.2)")
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		metrics    map[string]float64
+		wantRes    bool
+		wantErr    error
+		wantFired  []string
+		wantString string
+	}{
+		{
+			name: "cpu fired",
+			metrics: map[string]float64{
+				"cpu_usage": 0.93,
+				"mem_usage": 0.5,
+				"err_rate":  0.3,
+			},
+			wantRes:   true,
+			wantFired: []string{"cpu_usage > 0.8", "err_rate > 0.2"},
+			wantString: "[cpu_usage > 0.8 (actual=0.93) => true] OR " +
+				"([mem_usage > 0.8 (actual=0.5) => false] AND [err_rate > 0.2 (actual=0.3) => true] => false) => true",
+		},
+		{
+			name: "not fired",
+			metrics: map[string]float64{
+				"cpu_usage": 0.5,
+				"mem_usage": 0.5,
+				"err_rate":  0.1,
+			},
+			wantRes: false,
+			wantString: "[cpu_usage > 0.8 (actual=0.5) => false] OR " +
+				"([mem_usage > 0.8 (actual=0.5) => false] AND [err_rate > 0.2 (actual=0.1) => false] => false) => false",
+		},
+		{
+			name: "missing metrics",
+			metrics: map[string]float64{
+				"cpu_usage": 0.5,
+				"mem_usage": 0.9,
+			},
+			wantRes:   false,
+			wantErr:   fmt.Errorf("trigger field err_rate not exist metrics"),
+			wantFired: []string{"mem_usage > 0.8"},
+			wantString: "[cpu_usage > 0.8 (actual=0.5) => false] OR " +
+				"([mem_usage > 0.8 (actual=0.9) => true] AND [err_rate > 0.2 (missing) => false] => false) => false",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := WithEvalContext(tc.metrics)
+			trace := expr.Explain(ctx)
+			assert.Equal(t, tc.wantErr, trace.Err)
+			assert.Equal(t, tc.wantRes, trace.Result)
+			assert.Equal(t, tc.wantString, trace.String())
+
+			// the trace must be consistent with Evaluate.
+			res, err := expr.Evaluate(ctx)
+			assert.Equal(t, err, trace.Err)
+			assert.Equal(t, res, trace.Result)
+
+			var fired []string
+			for _, c := range trace.Fired() {
+				fired = append(fired, c.Expr)
+				assert.NotNil(t, c.Actual)
+			}
+			assert.Equal(t, tc.wantFired, fired)
+		})
+	}
+}
+
+func TestCondition_Explain(t *testing.T) {
+	expr, err := parseTrigger("active_conns >= 1000")
+	assert.NoError(t, err)
+
+	trace := expr.Explain(NewEvalContext(Metrics{ActiveConns: 1200}))
+	assert.True(t, trace.Result)
+	assert.Equal(t, "active_conns", trace.Field)
+	assert.Equal(t, float64(1200), *trace.Actual)
+	assert.Equal(t, float64(1000), trace.Threshold)
+	assert.Equal(t, "[active_conns >= 1000 (actual=1200) => true]", trace.String())
+}
@@ -0,0 +1,273 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ExprNodeLogical the node type of LogicalExpr in serialized ast.
+	ExprNodeLogical = "logical"
+	// ExprNodeCondition the node type of Condition in serialized ast.
+	ExprNodeCondition = "condition"
+)
+
+// FormatTrigger format the expression to the canonical trigger string,
+// the logical operators are upper case, the numbers use the shortest
+// representation and the parentheses are kept only where the precedence
+// requires them, so that parseTrigger(FormatTrigger(expr)) equals to expr.
+// The values must be non negative and finite as the lexer accepts, which
+// is guaranteed for the expressions from parseTrigger and AST.
+func FormatTrigger(expr Expr) string {
+	if expr == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	formatExpr(&sb, expr)
+	return sb.String()
+}
+
+func formatExpr(sb *strings.Builder, expr Expr) {
+	switch expr.GetType() {
+	case NodeCondition:
+		c := expr.GetCondition()
+		sb.WriteString(c.Field)
+		sb.WriteByte(' ')
+		sb.WriteString(c.Operator)
+		sb.WriteByte(' ')
+		sb.WriteString(formatNumber(c.Value))
+	case NodeLogical:
+		op := strings.ToUpper(expr.GetOperator())
+		children := expr.GetChildren()
+		left, right := children[0], children[1]
+
+		// AND binds tighter than OR, and both are left associative, so the
+		// left child needs parentheses only if it binds looser, the right
+		// child needs parentheses if it does not bind tighter.
+		formatOperand(sb, left, precedence(left) < precedence(expr))
+		sb.WriteByte(' ')
+		sb.WriteString(op)
+		sb.WriteByte(' ')
+		formatOperand(sb, right, precedence(right) <= precedence(expr))
+	}
+}
+
+func formatOperand(sb *strings.Builder, expr Expr, paren bool) {
+	if !paren {
+		formatExpr(sb, expr)
+		return
+	}
+
+	sb.WriteByte('(')
+	formatExpr(sb, expr)
+	sb.WriteByte(')')
+}
+
+// precedence return the binding power of the node, condition binds tightest.
+func precedence(expr Expr) int {
+	if expr.GetType() == NodeCondition {
+		return 3
+	}
+
+	if strings.ToUpper(expr.GetOperator()) == LogicUpperAnd {
+		return 2
+	}
+
+	return 1
+}
+
+// formatNumber format the float without exponent, the lexer only accepts
+// digits and dot.
+func formatNumber(v float64) string {
+	if v == 0 {
+		// drop the sign of negative zero.
+		v = 0
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// exprNode the serialized node of the expression tree.
+type exprNode struct {
+	Type     string    `json:"type" yaml:"type"`
+	Operator string    `json:"operator" yaml:"operator"`
+	Left     *exprNode `json:"left,omitempty" yaml:"left,omitempty"`
+	Right    *exprNode `json:"right,omitempty" yaml:"right,omitempty"`
+	Field    string    `json:"field,omitempty" yaml:"field,omitempty"`
+	Value    *float64  `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+func toNode(expr Expr) *exprNode {
+	if expr == nil {
+		return nil
+	}
+
+	switch expr.GetType() {
+	case NodeCondition:
+		c := expr.GetCondition()
+		value := c.Value
+		return &exprNode{
+			Type:     ExprNodeCondition,
+			Operator: c.Operator,
+			Field:    c.Field,
+			Value:    &value,
+		}
+	default:
+		children := expr.GetChildren()
+		return &exprNode{
+			Type:     ExprNodeLogical,
+			Operator: strings.ToUpper(expr.GetOperator()),
+			Left:     toNode(children[0]),
+			Right:    toNode(children[1]),
+		}
+	}
+}
+
+// toExpr convert the serialized node to expression and validate it the
+// same as parseTrigger does.
+func (n *exprNode) toExpr() (Expr, error) {
+	if n == nil {
+		return nil, errors.New("expression node must not be empty")
+	}
+
+	switch n.Type {
+	case ExprNodeCondition:
+		if _, ok := metricsMap[n.Field]; !ok {
+			err := fmt.Errorf("unknown metrics field %q", n.Field)
+			if s := suggest(n.Field, metricNames()); len(s) > 0 {
+				err = fmt.Errorf("%w (did you mean %s?)", err, quoteJoin(s, " or "))
+			}
+			return nil, err
+		}
+		if _, ok := operatorsMap[n.Operator]; !ok {
+			return nil, fmt.Errorf("unsupported condition operator %q", n.Operator)
+		}
+		if n.Value == nil {
+			return nil, fmt.Errorf("condition %s %s must have a value", n.Field, n.Operator)
+		}
+		// the trigger syntax has no sign or exponent, the value must be
+		// formatted back to the text parsed.
+		if *n.Value < 0 || math.IsInf(*n.Value, 0) || math.IsNaN(*n.Value) {
+			return nil, fmt.Errorf("condition %s %s value %v must be non negative and finite", n.Field, n.Operator, *n.Value)
+		}
+		value := *n.Value
+		if value == 0 {
+			// drop the sign of negative zero.
+			value = 0
+		}
+		return &Condition{
+			Field:    n.Field,
+			Operator: n.Operator,
+			Value:    value,
+		}, nil
+	case ExprNodeLogical:
+		op := strings.ToUpper(n.Operator)
+		if op != LogicUpperAnd && op != LogicUpperOr {
+			return nil, fmt.Errorf("unsupported logical operator %q", n.Operator)
+		}
+		left, err := n.Left.toExpr()
+		if err != nil {
+			return nil, err
+		}
+		right, err := n.Right.toExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &LogicalExpr{
+			Operator: op,
+			Left:     left,
+			Right:    right,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown expression node type %q", n.Type)
+	}
+}
+
+func (e *LogicalExpr) MarshalJSON() ([]byte, error) {
+	return json.Marshal(toNode(e))
+}
+
+func (e *LogicalExpr) MarshalYAML() (interface{}, error) {
+	return toNode(e), nil
+}
+
+func (c *Condition) MarshalJSON() ([]byte, error) {
+	return json.Marshal(toNode(c))
+}
+
+func (c *Condition) MarshalYAML() (interface{}, error) {
+	return toNode(c), nil
+}
+
+// AST the serializable wrapper of the trigger expression tree, it
+// implements Expr by embedding and supports JSON and YAML marshalling,
+// so that the control plane can display and edit the triggers.
+type AST struct {
+	Expr
+}
+
+// NewAST wrap the expression.
+func NewAST(expr Expr) *AST {
+	return &AST{Expr: expr}
+}
+
+func (a AST) MarshalJSON() ([]byte, error) {
+	return json.Marshal(toNode(a.Expr))
+}
+
+func (a *AST) UnmarshalJSON(bs []byte) error {
+	var node *exprNode
+	if err := json.Unmarshal(bs, &node); err != nil {
+		return err
+	}
+
+	return a.fromNode(node)
+}
+
+func (a AST) MarshalYAML() (interface{}, error) {
+	return toNode(a.Expr), nil
+}
+
+func (a *AST) UnmarshalYAML(value *yaml.Node) error {
+	var node *exprNode
+	if err := value.Decode(&node); err != nil {
+		return err
+	}
+
+	return a.fromNode(node)
+}
+
+func (a *AST) fromNode(node *exprNode) error {
+	if node == nil {
+		a.Expr = nil
+		return nil
+	}
+
+	expr, err := node.toExpr()
+	if err != nil {
+		return err
+	}
+	a.Expr = expr
+
+	return nil
+}
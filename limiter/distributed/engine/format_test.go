@@ -0,0 +1,278 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestFormatTrigger(t *testing.T) {
+	testCases := []struct {
+		name    string
+		trigger string
+		wantRes string
+	}{
+		{
+			name:    "condition",
+			trigger: "cpu_usage>0.80",
+			wantRes: "cpu_usage > 0.8",
+		},
+		{
+			name:    "integer value",
+			trigger: "request_latency >= 200.0",
+			wantRes: "request_latency >= 200",
+		},
+		{
+			name:    "lower case operator",
+			trigger: "cpu_usage > 0.8 or mem_usage > 0.8 and err_rate > 0.2",
+			wantRes: "cpu_usage > 0.8 OR mem_usage > 0.8 AND err_rate > 0.2",
+		},
+		{
+			name:    "redundant paren",
+			trigger: "(cpu_usage > 0.8) OR (mem_usage > 0.8 AND err_rate > 0.2)",
+			wantRes: "cpu_usage > 0.8 OR mem_usage > 0.8 AND err_rate > 0.2",
+		},
+		{
+			name:    "paren changes precedence",
+			trigger: "(cpu_usage > 0.8 OR mem_usage > 0.8) AND err_rate > 0.2",
+			wantRes: "(cpu_usage > 0.8 OR mem_usage > 0.8) AND err_rate > 0.2",
+		},
+		{
+			name:    "right associative paren",
+			trigger: "cpu_usage > 0.8 OR (mem_usage > 0.8 OR err_rate > 0.2)",
+			wantRes: "cpu_usage > 0.8 OR (mem_usage > 0.8 OR err_rate > 0.2)",
+		},
+		{
+			name:    "left associative",
+			trigger: "(cpu_usage > 0.8 AND mem_usage > 0.8) AND err_rate > 0.2",
+			wantRes: "cpu_usage > 0.8 AND mem_usage > 0.8 AND err_rate > 0.2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expr, err := parseTrigger(tc.trigger)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantRes, FormatTrigger(expr))
+			assert.Equal(t, tc.wantRes, expr.String())
+
+			again, err := parseTrigger(FormatTrigger(expr))
+			assert.NoError(t, err)
+			assert.Equal(t, expr, again)
+		})
+	}
+}
+
+func TestAST_JSON(t *testing.T) {
+	expr, err := parseTrigger("cpu_usage > 0.8 OR (mem_usage > 0.8 AND err_rate > 0)")
+	assert.NoError(t, err)
+
+	bs, err := json.Marshal(NewAST(expr))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "logical",
+		"operator": "OR",
+		"left": {"type": "condition", "field": "cpu_usage", "operator": ">", "value": 0.8},
+		"right": {
+			"type": "logical",
+			"operator": "AND",
+			"left": {"type": "condition", "field": "mem_usage", "operator": ">", "value": 0.8},
+			"right": {"type": "condition", "field": "err_rate", "operator": ">", "value": 0}
+		}
+	}`, string(bs))
+
+	// marshal the expression directly without wrapper.
+	raw, err := json.Marshal(expr)
+	assert.NoError(t, err)
+	assert.Equal(t, bs, raw)
+
+	var ast AST
+	assert.NoError(t, json.Unmarshal(bs, &ast))
+	assert.Equal(t, expr, ast.Expr)
+}
+
+func TestAST_YAML(t *testing.T) {
+	expr, err := parseTrigger("(cpu_usage > 0.8 OR mem_usage > 0.8) AND err_rate > 0.2")
+	assert.NoError(t, err)
+
+	bs, err := yaml.Marshal(NewAST(expr))
+	assert.NoError(t, err)
+
+	var ast AST
+	assert.NoError(t, yaml.Unmarshal(bs, &ast))
+	assert.Equal(t, expr, ast.Expr)
+}
+
+func TestAST_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "small value",
+			content: `{"type": "condition", "field": "err_rate", "operator": ">", "value": 1e-7}`,
+		},
+		{
+			name:    "large value",
+			content: `{"type": "condition", "field": "request_latency", "operator": ">=", "value": 1e21}`,
+		},
+		{
+			name:    "negative value",
+			content: `{"type": "condition", "field": "cpu_usage", "operator": ">", "value": -1}`,
+			wantErr: true,
+		},
+		{
+			name:    "negative zero",
+			content: `{"type": "condition", "field": "cpu_usage", "operator": ">", "value": -0}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var ast AST
+			err := json.Unmarshal([]byte(tc.content), &ast)
+			if tc.wantErr {
+				// the negative value is never formatted to the text the
+				// lexer rejects.
+				assert.Error(t, err)
+				_, err = parseTrigger("cpu_usage > -1")
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			expr, err := parseTrigger(FormatTrigger(ast.Expr))
+			assert.NoError(t, err)
+			assert.Equal(t, ast.Expr, expr)
+		})
+	}
+}
+
+func TestAST_Unmarshal_Invalid(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unknown metrics",
+			content: `{"type": "condition", "field": "cpu_usag", "operator": ">", "value": 1}`,
+			wantErr: `unknown metrics field "cpu_usag" (did you mean "cpu_usage"?)`,
+		},
+		{
+			name:    "unknown operator",
+			content: `{"type": "condition", "field": "cpu_usage", "operator": "!=", "value": 1}`,
+			wantErr: `unsupported condition operator "!="`,
+		},
+		{
+			name:    "missing value",
+			content: `{"type": "condition", "field": "cpu_usage", "operator": ">"}`,
+			wantErr: "condition cpu_usage > must have a value",
+		},
+		{
+			name:    "missing child",
+			content: `{"type": "logical", "operator": "AND", "left": {"type": "condition", "field": "cpu_usage", "operator": ">", "value": 1}}`,
+			wantErr: "expression node must not be empty",
+		},
+		{
+			name:    "unknown type",
+			content: `{"type": "not"}`,
+			wantErr: `unknown expression node type "not"`,
+		},
+		{
+			name:    "negative value",
+			content: `{"type": "condition", "field": "cpu_usage", "operator": ">", "value": -0.5}`,
+			wantErr: "condition cpu_usage > value -0.5 must be non negative and finite",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var ast AST
+			assert.EqualError(t, json.Unmarshal([]byte(tc.content), &ast), tc.wantErr)
+		})
+	}
+}
+
+func TestRule_TriggerAST(t *testing.T) {
+	// the control plane edits the ast only.
+	content := `{
+		"rules": {
+			"base_threshold": 1000,
+			"children": [{
+				"scope": {"type": "service", "value": "order_service"},
+				"base_threshold": 1000,
+				"strategy": "qps",
+				"period": "1s",
+				"priority": "high",
+				"trigger_ast": {"type": "condition", "field": "cpu_usage", "operator": ">", "value": 0.8}
+			}]
+		},
+		"redis_cluster": {"addr": ["127.0.0.1:6379"]}
+	}`
+
+	cfg, err := NewJsonParser([]byte(content)).Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, TriggerType("cpu_usage > 0.8"), cfg.Rules.Children[0].Trigger)
+
+	// the trigger text generates the ast.
+	parser, err := NewParser(NewFileSource("./examples/rule.json", DataTypeJson))
+	assert.NoError(t, err)
+	cfg, err = parser.Parse()
+	assert.NoError(t, err)
+	bs, err := json.Marshal(cfg)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bs), `"trigger_ast":{"type":"logical","operator":"OR"`)
+}
+
+func FuzzFormatTrigger(f *testing.F) {
+	seeds := []string{
+		"cpu_usage > 0.8",
+		"cpu_usage > 0.8 OR mem_usage > 0.8 AND err_rate > 0.2",
+		"(cpu_usage > 0.8 OR mem_usage > 0.8) AND err_rate > 0.2",
+		"cpu_usage > 0.8 OR (mem_usage > 0.8 OR (err_rate > 0.2 and active_conns >= 1000))",
+		"request_latency <= 123456789012345678901234567890.5",
+		"mem_used = .5",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, trigger string) {
+		expr, err := parseTrigger(trigger)
+		if err != nil {
+			return
+		}
+
+		formatted := FormatTrigger(expr)
+		again, err := parseTrigger(formatted)
+		if err != nil {
+			t.Fatalf("parse formatted trigger %q failed: %v", formatted, err)
+		}
+		assert.Equal(t, expr, again)
+		assert.Equal(t, formatted, FormatTrigger(again))
+
+		bs, err := json.Marshal(NewAST(expr))
+		assert.NoError(t, err)
+		var ast AST
+		assert.NoError(t, json.Unmarshal(bs, &ast))
+		assert.Equal(t, expr, ast.Expr)
+	})
+}
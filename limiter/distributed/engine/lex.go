@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -37,6 +38,8 @@ const (
 	TokenLogicalOp
 	TokenLParen
 	TokenRParen
+	// TokenEOF the virtual token returned while reaching the end of input.
+	TokenEOF
 )
 
 func (t TokenType) String() string {
@@ -53,6 +56,8 @@ func (t TokenType) String() string {
 		return "lparen"
 	case TokenRParen:
 		return "rparen"
+	case TokenEOF:
+		return "end of input"
 	default:
 		return "unknown"
 	}
@@ -80,11 +85,21 @@ var (
 type Token struct {
 	Tp    TokenType
 	Value string
+	// Pos the byte offset of the token in the trigger expression.
+	Pos int
+}
+
+// describe return the readable description of token used in error messages.
+func (t Token) describe() string {
+	if t.Tp == TokenEOF {
+		return t.Tp.String()
+	}
+
+	return fmt.Sprintf("%s %q", t.Tp, t.Value)
 }
 
 func lex(content string) ([]Token, error) {
 	var tokens []Token
-	content = strings.TrimSpace(content)
 	pos := 0
 	for pos < len(content) {
 		ch := rune(content[pos])
@@ -94,10 +109,10 @@ func lex(content string) ([]Token, error) {
 			pos++
 			continue
 		case ch == '(':
-			tokens = append(tokens, Token{TokenLParen, string(ch)})
+			tokens = append(tokens, Token{TokenLParen, string(ch), pos})
 			pos++
 		case ch == ')':
-			tokens = append(tokens, Token{TokenRParen, string(ch)})
+			tokens = append(tokens, Token{TokenRParen, string(ch), pos})
 			pos++
 		case unicode.IsDigit(ch), ch == '.':
 			start := pos
@@ -106,23 +121,26 @@ func lex(content string) ([]Token, error) {
 			for pos < len(content) && (unicode.IsDigit(rune(content[pos])) || content[pos] == '.') {
 				if content[pos] == '.' {
 					if hasDot {
-						return tokens, fmt.Errorf("invalid character in number: %s, position: %d",
-							content[start:pos], pos)
+						err := newSyntaxError(content, pos,
+							fmt.Sprintf("invalid character '.' in number %q", content[start:pos]))
+						err.Found = "."
+						err.Expected = []string{"digit"}
+						return tokens, err
 					}
 					hasDot = true
 				}
 				pos++
 			}
 
-			tokens = append(tokens, Token{TokenNumber, content[start:pos]})
+			tokens = append(tokens, Token{TokenNumber, content[start:pos], start})
 		case ch == '>', ch == '<', ch == '=':
 			start := pos
 			pos++
 			if pos < len(content) && content[pos] == '=' {
-				tokens = append(tokens, Token{TokenOperator, content[start : pos+1]})
+				tokens = append(tokens, Token{TokenOperator, content[start : pos+1], start})
 				pos++
 			} else {
-				tokens = append(tokens, Token{TokenOperator, string(ch)})
+				tokens = append(tokens, Token{TokenOperator, string(ch), start})
 			}
 		case unicode.IsLetter(ch), ch == '_':
 			start := pos
@@ -135,12 +153,14 @@ func lex(content string) ([]Token, error) {
 			upperValue := strings.ToUpper(value)
 			switch upperValue {
 			case LogicUpperOr, LogicUpperAnd:
-				tokens = append(tokens, Token{TokenLogicalOp, upperValue})
+				tokens = append(tokens, Token{TokenLogicalOp, upperValue, start})
 			default:
-				tokens = append(tokens, Token{TokenIdentifier, value})
+				tokens = append(tokens, Token{TokenIdentifier, value, start})
 			}
 		default:
-			return tokens, fmt.Errorf("invalid character in identifier: %s, position: %d", string(ch), pos)
+			err := newSyntaxError(content, pos, fmt.Sprintf("invalid character %q", string(ch)))
+			err.Found = string(ch)
+			return tokens, err
 		}
 	}
 
@@ -167,12 +187,35 @@ func (t *NodeType) String() string {
 
 type EvalContext struct {
 	metrics map[string]float64
+	// the policy to evaluate the condition whose metrics is not reported.
+	policy MissingPolicy
+	// the last known metrics, only used by MissingPolicyLastKnown.
+	history *MetricsHistory
+	// the max age of the last known metrics, zero means never stale.
+	ttl time.Duration
+	// the evaluation time, zero means time.Now.
+	now time.Time
 }
 
 func WithEvalContext(metrics map[string]float64) EvalContext {
 	return EvalContext{metrics: metrics}
 }
 
+// WithMissingPolicy set the policy for the metrics not reported, history and
+// ttl are only used by MissingPolicyLastKnown.
+func (ctx EvalContext) WithMissingPolicy(policy MissingPolicy, history *MetricsHistory, ttl time.Duration) EvalContext {
+	ctx.policy = policy
+	ctx.history = history
+	ctx.ttl = ttl
+	return ctx
+}
+
+// WithNow set the evaluation time used to check the staleness of last known metrics.
+func (ctx EvalContext) WithNow(now time.Time) EvalContext {
+	ctx.now = now
+	return ctx
+}
+
 type Expr interface {
 	// GetType get the type of node
 	GetType() NodeType
@@ -184,6 +227,8 @@ type Expr interface {
 	GetCondition() *Condition
 	// Evaluate the core logic to evaluate metric value.
 	Evaluate(EvalContext) (bool, error)
+	// Explain evaluate the expression and return the evaluated tree.
+	Explain(EvalContext) *Trace
 	// String return the value type string.
 	String() string
 }
@@ -214,7 +259,7 @@ func (e *LogicalExpr) GetCondition() *Condition {
 }
 
 func (e *LogicalExpr) String() string {
-	return fmt.Sprintf("%s %s %s", e.Left, e.Operator, e.Right)
+	return FormatTrigger(e)
 }
 
 func (e *LogicalExpr) Evaluate(ctx EvalContext) (bool, error) {
@@ -264,15 +309,24 @@ func (c *Condition) GetCondition() *Condition {
 }
 
 func (c *Condition) String() string {
-	return fmt.Sprintf("%s %s %f", c.Field, c.Operator, c.Value)
+	return FormatTrigger(c)
 }
 
 func (c *Condition) Evaluate(ctx EvalContext) (bool, error) {
 	actualValue, ok := ctx.metrics[c.Field]
 	if !ok {
-		return false, fmt.Errorf("trigger field %s not exist metrics", c.Field)
+		v, found, res, err := ctx.missing(c.Field)
+		if err != nil || !found {
+			return res, err
+		}
+		actualValue = v
 	}
 
+	return c.compare(actualValue)
+}
+
+// compare the actual metric value with the threshold.
+func (c *Condition) compare(actualValue float64) (bool, error) {
 	switch c.Operator {
 	case ">":
 		return actualValue > c.Value, nil
@@ -294,18 +348,35 @@ type ParenExpr struct {
 }
 
 type TriggerParser struct {
+	// the trigger expression, used to report error position.
+	input string
 	// all lex tokens
 	tokens []Token
 	// current token index
 	pos int
 }
 
-func newTriggerParser(tokens []Token) *TriggerParser {
-	return &TriggerParser{tokens: tokens}
+func newTriggerParser(input string, tokens []Token) *TriggerParser {
+	return &TriggerParser{input: input, tokens: tokens}
 }
 
 func (t *TriggerParser) parse() (Expr, error) {
-	return t.parseExpression()
+	expr, err := t.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	// all tokens must be consumed, otherwise the rest of trigger is ignored silently.
+	if token := t.peek(); token.Tp != TokenEOF {
+		err := t.errorf(token, "unexpected %s", token.describe())
+		err.Expected = []string{LogicUpperAnd, LogicUpperOr, TokenEOF.String()}
+		if token.Tp == TokenIdentifier {
+			err.Suggestions = suggest(token.Value, []string{LogicUpperAnd, LogicUpperOr})
+		}
+		return nil, err
+	}
+
+	return expr, nil
 }
 
 func (t *TriggerParser) Evaluate(metrics map[string]float64) (bool, error) {
@@ -389,8 +460,10 @@ func (t *TriggerParser) parseFactor() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		if t.peek().Tp != TokenRParen {
-			return nil, fmt.Errorf("expected ')' but got '%s'", t.peek().Tp.String())
+		if next := t.peek(); next.Tp != TokenRParen {
+			er := t.errorf(next, "unclosed '(' at column %d, got %s", t.column(token), next.describe())
+			er.Expected = []string{"')'", LogicUpperAnd, LogicUpperOr}
+			return nil, er
 		}
 		t.consume()
 		return expr, nil
@@ -404,35 +477,49 @@ func (t *TriggerParser) parseCondition() (Expr, error) {
 	// get and validate field.
 	filedToken := t.peek()
 	if filedToken.Tp != TokenIdentifier {
-		return nil, fmt.Errorf("expected identifier, got %v", filedToken.Tp)
+		err := t.errorf(filedToken, "unexpected %s", filedToken.describe())
+		err.Expected = []string{"metrics field", "'('"}
+		return nil, err
 	}
 	field := filedToken.Value
 	_, ok := metricsMap[field]
 	if !ok {
-		return nil, fmt.Errorf("expected metrics field, got %v", field)
+		names := metricNames()
+		err := t.errorf(filedToken, "unknown metrics field %q", field)
+		err.Expected = names
+		err.Suggestions = suggest(field, names)
+		return nil, err
 	}
 
 	// get and validate operator.
 	t.consume()
 	operatorToken := t.peek()
 	if operatorToken.Tp != TokenOperator {
-		return nil, fmt.Errorf("expected operator, got %v", operatorToken.Tp)
+		err := t.errorf(operatorToken, "unexpected %s after %q", operatorToken.describe(), field)
+		err.Expected = []string{">", ">=", "<", "<=", "="}
+		return nil, err
 	}
 	operator := operatorToken.Value
 	_, ok = operatorsMap[operator]
 	if !ok {
-		return nil, fmt.Errorf("expected operator, got %v", operator)
+		err := t.errorf(operatorToken, "unsupported operator %q", operator)
+		err.Expected = []string{">", ">=", "<", "<=", "="}
+		return nil, err
 	}
 
 	// get and validate value.
 	t.consume()
 	valueToken := t.peek()
 	if valueToken.Tp != TokenNumber {
-		return nil, fmt.Errorf("expected number, got %v", valueToken.Tp)
+		err := t.errorf(valueToken, "unexpected %s after %q", valueToken.describe(), operator)
+		err.Expected = []string{TokenNumber.String()}
+		return nil, err
 	}
 	value, err := strconv.ParseFloat(valueToken.Value, 64)
 	if err != nil {
-		return nil, err
+		er := t.errorf(valueToken, "invalid number %q", valueToken.Value)
+		er.Expected = []string{TokenNumber.String()}
+		return nil, er
 	}
 
 	t.consume()
@@ -447,7 +534,7 @@ func (t *TriggerParser) parseCondition() (Expr, error) {
 // peek return the next token without consuming it.
 func (t *TriggerParser) peek() Token {
 	if t.pos >= len(t.tokens) {
-		return Token{Tp: -1, Value: ""}
+		return Token{Tp: TokenEOF, Value: "", Pos: len(t.input)}
 	}
 
 	return t.tokens[t.pos]
@@ -458,6 +545,19 @@ func (t *TriggerParser) consume() {
 	t.pos++
 }
 
+// errorf create the syntax error located at token.
+func (t *TriggerParser) errorf(token Token, format string, args ...any) *SyntaxError {
+	err := newSyntaxError(t.input, token.Pos, fmt.Sprintf(format, args...))
+	err.Found = token.Value
+	return err
+}
+
+// column return the column of token in the line it located.
+func (t *TriggerParser) column(token Token) int {
+	_, column := position(t.input, token.Pos)
+	return column
+}
+
 // parseTrigger the main method for parsing trigger and generate Expr.
 func parseTrigger(trigger string) (Expr, error) {
 	tokens, err := lex(trigger)
@@ -465,5 +565,5 @@ func parseTrigger(trigger string) (Expr, error) {
 		return nil, err
 	}
 
-	return newTriggerParser(tokens).parse()
+	return newTriggerParser(trigger, tokens).parse()
 }
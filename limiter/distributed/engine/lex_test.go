@@ -15,7 +15,6 @@
 package engine
 
 import (
-	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -32,13 +31,29 @@ func TestLex(t *testing.T) {
 			name:    "err number, last is dot",
 			input:   "test > 0.00.",
 			wantRes: []Token{},
-			wantErr: fmt.Errorf("invalid character in number: 0.00, position: 11"),
+			wantErr: &SyntaxError{
+				Trigger:  "test > 0.00.",
+				Offset:   11,
+				Line:     1,
+				Column:   12,
+				Msg:      `invalid character '.' in number "0.00"`,
+				Found:    ".",
+				Expected: []string{"digit"},
+			},
 		},
 		{
 			name:    "err number, two dot",
 			input:   "test > 0.0.0",
 			wantRes: []Token{},
-			wantErr: fmt.Errorf("invalid character in number: 0.0, position: 10"),
+			wantErr: &SyntaxError{
+				Trigger:  "test > 0.0.0",
+				Offset:   10,
+				Line:     1,
+				Column:   11,
+				Msg:      `invalid character '.' in number "0.0"`,
+				Found:    ".",
+				Expected: []string{"digit"},
+			},
 		},
 		{
 			name:  "letter,operator and number",
@@ -47,14 +62,17 @@ func TestLex(t *testing.T) {
 				{
 					Tp:    TokenIdentifier,
 					Value: "test",
+					Pos:   0,
 				},
 				{
 					Tp:    TokenOperator,
 					Value: ">",
+					Pos:   5,
 				},
 				{
 					Tp:    TokenNumber,
 					Value: "0.01",
+					Pos:   7,
 				},
 			},
 			wantErr: nil,
@@ -66,30 +84,37 @@ func TestLex(t *testing.T) {
 				{
 					Tp:    TokenIdentifier,
 					Value: "cpu_usage",
+					Pos:   0,
 				},
 				{
 					Tp:    TokenOperator,
 					Value: ">",
+					Pos:   10,
 				},
 				{
 					Tp:    TokenNumber,
 					Value: "0.9",
+					Pos:   12,
 				},
 				{
 					Tp:    TokenLogicalOp,
 					Value: "AND",
+					Pos:   16,
 				},
 				{
 					Tp:    TokenIdentifier,
 					Value: "mem_usage",
+					Pos:   20,
 				},
 				{
 					Tp:    TokenOperator,
 					Value: ">=",
+					Pos:   30,
 				},
 				{
 					Tp:    TokenNumber,
 					Value: "0.8",
+					Pos:   33,
 				},
 			},
 			wantErr: nil,
@@ -101,54 +126,67 @@ func TestLex(t *testing.T) {
 				{
 					Tp:    TokenIdentifier,
 					Value: "cpu_usage",
+					Pos:   0,
 				},
 				{
 					Tp:    TokenOperator,
 					Value: ">",
+					Pos:   10,
 				},
 				{
 					Tp:    TokenNumber,
 					Value: "0.9",
+					Pos:   12,
 				},
 				{
 					Tp:    TokenLogicalOp,
 					Value: "AND",
+					Pos:   16,
 				},
 				{
 					Tp:    TokenLParen,
 					Value: "(",
+					Pos:   20,
 				},
 				{
 					Tp:    TokenIdentifier,
 					Value: "mem_usage",
+					Pos:   21,
 				},
 				{
 					Tp:    TokenOperator,
 					Value: ">=",
+					Pos:   31,
 				},
 				{
 					Tp:    TokenNumber,
 					Value: "0.8",
+					Pos:   34,
 				},
 				{
 					Tp:    TokenLogicalOp,
 					Value: "OR",
+					Pos:   38,
 				},
 				{
 					Tp:    TokenIdentifier,
 					Value: "err_rate",
+					Pos:   41,
 				},
 				{
 					Tp:    TokenOperator,
 					Value: ">",
+					Pos:   50,
 				},
 				{
 					Tp:    TokenNumber,
 					Value: "0.2",
+					Pos:   52,
 				},
 				{
 					Tp:    TokenRParen,
 					Value: ")",
+					Pos:   55,
 				},
 			},
 			wantErr: nil,
@@ -157,7 +195,14 @@ func TestLex(t *testing.T) {
 			name:    "error identifier",
 			input:   "** _test ",
 			wantRes: []Token{},
-			wantErr: fmt.Errorf("invalid character in identifier: *, position: 0"),
+			wantErr: &SyntaxError{
+				Trigger: "** _test ",
+				Offset:  0,
+				Line:    1,
+				Column:  1,
+				Msg:     `invalid character "*"`,
+				Found:   "*",
+			},
 		},
 	}
 
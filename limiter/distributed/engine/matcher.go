@@ -0,0 +1,605 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+const (
+	// ScopeValueAny the scope value matches any request.
+	ScopeValueAny = "*"
+	// UserLabelGroup the user scope value prefix to match the user group, such as group:vip.
+	UserLabelGroup = "group"
+	// UserLabelTier the user scope value prefix to match the user tier, such as tier:gold.
+	UserLabelTier = "tier"
+)
+
+// scopeMatcher the compiled matcher of the sibling scopes with same type,
+// it returns the index of the matched scope.
+type scopeMatcher interface {
+	add(value string, idx int) error
+	match(req Request) (int, bool)
+}
+
+// extractFunc extract the attribute of request matched by scope.
+type extractFunc func(req Request) (string, bool)
+
+// newScopeMatcher create the matcher of the sibling scopes with the same
+// type and key as scope.
+func newScopeMatcher(scope Scope) (scopeMatcher, error) {
+	kind, ok := LookupScopeType(scope.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown scope type %s", scope.Type)
+	}
+
+	extract := func(req Request) (string, bool) {
+		return kind.Extractor(req, scope.Key)
+	}
+	if kind.newMatcher != nil {
+		return kind.newMatcher(extract), nil
+	}
+
+	return newExactMatcher(extract), nil
+}
+
+// validScopeValue check the pattern syntax of the scope value.
+func validScopeValue(scope Scope) error {
+	m, err := newScopeMatcher(scope)
+	if err != nil {
+		return err
+	}
+
+	return m.add(scope.Value, 0)
+}
+
+// RuleMatcher resolve the request to its rule tree node, the scopes of
+// children are compiled into tries, so that resolving costs the length of
+// request attributes instead of the count of rules.
+type RuleMatcher struct {
+	root *matchNode
+}
+
+type matchNode struct {
+	tree *RuleTree
+	// the children grouped by scope type and key, in order of appearance.
+	groups []*matchGroup
+}
+
+type matchGroup struct {
+	tp       string
+	key      string
+	matcher  scopeMatcher
+	children []*matchNode
+}
+
+// NewRuleMatcher compile the scope patterns of rule trees, the trees are
+// the roots returned by BuildRuleTrees.
+func NewRuleMatcher(trees []RuleTree) (*RuleMatcher, error) {
+	root := &matchNode{}
+	err := root.compile(trees, func(int) string {
+		return "rules"
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &RuleMatcher{root: root}, nil
+}
+
+// compile the children of node, the path returns the rule path in Conf of
+// the i-th tree to report errors.
+func (n *matchNode) compile(trees []RuleTree, path func(i int) string) error {
+	for i := range trees {
+		child := &matchNode{tree: &trees[i]}
+		err := child.compile(trees[i].children, func(j int) string {
+			return fmt.Sprintf("%s.children[%d]", path(i), j)
+		})
+		if err != nil {
+			return err
+		}
+
+		scope := trees[i].scope
+		group := n.group(scope)
+		if group == nil {
+			group = &matchGroup{tp: scope.Type, key: scope.Key}
+			if scope.Type != "" {
+				m, err := newScopeMatcher(scope)
+				if err != nil {
+					return &FieldError{Path: path(i) + ".scope.type", Err: err}
+				}
+				group.matcher = m
+			}
+			n.groups = append(n.groups, group)
+		}
+
+		if group.matcher != nil {
+			err := group.matcher.add(trees[i].scope.Value, len(group.children))
+			if err != nil {
+				return &FieldError{Path: path(i) + ".scope.value", Err: err}
+			}
+		}
+		group.children = append(group.children, child)
+	}
+
+	return nil
+}
+
+func (n *matchNode) group(scope Scope) *matchGroup {
+	for _, g := range n.groups {
+		if g.tp == scope.Type && g.key == scope.Key {
+			return g
+		}
+	}
+
+	return nil
+}
+
+// next return the matched child, the groups are tried in order of appearance.
+func (n *matchNode) next(req Request) *matchNode {
+	for _, g := range n.groups {
+		// the scope is empty, such as the root rule, matches all.
+		if g.matcher == nil {
+			return g.children[0]
+		}
+
+		if idx, ok := g.matcher.match(req); ok {
+			return g.children[idx]
+		}
+	}
+
+	return nil
+}
+
+// Match return the deepest rule tree node matched the request, nil if no
+// rule matched.
+func (m *RuleMatcher) Match(req Request) *RuleTree {
+	path := m.MatchPath(req)
+	if len(path) == 0 {
+		return nil
+	}
+
+	return path[len(path)-1]
+}
+
+// MatchPath return the matched rule tree nodes from the root to the deepest,
+// the request is limited by all of them.
+func (m *RuleMatcher) MatchPath(req Request) []*RuleTree {
+	var path []*RuleTree
+	for n := m.root.next(req); n != nil; n = n.next(req) {
+		path = append(path, n.tree)
+	}
+
+	return path
+}
+
+var errDuplicateScope = errors.New("duplicate scope value")
+
+// exactMatcher match the scope value literally, or any value with *.
+type exactMatcher struct {
+	extract extractFunc
+	values  map[string]int
+	any     int
+}
+
+func newExactMatcher(extract extractFunc) scopeMatcher {
+	return newExact(extract)
+}
+
+func newExact(extract extractFunc) *exactMatcher {
+	return &exactMatcher{extract: extract, values: map[string]int{}, any: -1}
+}
+
+func (e *exactMatcher) add(value string, idx int) error {
+	if value == ScopeValueAny {
+		if e.any >= 0 {
+			return errDuplicateScope
+		}
+		e.any = idx
+		return nil
+	}
+
+	if _, ok := e.values[value]; ok {
+		return errDuplicateScope
+	}
+	e.values[value] = idx
+
+	return nil
+}
+
+func (e *exactMatcher) match(req Request) (int, bool) {
+	key, ok := e.extract(req)
+	if !ok {
+		return 0, false
+	}
+
+	if idx, ok := e.values[key]; ok {
+		return idx, true
+	}
+
+	return e.any, e.any >= 0
+}
+
+// pathTrie the radix trie keyed by path segments, it supports the literal
+// segment, the parameter segment such as {id}, and the trailing wildcard
+// segment * matching one or more segments of the rest. The literal segment
+// takes precedence over the parameter, and the parameter over the wildcard,
+// the scope * matches any path including the root.
+type pathTrie struct {
+	extract extractFunc
+	root    *pathNode
+	// the index of scope *, -1 if none.
+	any int
+}
+
+type pathNode struct {
+	static map[string]*pathNode
+	param  *pathNode
+	// the index of scope ends at this node, -1 if none.
+	leaf int
+	// the index of scope ends with wildcard at this node, -1 if none.
+	wildcard int
+}
+
+func newPathNode() *pathNode {
+	return &pathNode{leaf: -1, wildcard: -1}
+}
+
+func newPathTrie(extract extractFunc) scopeMatcher {
+	return &pathTrie{extract: extract, root: newPathNode(), any: -1}
+}
+
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/'
+	})
+}
+
+func (p *pathTrie) add(value string, idx int) error {
+	if value == ScopeValueAny {
+		if p.any >= 0 {
+			return errDuplicateScope
+		}
+		p.any = idx
+		return nil
+	}
+	if !strings.HasPrefix(value, "/") {
+		return fmt.Errorf("api scope %q must start with /", value)
+	}
+
+	n := p.root
+	segments := splitPath(value)
+	for i, seg := range segments {
+		switch {
+		case seg == ScopeValueAny:
+			if i != len(segments)-1 {
+				return fmt.Errorf("api scope %q wildcard must be the last segment", value)
+			}
+			if n.wildcard >= 0 {
+				return errDuplicateScope
+			}
+			n.wildcard = idx
+			return nil
+		case strings.HasPrefix(seg, "{") || strings.HasSuffix(seg, "}"):
+			name := strings.TrimSuffix(strings.TrimPrefix(seg, "{"), "}")
+			if len(seg) < 2 || seg[0] != '{' || seg[len(seg)-1] != '}' || name == "" ||
+				strings.ContainsAny(name, "{}") {
+				return fmt.Errorf("api scope %q has invalid parameter segment %q", value, seg)
+			}
+			if n.param == nil {
+				n.param = newPathNode()
+			}
+			n = n.param
+		case strings.ContainsAny(seg, "{}*"):
+			return fmt.Errorf("api scope %q has invalid segment %q", value, seg)
+		default:
+			if n.static == nil {
+				n.static = map[string]*pathNode{}
+			}
+			child, ok := n.static[seg]
+			if !ok {
+				child = newPathNode()
+				n.static[seg] = child
+			}
+			n = child
+		}
+	}
+
+	if n.leaf >= 0 {
+		return errDuplicateScope
+	}
+	n.leaf = idx
+
+	return nil
+}
+
+func (p *pathTrie) match(req Request) (int, bool) {
+	path, ok := p.extract(req)
+	if !ok {
+		return 0, false
+	}
+
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+
+	idx := p.root.match(splitPath(path))
+	if idx < 0 {
+		idx = p.any
+	}
+
+	return idx, idx >= 0
+}
+
+func (n *pathNode) match(segments []string) int {
+	// the wildcard requires one segment at least.
+	if len(segments) == 0 {
+		return n.leaf
+	}
+
+	if child, ok := n.static[segments[0]]; ok {
+		if idx := child.match(segments[1:]); idx >= 0 {
+			return idx
+		}
+	}
+
+	if n.param != nil {
+		if idx := n.param.match(segments[1:]); idx >= 0 {
+			return idx
+		}
+	}
+
+	return n.wildcard
+}
+
+// cidrTrie the binary prefix trie of ip addresses, it returns the longest
+// prefix matched. The single ip is the prefix with full bits, and * is the
+// prefix with zero bits.
+type cidrTrie struct {
+	extract extractFunc
+	v4      *cidrNode
+	v6      *cidrNode
+}
+
+type cidrNode struct {
+	children [2]*cidrNode
+	// the index of scope ends at this node, -1 if none.
+	idx int
+}
+
+func newCIDRTrie(extract extractFunc) scopeMatcher {
+	return &cidrTrie{extract: extract, v4: &cidrNode{idx: -1}, v6: &cidrNode{idx: -1}}
+}
+
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func (c *cidrTrie) add(value string, idx int) error {
+	if value == ScopeValueAny {
+		if c.v4.idx >= 0 || c.v6.idx >= 0 {
+			return errDuplicateScope
+		}
+		c.v4.idx, c.v6.idx = idx, idx
+		return nil
+	}
+
+	prefix, err := parsePrefix(value)
+	if err != nil {
+		return fmt.Errorf("ip scope %q is not ip or cidr: %w", value, err)
+	}
+	// the ipv4-mapped prefix is stored as ipv4, as the mapped addresses are
+	// unmapped in match.
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+
+	n := c.root(prefix.Addr())
+	bs := prefix.Addr().AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := bs[i/8] >> (7 - i%8) & 1
+		if n.children[bit] == nil {
+			n.children[bit] = &cidrNode{idx: -1}
+		}
+		n = n.children[bit]
+	}
+
+	if n.idx >= 0 {
+		return errDuplicateScope
+	}
+	n.idx = idx
+
+	return nil
+}
+
+func (c *cidrTrie) root(addr netip.Addr) *cidrNode {
+	if addr.Is4() {
+		return c.v4
+	}
+
+	return c.v6
+}
+
+func (c *cidrTrie) match(req Request) (int, bool) {
+	ip, ok := c.extract(req)
+	if !ok {
+		return 0, false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return 0, false
+	}
+	addr = addr.Unmap()
+
+	n := c.root(addr)
+	idx := n.idx
+	bs := addr.AsSlice()
+	for i := 0; i < addr.BitLen() && n != nil; i++ {
+		n = n.children[bs[i/8]>>(7-i%8)&1]
+		if n != nil && n.idx >= 0 {
+			idx = n.idx
+		}
+	}
+
+	return idx, idx >= 0
+}
+
+// userMatcher match the user id literally, the user labels such as
+// group:vip and tier:gold, or any user with *. The user id takes precedence
+// over the labels, and the labels over *, the first label scope wins if
+// the user matches multiple labels.
+type userMatcher struct {
+	users  *exactMatcher
+	labels map[string]int
+}
+
+func newUserMatcher(extract extractFunc) scopeMatcher {
+	return &userMatcher{
+		users:  newExact(extract),
+		labels: map[string]int{},
+	}
+}
+
+func (u *userMatcher) add(value string, idx int) error {
+	label, name, ok := strings.Cut(value, ":")
+	if !ok {
+		return u.users.add(value, idx)
+	}
+
+	if label != UserLabelGroup && label != UserLabelTier {
+		return fmt.Errorf("user scope %q label must be one of %s, %s", value, UserLabelGroup, UserLabelTier)
+	}
+	if name == "" {
+		return fmt.Errorf("user scope %q must have a label value", value)
+	}
+	if _, exists := u.labels[value]; exists {
+		return errDuplicateScope
+	}
+	u.labels[value] = idx
+
+	return nil
+}
+
+func (u *userMatcher) match(req Request) (int, bool) {
+	user, found := u.users.extract(req)
+	if idx, ok := u.users.values[user]; ok && found {
+		return idx, true
+	}
+
+	res := -1
+	for label, name := range req.UserLabels {
+		idx, ok := u.labels[label+":"+name]
+		if ok && (res < 0 || idx < res) {
+			res = idx
+		}
+	}
+	if res >= 0 {
+		return res, true
+	}
+
+	if !found && len(req.UserLabels) == 0 {
+		return 0, false
+	}
+
+	return u.users.any, u.users.any >= 0
+}
+
+// grpcMatcher match the grpc full method literally, such as
+// /pkg.Service/Method, the service wildcard such as /pkg.Service/*, or any
+// method with *. The method takes precedence over the service wildcard.
+type grpcMatcher struct {
+	methods  *exactMatcher
+	services map[string]int
+}
+
+func newGRPCMatcher(extract extractFunc) scopeMatcher {
+	return &grpcMatcher{
+		methods:  newExact(extract),
+		services: map[string]int{},
+	}
+}
+
+// splitGRPCMethod split the full method /pkg.Service/Method to service and method.
+func splitGRPCMethod(fullMethod string) (string, string, bool) {
+	if !strings.HasPrefix(fullMethod, "/") {
+		return "", "", false
+	}
+
+	service, method, ok := strings.Cut(fullMethod[1:], "/")
+	if !ok || service == "" || method == "" || strings.Contains(method, "/") {
+		return "", "", false
+	}
+
+	return service, method, true
+}
+
+func (g *grpcMatcher) add(value string, idx int) error {
+	if value == ScopeValueAny {
+		return g.methods.add(value, idx)
+	}
+
+	service, method, ok := splitGRPCMethod(value)
+	if !ok {
+		return fmt.Errorf("grpc scope %q must be /pkg.Service/Method or /pkg.Service/*", value)
+	}
+
+	if method != ScopeValueAny {
+		return g.methods.add(value, idx)
+	}
+
+	if _, exists := g.services[service]; exists {
+		return errDuplicateScope
+	}
+	g.services[service] = idx
+
+	return nil
+}
+
+func (g *grpcMatcher) match(req Request) (int, bool) {
+	fullMethod, ok := g.methods.extract(req)
+	if !ok {
+		return 0, false
+	}
+
+	if idx, exists := g.methods.values[fullMethod]; exists {
+		return idx, true
+	}
+
+	if service, _, valid := splitGRPCMethod(fullMethod); valid {
+		if idx, exists := g.services[service]; exists {
+			return idx, true
+		}
+	}
+
+	return g.methods.any, g.methods.any >= 0
+}
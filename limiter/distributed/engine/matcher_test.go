@@ -0,0 +1,229 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleMatcher_Match(t *testing.T) {
+	rule := Rule{
+		BaseThreshold: 10000,
+		Strategy:      StrategyQPS,
+		Period:        "1s",
+		Priority:      PriorityTypeLow,
+		Children: []Rule{
+			{
+				Scope:         Scope{Type: ScopeTypeService, Value: "order_service"},
+				BaseThreshold: 5000,
+				Children: []Rule{
+					{Scope: Scope{Type: ScopeTypeAPI, Value: "/api/v1/order/{id}"}, BaseThreshold: 1000},
+					{Scope: Scope{Type: ScopeTypeAPI, Value: "/api/v1/order/list"}, BaseThreshold: 900},
+					{
+						Scope:         Scope{Type: ScopeTypeAPI, Value: "/api/v1/*"},
+						BaseThreshold: 800,
+						Children: []Rule{
+							{Scope: Scope{Type: ScopeTypeUser, Value: "10086"}, BaseThreshold: 100},
+							{Scope: Scope{Type: ScopeTypeUser, Value: "tier:gold"}, BaseThreshold: 50},
+							{Scope: Scope{Type: ScopeTypeUser, Value: "group:vip"}, BaseThreshold: 40},
+							{Scope: Scope{Type: ScopeTypeUser, Value: "*"}, BaseThreshold: 10},
+							{Scope: Scope{Type: ScopeTypeIP, Value: "10.0.0.0/8"}, BaseThreshold: 30},
+							{Scope: Scope{Type: ScopeTypeIP, Value: "10.1.0.0/16"}, BaseThreshold: 20},
+							{Scope: Scope{Type: ScopeTypeIP, Value: "2001:db8::/32"}, BaseThreshold: 20},
+							{Scope: Scope{Type: ScopeTypeIP, Value: "::ffff:172.16.0.0/108"}, BaseThreshold: 20},
+						},
+					},
+				},
+			},
+			{Scope: Scope{Type: ScopeTypeService, Value: "*"}, BaseThreshold: 100},
+		},
+	}
+
+	trees, err := BuildRuleTrees(rule)
+	require.NoError(t, err)
+	m, err := NewRuleMatcher(trees)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		req      Request
+		wantPath []string
+	}{
+		{
+			name:     "path template",
+			req:      Request{Service: "order_service", API: "/api/v1/order/1001"},
+			wantPath: []string{"", "order_service", "/api/v1/order/{id}"},
+		},
+		{
+			name:     "literal over template",
+			req:      Request{Service: "order_service", API: "/api/v1/order/list?page=1"},
+			wantPath: []string{"", "order_service", "/api/v1/order/list"},
+		},
+		{
+			name:     "wildcard",
+			req:      Request{Service: "order_service", API: "/api/v1/order/1001/items"},
+			wantPath: []string{"", "order_service", "/api/v1/*"},
+		},
+		{
+			name:     "wildcard without segment",
+			req:      Request{Service: "order_service", API: "/api/v1"},
+			wantPath: []string{"", "order_service"},
+		},
+		{
+			name:     "user id",
+			req:      Request{Service: "order_service", API: "/api/v1/user", User: "10086"},
+			wantPath: []string{"", "order_service", "/api/v1/*", "10086"},
+		},
+		{
+			name: "first matched user label",
+			req: Request{Service: "order_service", API: "/api/v1/user", User: "1",
+				UserLabels: map[string]string{UserLabelGroup: "vip", UserLabelTier: "gold"}},
+			wantPath: []string{"", "order_service", "/api/v1/*", "tier:gold"},
+		},
+		{
+			name:     "any user",
+			req:      Request{Service: "order_service", API: "/api/v1/user", User: "1", IP: "10.1.1.1"},
+			wantPath: []string{"", "order_service", "/api/v1/*", "*"},
+		},
+		{
+			name:     "longest cidr",
+			req:      Request{Service: "order_service", API: "/api/v1/user", IP: "10.1.1.1"},
+			wantPath: []string{"", "order_service", "/api/v1/*", "10.1.0.0/16"},
+		},
+		{
+			name:     "cidr",
+			req:      Request{Service: "order_service", API: "/api/v1/user", IP: "10.2.1.1"},
+			wantPath: []string{"", "order_service", "/api/v1/*", "10.0.0.0/8"},
+		},
+		{
+			name:     "ipv6 cidr",
+			req:      Request{Service: "order_service", API: "/api/v1/user", IP: "2001:db8::1"},
+			wantPath: []string{"", "order_service", "/api/v1/*", "2001:db8::/32"},
+		},
+		{
+			name:     "ipv4-mapped ip",
+			req:      Request{Service: "order_service", API: "/api/v1/user", IP: "::ffff:10.1.1.1"},
+			wantPath: []string{"", "order_service", "/api/v1/*", "10.1.0.0/16"},
+		},
+		{
+			name:     "ipv4-mapped cidr",
+			req:      Request{Service: "order_service", API: "/api/v1/user", IP: "172.16.1.1"},
+			wantPath: []string{"", "order_service", "/api/v1/*", "::ffff:172.16.0.0/108"},
+		},
+		{
+			name:     "no matched ip",
+			req:      Request{Service: "order_service", API: "/api/v1/user", IP: "192.168.1.1"},
+			wantPath: []string{"", "order_service", "/api/v1/*"},
+		},
+		{
+			name:     "no matched api",
+			req:      Request{Service: "order_service", API: "/api/v2/user"},
+			wantPath: []string{"", "order_service"},
+		},
+		{
+			name:     "any service",
+			req:      Request{Service: "user_service", API: "/api/v1/user"},
+			wantPath: []string{"", "*"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := m.MatchPath(tc.req)
+			values := make([]string, 0, len(path))
+			for _, rt := range path {
+				values = append(values, rt.GetScope().Value)
+			}
+			assert.Equal(t, tc.wantPath, values)
+			assert.Equal(t, path[len(path)-1], m.Match(tc.req))
+		})
+	}
+}
+
+func TestScope_Valid_Pattern(t *testing.T) {
+	testCases := []struct {
+		name    string
+		scope   Scope
+		wantErr bool
+	}{
+		{name: "path template", scope: Scope{Type: ScopeTypeAPI, Value: "/api/v1/order/{id}/items"}},
+		{name: "path wildcard", scope: Scope{Type: ScopeTypeAPI, Value: "/api/v1/*"}},
+		{name: "path without slash", scope: Scope{Type: ScopeTypeAPI, Value: "api/v1"}, wantErr: true},
+		{name: "wildcard in middle", scope: Scope{Type: ScopeTypeAPI, Value: "/api/*/order"}, wantErr: true},
+		{name: "empty parameter", scope: Scope{Type: ScopeTypeAPI, Value: "/api/{}"}, wantErr: true},
+		{name: "broken parameter", scope: Scope{Type: ScopeTypeAPI, Value: "/api/{id"}, wantErr: true},
+		{name: "cidr", scope: Scope{Type: ScopeTypeIP, Value: "192.168.0.0/16"}},
+		{name: "ipv6", scope: Scope{Type: ScopeTypeIP, Value: "::1"}},
+		{name: "invalid cidr", scope: Scope{Type: ScopeTypeIP, Value: "192.168.0.0/33"}, wantErr: true},
+		{name: "user label", scope: Scope{Type: ScopeTypeUser, Value: "group:vip"}},
+		{name: "unknown user label", scope: Scope{Type: ScopeTypeUser, Value: "role:admin"}, wantErr: true},
+		{name: "empty user label", scope: Scope{Type: ScopeTypeUser, Value: "tier:"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.scope.valid()
+			assert.Equal(t, tc.wantErr, err != nil, fmt.Sprintf("err: %v", err))
+		})
+	}
+}
+
+func TestNewRuleMatcher_Duplicate(t *testing.T) {
+	trees, err := BuildRuleTrees(Rule{
+		Strategy:      StrategyQPS,
+		Period:        "1s",
+		Priority:      PriorityTypeLow,
+		BaseThreshold: 1000,
+		Children: []Rule{
+			{Scope: Scope{Type: ScopeTypeIP, Value: "10.0.0.1"}, BaseThreshold: 10},
+			{Scope: Scope{Type: ScopeTypeIP, Value: "10.0.0.1/32"}, BaseThreshold: 10},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = NewRuleMatcher(trees)
+	assert.ErrorIs(t, err, errDuplicateScope)
+	assert.ErrorContains(t, err, "rules.children[1].scope.value")
+}
+
+func BenchmarkRuleMatcher_Match(b *testing.B) {
+	children := make([]Rule, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		children = append(children, Rule{
+			Scope:         Scope{Type: ScopeTypeAPI, Value: fmt.Sprintf("/api/v1/resource%d/{id}", i)},
+			BaseThreshold: 10,
+		})
+	}
+	trees, err := BuildRuleTrees(Rule{
+		Strategy:      StrategyQPS,
+		Period:        "1s",
+		Priority:      PriorityTypeLow,
+		BaseThreshold: 1000,
+		Children:      children,
+	})
+	require.NoError(b, err)
+	m, err := NewRuleMatcher(trees)
+	require.NoError(b, err)
+
+	req := Request{API: "/api/v1/resource999/1001"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = m.Match(req)
+	}
+}
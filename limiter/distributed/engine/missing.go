@@ -0,0 +1,129 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MissingPolicy the policy to evaluate the condition whose metrics is not reported.
+type MissingPolicy string
+
+const (
+	// MissingPolicyError the condition fails with error, it aborts the whole
+	// trigger, it is the default policy.
+	MissingPolicyError MissingPolicy = "error"
+	// MissingPolicyFalse the condition is treated as false.
+	MissingPolicyFalse MissingPolicy = "false"
+	// MissingPolicyTrue the condition is treated as true.
+	MissingPolicyTrue MissingPolicy = "true"
+	// MissingPolicyLastKnown the condition uses the last known value of the
+	// metrics if it is not stale, otherwise fails with error.
+	MissingPolicyLastKnown MissingPolicy = "last_known"
+)
+
+func (m *MissingPolicy) String() string {
+	return string(*m)
+}
+
+func (m *MissingPolicy) valid() error {
+	switch *m {
+	case "", MissingPolicyError, MissingPolicyFalse, MissingPolicyTrue, MissingPolicyLastKnown:
+		return nil
+	default:
+		return fmt.Errorf("missing metrics policy %s not valid", *m)
+	}
+}
+
+// MetricsHistory the last known values of metrics, it is used by
+// MissingPolicyLastKnown to fill the metrics not reported.
+type MetricsHistory struct {
+	values map[string]metricsSample
+	mu     *sync.RWMutex
+}
+
+type metricsSample struct {
+	value float64
+	at    time.Time
+}
+
+func NewMetricsHistory() *MetricsHistory {
+	return &MetricsHistory{
+		values: map[string]metricsSample{},
+		mu:     new(sync.RWMutex),
+	}
+}
+
+// Record save the reported fields of metrics as the last known values.
+func (h *MetricsHistory) Record(m Metrics) {
+	at := m.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name := range metricsMap {
+		if v, ok := m.Get(name); ok {
+			h.values[name] = metricsSample{value: v, at: at}
+		}
+	}
+}
+
+// Get return the last known value of metrics field and the time it reported.
+func (h *MetricsHistory) Get(field string) (float64, time.Time, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	s, ok := h.values[field]
+	return s.value, s.at, ok
+}
+
+// missing resolve the condition whose metrics is not reported according
+// to the policy, it returns the last known value if found, otherwise the
+// forced result of the condition.
+func (ctx EvalContext) missing(field string) (value float64, found bool, result bool, err error) {
+	switch ctx.policy {
+	case MissingPolicyTrue:
+		return 0, false, true, nil
+	case MissingPolicyFalse:
+		return 0, false, false, nil
+	case MissingPolicyLastKnown:
+		if ctx.history == nil {
+			return 0, false, false, fmt.Errorf("trigger field %s not exist metrics and no history", field)
+		}
+
+		v, at, ok := ctx.history.Get(field)
+		if !ok {
+			return 0, false, false, fmt.Errorf("trigger field %s not exist metrics and no history", field)
+		}
+
+		now := ctx.now
+		if now.IsZero() {
+			now = time.Now()
+		}
+		if ctx.ttl > 0 && now.Sub(at) > ctx.ttl {
+			return 0, false, false, fmt.Errorf("trigger field %s not exist metrics and last known value is stale for %s",
+				field, now.Sub(at))
+		}
+
+		return v, true, false, nil
+	default:
+		return 0, false, false, fmt.Errorf("trigger field %s not exist metrics", field)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_Reported(t *testing.T) {
+	// the legacy producers do not set Reported, all fields are reported.
+	m := Metrics{CPUUsage: 0.5}
+	v, ok := m.Get("mem_usage")
+	assert.True(t, ok)
+	assert.Equal(t, float64(0), v)
+
+	// the zero value is reported explicitly.
+	m = Metrics{}
+	assert.NoError(t, m.Set("cpu_usage", 0))
+	v, ok = m.Get("cpu_usage")
+	assert.True(t, ok)
+	assert.Equal(t, float64(0), v)
+	_, ok = m.Get("mem_usage")
+	assert.False(t, ok)
+
+	// the tracked sample reports nothing, it is not the legacy one.
+	m = Metrics{Tracked: true}
+	_, ok = m.Get("cpu_usage")
+	assert.False(t, ok)
+
+	assert.Error(t, m.Set("unknown", 1))
+}
+
+func TestCondition_Evaluate_MissingPolicy(t *testing.T) {
+	expr, err := parseTrigger("cpu_usage > 0.8 OR mem_usage > 0.8")
+	assert.NoError(t, err)
+
+	now := time.Now()
+	history := NewMetricsHistory()
+	history.Record(Metrics{MemUsage: 0.9, Reported: MetricsMemUsage, Timestamp: now.Add(-5 * time.Second)})
+
+	sample := Metrics{}
+	assert.NoError(t, sample.Set("cpu_usage", 0.5))
+	sample.Timestamp = now
+
+	testCases := []struct {
+		name    string
+		policy  MissingPolicy
+		ttl     time.Duration
+		wantRes bool
+		wantErr error
+	}{
+		{
+			name:    "default error",
+			policy:  "",
+			wantErr: fmt.Errorf("trigger field mem_usage not exist metrics"),
+		},
+		{
+			name:    "treat as false",
+			policy:  MissingPolicyFalse,
+			wantRes: false,
+		},
+		{
+			name:    "treat as true",
+			policy:  MissingPolicyTrue,
+			wantRes: true,
+		},
+		{
+			name:    "last known value",
+			policy:  MissingPolicyLastKnown,
+			ttl:     10 * time.Second,
+			wantRes: true,
+		},
+		{
+			name:    "stale last known value",
+			policy:  MissingPolicyLastKnown,
+			ttl:     time.Second,
+			wantErr: fmt.Errorf("trigger field mem_usage not exist metrics and last known value is stale for 5s"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := NewEvalContext(sample).WithMissingPolicy(tc.policy, history, tc.ttl)
+			res, err := expr.Evaluate(ctx)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantRes, res)
+
+			trace := expr.Explain(ctx)
+			assert.Equal(t, tc.wantErr, trace.Err)
+			assert.Equal(t, tc.wantRes, trace.Result)
+			t.Logf("trace: %s", trace)
+		})
+	}
+}
+
+func TestRule_Check_MissingPolicy(t *testing.T) {
+	cfg := Conf{
+		RedisCluster: RedisCluster{Addr: []string{"127.0.0.1:6379"}},
+		Rules: Rule{
+			BaseThreshold: 1000,
+			Children: []Rule{
+				{
+					Scope:         Scope{Type: ScopeTypeService, Value: "order_service"},
+					BaseThreshold: 1000,
+					Strategy:      StrategyQPS,
+					Period:        "1s",
+					Priority:      PriorityTypeHigh,
+					Trigger:       "cpu_usage > 0.8",
+					MissingPolicy: MissingPolicyLastKnown,
+				},
+				{
+					Scope:         Scope{Type: ScopeTypeService, Value: "user_service"},
+					BaseThreshold: 1000,
+					Strategy:      StrategyQPS,
+					Period:        "1s",
+					Priority:      PriorityTypeHigh,
+					MissingPolicy: "ignore",
+				},
+			},
+		},
+	}
+
+	var errs CheckErrors
+	assert.True(t, errors.As(cfg.Check(), &errs))
+	assert.Len(t, errs, 2)
+	assert.Equal(t, "rules.children[0].stale_ttl", errs[0].Path)
+	assert.Equal(t, "rules.children[1].missing_policy", errs[1].Path)
+}
@@ -15,7 +15,6 @@
 package engine
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"time"
@@ -25,9 +24,7 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"golang.org/x/net/context"
 
-	"github.com/BurntSushi/toml"
 	"github.com/TimeWtr/gox/errorx"
-	"gopkg.in/yaml.v3"
 )
 
 type ConfSourceType string
@@ -198,14 +195,16 @@ func NewYamlParser(bs []byte) Parser {
 	}
 }
 
+// Parse decode the yaml data strictly, the unknown fields are rejected and
+// the errors are reported with line numbers.
 func (y *YamlParser) Parse() (Conf, error) {
 	var cfg Conf
-	err := yaml.Unmarshal(y.bs, &cfg)
+	pos, err := decodeYAML(y.bs, &cfg)
 	if err != nil {
 		return Conf{}, err
 	}
 
-	return cfg, cfg.Check()
+	return resolve(cfg, pos)
 }
 
 // JsonParser json parser to parse json type data.
@@ -219,14 +218,16 @@ func NewJsonParser(bs []byte) Parser {
 	}
 }
 
+// Parse decode the json data strictly, the unknown fields are rejected and
+// the errors are reported with line numbers.
 func (j *JsonParser) Parse() (Conf, error) {
 	var cfg Conf
-	err := json.Unmarshal(j.bs, &cfg)
+	pos, err := decodeJSON(j.bs, &cfg)
 	if err != nil {
 		return Conf{}, err
 	}
 
-	return cfg, cfg.Check()
+	return resolve(cfg, pos)
 }
 
 // TomlParser toml parser to parse toml type data.
@@ -240,12 +241,21 @@ func NewTomlParser(bs []byte) Parser {
 	}
 }
 
+// Parse decode the toml data strictly, the unknown fields are rejected
+// with the line numbers.
 func (t *TomlParser) Parse() (Conf, error) {
 	var cfg Conf
-	err := toml.Unmarshal(t.bs, &cfg)
-	if err != nil {
+	if err := decodeTOML(t.bs, &cfg); err != nil {
 		return Conf{}, err
 	}
 
-	return cfg, cfg.Check()
+	return resolve(cfg, nil)
+}
+
+// resolve check the Conf parsed and resolve it, the errors are located in
+// the source document by pos.
+func resolve(cfg Conf, pos positions) (Conf, error) {
+	err := pos.annotate(cfg.Check())
+	cfg.Resolve()
+	return cfg, err
 }
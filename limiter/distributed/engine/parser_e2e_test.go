@@ -15,193 +15,158 @@
 package engine
 
 var jsonContent = `{
-  "base_threshold":1000,
-  "min_threshold": 300,
-  "strategy": "qps",
-  "period": "1s",
-  "priority": "high",
-  "rules": [
-    {
-      "scope":{
-        "type": "service",
-        "value": "order_service"
-      },
-      "base_threshold":1000,
-      "min_threshold": 300,
-      "strategy": "qps",
-      "priority": "medium",
-      "period": "1s",
-      "trigger": [
-        {
-          "metric": "cpu_usage",
-          "threshold": 0.8
+  "redis_cluster": {
+    "addr": ["127.0.0.1:6379"]
+  },
+  "defaults": {
+    "strategy": "qps",
+    "period": "1s",
+    "priority": "low"
+  },
+  "rules": {
+    "base_threshold": 1000,
+    "min_threshold": 300,
+    "priority": "high",
+    "children": [
+      {
+        "scope":{
+          "type": "service",
+          "value": "order_service"
         },
-        {
-          "metric": "mem_usage",
-          "threshold": 0.8
-        },
-        {
-          "metric": "err_rate",
-          "threshold": 0.2
-        }
-      ],
-      "children": [
-        {
-          "scope": {
-            "type": "api",
-            "value": "/api/v1/order"
-          },
-          "base_threshold": 500,
-          "min_threshold": 100,
-          "strategy": "concurrency",
-          "priority": "low",
-          "period": "1s"
-        },
-        {
-          "scope": {
-            "type": "api",
-            "value": "/api/v1/user"
+        "base_threshold":1000,
+        "min_threshold": 300,
+        "priority": "medium",
+        "trigger": "cpu_usage > 0.8 OR mem_usage > 0.8 OR err_rate > 0.2",
+        "children": [
+          {
+            "scope": {
+              "type": "api",
+              "value": "/api/v1/order"
+            },
+            "base_threshold": 500,
+            "min_threshold": 100,
+            "strategy": "concurrency"
           },
-          "base_threshold": 300,
-          "min_threshold": 100,
-          "strategy": "qps",
-          "priority": "low",
-          "period": "1s",
-          "children": [
-            {
-              "scope": {
-                "type": "user",
-                "value": "*"
-              },
-              "base_threshold": 5,
-              "strategy": "total",
-              "priority": "low",
-              "period": "1m"
+          {
+            "scope": {
+              "type": "api",
+              "value": "/api/v1/user"
             },
-            {
-              "scope": {
-                "type": "ip",
-                "value": "*"
+            "base_threshold": 300,
+            "min_threshold": 100,
+            "children": [
+              {
+                "scope": {
+                  "type": "user",
+                  "value": "*"
+                },
+                "base_threshold": 5,
+                "strategy": "total",
+                "period": "1m"
               },
-              "base_threshold": 5,
-              "priority": "low",
-              "strategy": "total",
-              "period": "1m"
-            }
-          ]
-        }
-      ]
-    }
-  ]
+              {
+                "scope": {
+                  "type": "ip",
+                  "value": "*"
+                },
+                "base_threshold": 5,
+                "strategy": "total",
+                "period": "1m"
+              }
+            ]
+          }
+        ]
+      }
+    ]
+  }
 }
 `
 
-var yamlContent = `base_threshold: 1000
-min_threshold: 300
-strategy: qps
-period: 1s
-priority: high
+var yamlContent = `redis_cluster:
+  addr:
+    - 127.0.0.1:6379
+defaults:
+  strategy: qps
+  period: 1s
+  priority: low
 rules:
-  - scope:
-      type: service
-      value: order_service
-    base_threshold: 1000
-    min_threshold: 300
-    strategy: qps
-    priority: medium
-    period: 1s
-    trigger:
-      - metric: cpu_usage
-        threshold: 0.8
-      - metric: mem_usage
-        threshold: 0.8
-      - metric: err_rate
-        threshold: 0.2
-    children:
-      - scope:
-          type: api
-          value: /api/v1/order
-        base_threshold: 500
-        min_threshold: 100
-        strategy: concurrency
-        priority: low
-        period: 1s
-      - scope:
-          type: api
-          value: /api/v1/user
-        base_threshold: 300
-        min_threshold: 100
-        strategy: qps
-        priority: low
-        period: 1s
-        children:
-          - scope:
-              type: user
-              value: "*"
-            base_threshold: 5
-            strategy: total
-            priority: low
-            period: 1m
-          - scope:
-              type: ip
-              value: "*"
-            base_threshold: 5
-            priority: low
-            strategy: total
-            period: 1m`
+  base_threshold: 1000
+  min_threshold: 300
+  priority: high
+  children:
+    - scope:
+        type: service
+        value: order_service
+      base_threshold: 1000
+      min_threshold: 300
+      priority: medium
+      trigger: cpu_usage > 0.8 OR mem_usage > 0.8 OR err_rate > 0.2
+      children:
+        - scope:
+            type: api
+            value: /api/v1/order
+          base_threshold: 500
+          min_threshold: 100
+          strategy: concurrency
+        - scope:
+            type: api
+            value: /api/v1/user
+          base_threshold: 300
+          min_threshold: 100
+          children:
+            - scope:
+                type: user
+                value: "*"
+              base_threshold: 5
+              strategy: total
+              period: 1m
+            - scope:
+                type: ip
+                value: "*"
+              base_threshold: 5
+              strategy: total
+              period: 1m`
 
-var tomlContent = `base_threshold = 1000
-min_threshold = 300
+var tomlContent = `[redis_cluster]
+addr = ["127.0.0.1:6379"]
+
+[defaults]
 strategy = "qps"
 period = "1s"
+priority = "low"
+
+[rules]
+base_threshold = 1000
+min_threshold = 300
 priority = "high"
-[[rules]]
+
+[[rules.children]]
 scope = { type = "service", value = "order_service" }
 base_threshold = 1000
 min_threshold = 300
-strategy = "qps"
 priority = "medium"
-period = "1s"
-
-[[rules.trigger]]
-metric = "cpu_usage"
-threshold = 0.8
+trigger = "cpu_usage > 0.8 OR mem_usage > 0.8 OR err_rate > 0.2"
 
-[[rules.trigger]]
-metric = "mem_usage"
-threshold = 0.8
-
-[[rules.trigger]]
-metric = "err_rate"
-threshold = 0.2
-
-[[rules.children]]
+[[rules.children.children]]
 scope = { type = "api", value = "/api/v1/order" }
 base_threshold = 500
 min_threshold = 100
 strategy = "concurrency"
-priority = "low"
-period = "1s"
 
-[[rules.children]]
+[[rules.children.children]]
 scope = { type = "api", value = "/api/v1/user" }
 base_threshold = 300
 min_threshold = 100
-strategy = "qps"
-priority = "low"
-period = "1s"
 
-[[rules.children.children]]
+[[rules.children.children.children]]
 scope = { type = "user", value = "*" }
 base_threshold = 5
 strategy = "total"
-priority = "low"
 period = "1m"
 
-[[rules.children.children]]
+[[rules.children.children.children]]
 scope = { type = "ip", value = "*" }
 base_threshold = 5
-priority = "low"
 strategy = "total"
 period = "1m"`
 
@@ -17,21 +17,8 @@ package engine
 import (
 	"errors"
 	"fmt"
-
-	"golang.org/x/sync/errgroup"
-
-	_ "golang.org/x/sync/errgroup"
-)
-
-const (
-	// ScopeTypeService type is service
-	ScopeTypeService = "service"
-	// ScopeTypeAPI type is api
-	ScopeTypeAPI = "api"
-	// ScopeTypeUser type is user
-	ScopeTypeUser = "user"
-	// ScopeTypeIP type is ip
-	ScopeTypeIP = "ip"
+	"strings"
+	"time"
 )
 
 type PriorityType string
@@ -80,6 +67,29 @@ func (s *StrategyType) valid() error {
 	}
 }
 
+// ModeType the enforcement mode of rule, the shadow rule evaluates the
+// limiters and trigger and records the would-reject decisions, but it
+// always admits the request and never adjusts the rate.
+type ModeType string
+
+const (
+	ModeEnforce ModeType = "enforce"
+	ModeShadow  ModeType = "shadow"
+)
+
+func (m *ModeType) String() string {
+	return string(*m)
+}
+
+func (m *ModeType) valid() error {
+	switch *m {
+	case "", ModeEnforce, ModeShadow:
+		return nil
+	default:
+		return fmt.Errorf("mode %s not valid", *m)
+	}
+}
+
 type PeriodType string
 
 func (p *PeriodType) String() string {
@@ -97,32 +107,142 @@ func (p *PeriodType) valid() error {
 
 type Conf struct {
 	RedisCluster RedisCluster `json:"redis_cluster" toml:"redis_cluster" yaml:"redis_cluster"`
+	Defaults     Defaults     `json:"defaults,omitempty" yaml:"defaults,omitempty" toml:"defaults,omitempty"`
 	Rules        Rule         `json:"rules" yaml:"rules" toml:"rules"`
 }
 
+// Defaults the default values of rule fields, the root rule inherits the
+// unset fields from defaults, and every child rule inherits the unset
+// fields from its parent.
+type Defaults struct {
+	Strategy      StrategyType  `json:"strategy,omitempty" yaml:"strategy,omitempty" toml:"strategy,omitempty"`
+	Period        PeriodType    `json:"period,omitempty" yaml:"period,omitempty" toml:"period,omitempty"`
+	Priority      PriorityType  `json:"priority,omitempty" yaml:"priority,omitempty" toml:"priority,omitempty"`
+	Algorithm     AlgorithmType `json:"algorithm,omitempty" yaml:"algorithm,omitempty" toml:"algorithm,omitempty"`
+	MissingPolicy MissingPolicy `json:"missing_policy,omitempty" yaml:"missing_policy,omitempty" toml:"missing_policy,omitempty"`
+	StaleTTL      PeriodType    `json:"stale_ttl,omitempty" yaml:"stale_ttl,omitempty" toml:"stale_ttl,omitempty"`
+	Mode          ModeType      `json:"mode,omitempty" yaml:"mode,omitempty" toml:"mode,omitempty"`
+}
+
+func (d *Defaults) rule() *Rule {
+	return &Rule{
+		Strategy:      d.Strategy,
+		Period:        d.Period,
+		Priority:      d.Priority,
+		Algorithm:     d.Algorithm,
+		MissingPolicy: d.MissingPolicy,
+		StaleTTL:      d.StaleTTL,
+		Mode:          d.Mode,
+	}
+}
+
+// Check validate the whole Conf and report every error found in the rule tree,
+// the returned error is CheckErrors if any rule is invalid. The rules are
+// validated as resolved, but Conf is never modified, see Resolve.
 func (c *Conf) Check() error {
+	var errs CheckErrors
 	if err := c.RedisCluster.Check(); err != nil {
-		return err
+		errs.add("redis_cluster", err)
 	}
+	c.checkRules(&errs)
 
-	if c.Rules.Children == nil {
+	if len(errs) == 0 {
 		return nil
 	}
 
-	// fast path
-	if len(c.Rules.Children) == 1 {
-		return c.Rules.Children[0].check()
+	return errs
+}
+
+// checkRules validate the rules resolved by the defaults.
+func (c *Conf) checkRules(errs *CheckErrors) {
+	// the root rule has no scope, it holds the global threshold only.
+	rules := c.Rules.clone()
+	root := &rules
+	root.inherit(c.Defaults.rule())
+	if err := root.resolveTrigger(); err != nil {
+		errs.add("rules.trigger", err)
+	}
+	if err := root.Mode.valid(); err != nil {
+		errs.add("rules.mode", err)
+	}
+	root.checkThreshold("rules", nil, errs)
+
+	for i := range root.Children {
+		root.Children[i].check(fmt.Sprintf("rules.children[%d]", i), root, errs)
 	}
+}
 
-	// low path
-	var eg errgroup.Group
-	for _, rule := range c.Rules.Children {
-		eg.Go(func() error {
-			return rule.check()
-		})
+// Resolve fill the unset fields of the rules, the root rule inherits from
+// the defaults and every child rule inherits from its parent, and sync the
+// trigger and trigger ast of every rule. The Conf parsed is resolved
+// already, the invalid fields are kept as is and reported by Check.
+func (c *Conf) Resolve() {
+	c.Rules.resolve(c.Defaults.rule())
+}
+
+// RuleTrees build the rule trees of Conf, the root rule inherits the unset
+// fields from the defaults. The rules are validated the same as Check, the
+// error is CheckErrors if any rule is invalid.
+func (c *Conf) RuleTrees() ([]RuleTree, error) {
+	var errs CheckErrors
+	if c.checkRules(&errs); len(errs) > 0 {
+		return nil, errs
+	}
+
+	return builder(c.Rules, c.Defaults.rule(), "rules")
+}
+
+// FieldError the error of the invalid field in Conf, Path locates the field
+// in the rule tree, such as rules.children[1].trigger, Line and Column
+// locate the field in the source document, zero if unknown.
+type FieldError struct {
+	Path   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (f *FieldError) Error() string {
+	var sb strings.Builder
+	if f.Line > 0 {
+		_, _ = fmt.Fprintf(&sb, "line %d:%d: ", f.Line, f.Column)
+	}
+	if f.Path != "" {
+		sb.WriteString(f.Path)
+		sb.WriteString(": ")
 	}
+	sb.WriteString(f.Err.Error())
 
-	return eg.Wait()
+	return sb.String()
+}
+
+func (f *FieldError) Unwrap() error {
+	return f.Err
+}
+
+// CheckErrors all the errors found while checking Conf.
+type CheckErrors []*FieldError
+
+func (c *CheckErrors) add(path string, err error) {
+	*c = append(*c, &FieldError{Path: path, Err: err})
+}
+
+func (c CheckErrors) Error() string {
+	msgs := make([]string, 0, len(c))
+	for _, err := range c {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+func (c CheckErrors) Unwrap() []error {
+	errs := make([]error, 0, len(c))
+	for _, err := range c {
+		errs = append(errs, err)
+	}
+
+	return errs
 }
 
 type RedisCluster struct {
@@ -145,95 +265,176 @@ type Rule struct {
 	Period        PeriodType    `json:"period" yaml:"period" toml:"period"`
 	Priority      PriorityType  `json:"priority" yaml:"priority" toml:"priority"`
 	Trigger       TriggerType   `json:"trigger,omitempty" yaml:"trigger,omitempty" toml:"trigger,omitempty"`
-	TriggerAST    Expr          `json:"-"` // parse and generate ast
+	TriggerAST    *AST          `json:"trigger_ast,omitempty" yaml:"trigger_ast,omitempty" toml:"-"` // parse and generate ast
 	Algorithm     AlgorithmType `json:"algorithm,omitempty" yaml:"algorithm,omitempty" toml:"algorithm,omitempty"`
+	MissingPolicy MissingPolicy `json:"missing_policy,omitempty" yaml:"missing_policy,omitempty" toml:"missing_policy,omitempty"` // default is error
+	StaleTTL      PeriodType    `json:"stale_ttl,omitempty" yaml:"stale_ttl,omitempty" toml:"stale_ttl,omitempty"`                // max age of last known metrics
+	Mode          ModeType      `json:"mode,omitempty" yaml:"mode,omitempty" toml:"mode,omitempty"`                               // default is enforce
 	Children      []Rule        `json:"children" yaml:"children" toml:"children"`
 }
 
-func (r *Rule) check() error {
+// check validate the rule and its children, all errors are collected into errs
+// with the rule path as prefix. the unset fields are inherited from parent
+// before validating.
+func (r *Rule) check(path string, parent *Rule, errs *CheckErrors) {
+	r.inherit(parent)
+
 	// check scope type
-	err := r.Scope.valid()
-	if err != nil {
-		return err
+	if err := r.Scope.valid(); err != nil {
+		errs.add(path+".scope", err)
 	}
 
 	// check strategy value
-	err = r.Strategy.valid()
-	if err != nil {
-		return err
+	if err := r.Strategy.valid(); err != nil {
+		errs.add(path+".strategy", err)
 	}
 
 	// check period value
-	err = r.Period.valid()
-	if err != nil {
-		return err
+	if err := r.Period.valid(); err != nil {
+		errs.add(path+".period", err)
 	}
 
 	// check rule's priority value valid
-	err = r.Priority.valid()
-	if err != nil {
-		return err
+	if err := r.Priority.valid(); err != nil {
+		errs.add(path+".priority", err)
 	}
 
 	// check algorithm value valid
-	if r.Scope.Value == ScopeTypeUser || r.Scope.Value == ScopeTypeIP {
-		if err = r.Algorithm.Valid(r.Scope.Value); err != nil {
-			return err
-		}
-	} else {
-		if err = r.Algorithm.Valid(); err != nil {
-			return err
-		}
+	if err := r.Algorithm.Valid(r.Scope.Type); err != nil {
+		errs.add(path+".algorithm", err)
 	}
 
 	// check limit trigger
-	if len(r.Trigger) != 0 {
-		if err = r.Trigger.valid(); err != nil {
-			return err
+	if err := r.resolveTrigger(); err != nil {
+		errs.add(path+".trigger", err)
+	}
+
+	// check missing metrics policy
+	if err := r.MissingPolicy.valid(); err != nil {
+		errs.add(path+".missing_policy", err)
+	}
+	if r.MissingPolicy == MissingPolicyLastKnown && r.StaleTTL == "" {
+		errs.add(path+".stale_ttl", errors.New("stale ttl must be set if missing policy is last_known"))
+	}
+	if r.StaleTTL != "" {
+		if err := r.StaleTTL.valid(); err != nil {
+			errs.add(path+".stale_ttl", err)
 		}
 	}
 
-	if r.Children == nil {
-		return nil
+	// check enforcement mode
+	if err := r.Mode.valid(); err != nil {
+		errs.add(path+".mode", err)
 	}
 
-	for _, child := range r.Children {
-		err = child.check()
-		if err != nil {
-			return err
-		}
+	// check thresholds
+	r.checkThreshold(path, parent, errs)
+
+	for i := range r.Children {
+		r.Children[i].check(fmt.Sprintf("%s.children[%d]", path, i), r, errs)
 	}
+}
 
-	return nil
+// checkThreshold the min threshold must not exceed the base threshold, and the
+// thresholds of rule must not exceed the thresholds of its parent.
+func (r *Rule) checkThreshold(path string, parent *Rule, errs *CheckErrors) {
+	if r.MinThreshold > r.BaseThreshold {
+		errs.add(path+".min_threshold", fmt.Errorf("min threshold %d exceeds base threshold %d",
+			r.MinThreshold, r.BaseThreshold))
+	}
+
+	if parent == nil {
+		return
+	}
+
+	if parent.BaseThreshold != 0 && r.BaseThreshold > parent.BaseThreshold {
+		errs.add(path+".base_threshold", fmt.Errorf("base threshold %d exceeds parent base threshold %d",
+			r.BaseThreshold, parent.BaseThreshold))
+	}
+
+	if parent.MinThreshold != 0 && r.MinThreshold > parent.MinThreshold {
+		errs.add(path+".min_threshold", fmt.Errorf("min threshold %d exceeds parent min threshold %d",
+			r.MinThreshold, parent.MinThreshold))
+	}
 }
 
-type Scope struct {
-	Type  string `json:"type" yaml:"type" toml:"type"`
-	Value string `json:"value" yaml:"value" toml:"value"`
+// resolve fill the unset fields of rule and its children from parent.
+func (r *Rule) resolve(parent *Rule) {
+	r.inherit(parent)
+	// the invalid trigger is reported by Check.
+	_ = r.resolveTrigger()
+
+	for i := range r.Children {
+		r.Children[i].resolve(r)
+	}
 }
 
-func (s *Scope) valid() error {
-	switch s.Type {
-	case ScopeTypeService:
-		if s.Value == "" {
-			return fmt.Errorf("service scope must have a value")
-		}
-	case ScopeTypeAPI:
-		if s.Value == "" {
-			return fmt.Errorf("api scope must have a value")
-		}
-	case ScopeTypeUser:
-		if s.Value == "" {
-			return fmt.Errorf("user scope must have a value")
+// clone return the deep copy of rule, the children are copied too.
+func (r *Rule) clone() Rule {
+	cp := *r
+	if r.Children != nil {
+		cp.Children = make([]Rule, len(r.Children))
+		for i := range r.Children {
+			cp.Children[i] = r.Children[i].clone()
 		}
-	case ScopeTypeIP:
-		if s.Value == "" {
-			return fmt.Errorf("ip scope must have a value")
-		}
-	default:
-		return errors.New("unknown scope type")
 	}
 
+	return cp
+}
+
+// inherit fill the unset fields of rule from parent, the scope, thresholds,
+// trigger and children are never inherited.
+func (r *Rule) inherit(parent *Rule) {
+	if parent == nil {
+		return
+	}
+
+	if r.Strategy == "" {
+		r.Strategy = parent.Strategy
+	}
+	if r.Period == "" {
+		r.Period = parent.Period
+	}
+	if r.Priority == "" {
+		r.Priority = parent.Priority
+	}
+	if r.Algorithm == "" {
+		r.Algorithm = parent.Algorithm
+	}
+	if r.MissingPolicy == "" {
+		r.MissingPolicy = parent.MissingPolicy
+	}
+	if r.StaleTTL == "" {
+		r.StaleTTL = parent.StaleTTL
+	}
+	if r.Mode == "" {
+		r.Mode = parent.Mode
+	}
+}
+
+// resolveTrigger keep Trigger and TriggerAST in sync, the ast is generated from
+// the trigger if only the trigger is set, and the canonical trigger is
+// formatted from the ast if only the ast is set, such as edited by control plane.
+func (r *Rule) resolveTrigger() error {
+	hasAST := r.TriggerAST != nil && r.TriggerAST.Expr != nil
+	switch {
+	case len(r.Trigger) == 0 && !hasAST:
+		return nil
+	case len(r.Trigger) == 0:
+		r.Trigger = TriggerType(FormatTrigger(r.TriggerAST))
+		return nil
+	}
+
+	expr, err := r.Trigger.parse()
+	if err != nil {
+		return err
+	}
+
+	if hasAST && FormatTrigger(expr) != FormatTrigger(r.TriggerAST) {
+		return fmt.Errorf("trigger %q mismatches trigger_ast %q", r.Trigger, FormatTrigger(r.TriggerAST))
+	}
+	r.TriggerAST = NewAST(expr)
+
 	return nil
 }
 
@@ -244,15 +445,24 @@ func (s *Scope) valid() error {
 
 type TriggerType string
 
-func (t *TriggerType) valid() error {
-	//_, ok := metricsMap[t.Metric]
-	//if !ok {
-	//	return fmt.Errorf("metric `%s` is not supported", t.Metric)
-	//}
-	//
-	return nil
+// parse parse the trigger expression to ast, the error is *SyntaxError if
+// the expression is invalid.
+func (t *TriggerType) parse() (Expr, error) {
+	return parseTrigger(string(*t))
 }
 
+// MetricsField the bit flag of Metrics field, it marks the fields reported.
+type MetricsField uint8
+
+const (
+	MetricsCPUUsage MetricsField = 1 << iota
+	MetricsMemUsage
+	MetricsMemUsed
+	MetricsRequestLatency
+	MetricsErrRate
+	MetricsActiveConns
+)
+
 type Metrics struct {
 	// used cpu percent,
 	CPUUsage float64 `json:"cpu_usage,omitempty"`
@@ -266,16 +476,87 @@ type Metrics struct {
 	ErrRate float64 `json:"err_rate,omitempty"`
 	// current active connections.
 	ActiveConns uint64 `json:"active_conns,omitempty"`
+	// the fields reported in this sample, it distinguishes the zero value
+	// from not reported.
+	Reported MetricsField `json:"reported,omitempty"`
+	// whether Reported is tracked, it is set by Set. The sample neither
+	// tracked nor reporting any field is from the legacy producers, all
+	// the fields are regarded as reported.
+	Tracked bool `json:"tracked,omitempty"`
+	// the time of sampling, zero means now.
+	Timestamp time.Time `json:"timestamp,omitempty"`
+}
+
+// Set set the metrics field by the trigger field name and mark it reported.
+func (m *Metrics) Set(field string, value float64) error {
+	m.Tracked = true
+	switch field {
+	case "cpu_usage":
+		m.CPUUsage = value
+		m.Reported |= MetricsCPUUsage
+	case "mem_usage":
+		m.MemUsage = value
+		m.Reported |= MetricsMemUsage
+	case "mem_used":
+		m.MemUsed = uint64(value)
+		m.Reported |= MetricsMemUsed
+	case "request_latency":
+		m.RequestLatency = value
+		m.Reported |= MetricsRequestLatency
+	case "err_rate":
+		m.ErrRate = value
+		m.Reported |= MetricsErrRate
+	case "active_conns":
+		m.ActiveConns = uint64(value)
+		m.Reported |= MetricsActiveConns
+	default:
+		return fmt.Errorf("unknown metrics field %s", field)
+	}
+
+	return nil
+}
+
+// Get get the metrics field by the trigger field name, it returns false if
+// the field is not reported.
+func (m Metrics) Get(field string) (float64, bool) {
+	var flag MetricsField
+	var value float64
+	switch field {
+	case "cpu_usage":
+		flag, value = MetricsCPUUsage, m.CPUUsage
+	case "mem_usage":
+		flag, value = MetricsMemUsage, m.MemUsage
+	case "mem_used":
+		flag, value = MetricsMemUsed, float64(m.MemUsed)
+	case "request_latency":
+		flag, value = MetricsRequestLatency, m.RequestLatency
+	case "err_rate":
+		flag, value = MetricsErrRate, m.ErrRate
+	case "active_conns":
+		flag, value = MetricsActiveConns, float64(m.ActiveConns)
+	default:
+		return 0, false
+	}
+
+	if (m.Tracked || m.Reported != 0) && m.Reported&flag == 0 {
+		return 0, false
+	}
+
+	return value, true
 }
 
 type RuleTreeInter interface {
 	GetScope() Scope
 	GetBaseThreshold() uint64
 	GetMinThreshold() uint64
+	GetStrategy() StrategyType
 	GetPeriod() PeriodType
 	GetPriority() PriorityType
 	GetTriggerAST() Expr
 	GetAlgorithm() AlgorithmType
+	GetMissingPolicy() MissingPolicy
+	GetStaleTTL() time.Duration
+	GetMode() ModeType
 	GetChildren() []RuleTree
 }
 
@@ -290,6 +571,9 @@ type RuleTree struct {
 	priority      PriorityType
 	triggerAST    Expr
 	algorithm     AlgorithmType
+	missingPolicy MissingPolicy
+	staleTTL      time.Duration
+	mode          ModeType
 	children      []RuleTree
 }
 
@@ -305,6 +589,10 @@ func (r *RuleTree) GetMinThreshold() uint64 {
 	return r.minThreshold
 }
 
+func (r *RuleTree) GetStrategy() StrategyType {
+	return r.strategy
+}
+
 func (r *RuleTree) GetPeriod() PeriodType {
 	return r.period
 }
@@ -321,20 +609,63 @@ func (r *RuleTree) GetAlgorithm() AlgorithmType {
 	return r.algorithm
 }
 
+func (r *RuleTree) GetMissingPolicy() MissingPolicy {
+	return r.missingPolicy
+}
+
+func (r *RuleTree) GetStaleTTL() time.Duration {
+	return r.staleTTL
+}
+
+// GetMode return the enforcement mode of rule, ModeEnforce if not set.
+func (r *RuleTree) GetMode() ModeType {
+	if r.mode == "" {
+		return ModeEnforce
+	}
+
+	return r.mode
+}
+
+// IsShadow report whether the rule is in shadow mode.
+func (r *RuleTree) IsShadow() bool {
+	return r.GetMode() == ModeShadow
+}
+
 func (r *RuleTree) GetChildren() []RuleTree {
 	return r.children
 }
 
-// BuildRuleTrees the method to build the rule trees.
+// FindRuleTree find the rule tree node whose scope value is latitude in
+// depth first order, it returns nil if not found.
+func FindRuleTree(trees []RuleTree, latitude string) *RuleTree {
+	for i := range trees {
+		if trees[i].scope.Value == latitude {
+			return &trees[i]
+		}
+
+		if rt := FindRuleTree(trees[i].children, latitude); rt != nil {
+			return rt
+		}
+	}
+
+	return nil
+}
+
+// BuildRuleTrees the method to build the rule trees, the children inherit
+// the unset fields from their parent. It is Conf.RuleTrees of the rules
+// without defaults, so that the rules are validated the same as Check.
 func BuildRuleTrees(r Rule) ([]RuleTree, error) {
-	return builder(r)
+	c := Conf{Rules: r}
+	return c.RuleTrees()
 }
 
-func builder(rs Rule) ([]RuleTree, error) {
+func builder(rs Rule, parent *Rule, path string) ([]RuleTree, error) {
 	if rs.BaseThreshold == 0 {
 		return nil, errors.New("rule must not be nil")
 	}
 
+	rs.inherit(parent)
+
 	var trees []RuleTree
 
 	rt := &RuleTree{
@@ -344,23 +675,34 @@ func builder(rs Rule) ([]RuleTree, error) {
 		strategy:      rs.Strategy,
 		period:        rs.Period,
 		priority:      rs.Priority,
+		algorithm:     rs.Algorithm,
+		missingPolicy: rs.MissingPolicy,
+		mode:          rs.Mode,
 	}
 
-	if rs.Trigger != "" {
-		expr, err := parseTrigger(string(rs.Trigger))
+	if rs.StaleTTL != "" {
+		ttl, err := parseTime(string(rs.StaleTTL))
 		if err != nil {
-			return nil, err
+			return nil, &FieldError{Path: path + ".stale_ttl", Err: err}
 		}
-		rt.triggerAST = expr
+		rt.staleTTL = ttl
+	}
+
+	// rs is a copy, the trigger ast of the rule edited only is resolved too.
+	if err := rs.resolveTrigger(); err != nil {
+		return nil, &FieldError{Path: path + ".trigger", Err: err}
+	}
+	if rs.TriggerAST != nil {
+		rt.triggerAST = rs.TriggerAST.Expr
 	}
 
 	if rs.Children != nil {
-		for _, child := range rs.Children {
-			tree, er := builder(child)
+		for i, child := range rs.Children {
+			tree, er := builder(child, &rs, fmt.Sprintf("%s.children[%d]", path, i))
 			if er != nil {
 				return nil, er
 			}
-			rt.children = tree
+			rt.children = append(rt.children, tree...)
 		}
 	}
 	trees = append(trees, *rt)
@@ -15,6 +15,7 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -85,3 +86,210 @@ func TestBuildRuleTrees(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildRuleTrees_Inherit(t *testing.T) {
+	fs := NewFileSource("./examples/rule.yaml", DataTypeYaml)
+	parser, err := NewParser(fs)
+	assert.NoError(t, err)
+	cfg, err := parser.Parse()
+	assert.NoError(t, err)
+
+	trees, err := BuildRuleTrees(cfg.Rules)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		latitude     string
+		wantStrategy StrategyType
+		wantPeriod   PeriodType
+		wantPriority PriorityType
+		wantAlgo     AlgorithmType
+	}{
+		{
+			latitude:     "order_service",
+			wantStrategy: StrategyQPS,
+			wantPeriod:   "1s",
+			wantPriority: PriorityTypeMedium,
+		},
+		{
+			latitude:     "/api/v1/order",
+			wantStrategy: StrategyConcurrency,
+			wantPeriod:   "1s",
+			wantPriority: PriorityTypeLow,
+		},
+		{
+			latitude:     "/api/v1/user",
+			wantStrategy: StrategyQPS,
+			wantPeriod:   "1s",
+			wantPriority: PriorityTypeLow,
+		},
+		{
+			latitude:     "*",
+			wantStrategy: StrategyTotal,
+			wantPeriod:   "1m",
+			wantPriority: PriorityTypeLow,
+			wantAlgo:     AlgorithmTypeTokenBucket,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.latitude, func(t *testing.T) {
+			rt := FindRuleTree(trees, tc.latitude)
+			assert.NotNil(t, rt)
+			assert.Equal(t, tc.wantStrategy, rt.strategy)
+			assert.Equal(t, tc.wantPeriod, rt.GetPeriod())
+			assert.Equal(t, tc.wantPriority, rt.GetPriority())
+			assert.Equal(t, tc.wantAlgo, rt.GetAlgorithm())
+		})
+	}
+}
+
+func TestConf_Check_Threshold(t *testing.T) {
+	cfg := Conf{
+		RedisCluster: RedisCluster{Addr: []string{"127.0.0.1:6379"}},
+		Defaults: Defaults{
+			Strategy: StrategyQPS,
+			Period:   "1s",
+			Priority: PriorityTypeLow,
+		},
+		Rules: Rule{
+			BaseThreshold: 1000,
+			MinThreshold:  300,
+			Children: []Rule{
+				{
+					Scope:         Scope{Type: ScopeTypeService, Value: "order_service"},
+					BaseThreshold: 2000,
+					MinThreshold:  300,
+				},
+				{
+					Scope:         Scope{Type: ScopeTypeService, Value: "user_service"},
+					BaseThreshold: 500,
+					MinThreshold:  200,
+					Children: []Rule{
+						{
+							Scope:         Scope{Type: ScopeTypeAPI, Value: "/api/v1/user"},
+							BaseThreshold: 100,
+							MinThreshold:  150,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var errs CheckErrors
+	assert.True(t, errors.As(cfg.Check(), &errs))
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	assert.Equal(t, []string{
+		"rules.children[0].base_threshold: base threshold 2000 exceeds parent base threshold 1000",
+		"rules.children[1].children[0].min_threshold: min threshold 150 exceeds base threshold 100",
+	}, msgs)
+
+	// checking never modifies the Conf.
+	assert.Empty(t, cfg.Rules.Children[1].Children[0].Strategy)
+	assert.Empty(t, cfg.Rules.Strategy)
+
+	// the children inherit the defaults.
+	cfg.Resolve()
+	assert.Equal(t, StrategyQPS, cfg.Rules.Children[1].Children[0].Strategy)
+	assert.Equal(t, PeriodType("1s"), cfg.Rules.Children[1].Children[0].Period)
+}
+
+func TestConf_Check_Mode(t *testing.T) {
+	cfg := Conf{
+		RedisCluster: RedisCluster{Addr: []string{"127.0.0.1:6379"}},
+		Defaults: Defaults{
+			Strategy: StrategyQPS,
+			Period:   "1s",
+			Priority: PriorityTypeLow,
+			Mode:     ModeShadow,
+		},
+		Rules: Rule{
+			BaseThreshold: 1000,
+			Children: []Rule{
+				{
+					Scope:         Scope{Type: ScopeTypeService, Value: "order_service"},
+					BaseThreshold: 500,
+					Mode:          ModeEnforce,
+					Children: []Rule{
+						{
+							Scope:         Scope{Type: ScopeTypeAPI, Value: "/api/v1/order"},
+							BaseThreshold: 100,
+						},
+					},
+				},
+				{
+					Scope:         Scope{Type: ScopeTypeService, Value: "user_service"},
+					BaseThreshold: 500,
+				},
+				{
+					Scope:         Scope{Type: ScopeTypeService, Value: "pay_service"},
+					BaseThreshold: 500,
+					Mode:          "dry_run",
+				},
+			},
+		},
+	}
+
+	var errs CheckErrors
+	assert.True(t, errors.As(cfg.Check(), &errs))
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "rules.children[2].mode: mode dry_run not valid", errs[0].Error())
+
+	// the rules inherit the mode from defaults or parent.
+	cfg.Rules.Children = cfg.Rules.Children[:2]
+	trees, err := cfg.RuleTrees()
+	assert.Nil(t, err)
+	assert.Equal(t, ModeShadow, trees[0].GetMode())
+	assert.Equal(t, ModeEnforce, FindRuleTree(trees, "order_service").GetMode())
+	assert.Equal(t, ModeEnforce, FindRuleTree(trees, "/api/v1/order").GetMode())
+	assert.True(t, FindRuleTree(trees, "user_service").IsShadow())
+}
+
+func TestConf_RuleTrees_Defaults(t *testing.T) {
+	cfg := Conf{
+		RedisCluster: RedisCluster{Addr: []string{"127.0.0.1:6379"}},
+		Defaults:     Defaults{Strategy: StrategyQPS, Period: "1s", Priority: PriorityTypeLow},
+		Rules: Rule{
+			BaseThreshold: 1000,
+			Children: []Rule{
+				{
+					Scope:         Scope{Type: ScopeTypeService, Value: "order_service"},
+					BaseThreshold: 500,
+					Trigger:       "cpu_usage > 0.8",
+				},
+			},
+		},
+	}
+	want := cfg.Rules.clone()
+
+	assert.NoError(t, cfg.Check())
+	assert.Equal(t, want, cfg.Rules)
+
+	// the hand-built Conf is built with defaults without parsing.
+	trees, err := cfg.RuleTrees()
+	assert.NoError(t, err)
+	rt := FindRuleTree(trees, "order_service")
+	assert.NotNil(t, rt)
+	assert.Equal(t, StrategyQPS, rt.GetStrategy())
+	assert.Equal(t, PriorityTypeLow, rt.GetPriority())
+	assert.Equal(t, "cpu_usage > 0.8", FormatTrigger(rt.GetTriggerAST()))
+	assert.Equal(t, want, cfg.Rules)
+}
+
+func TestBuildRuleTrees_Check(t *testing.T) {
+	_, err := BuildRuleTrees(Rule{
+		Strategy:      StrategyQPS,
+		Period:        "1s",
+		Priority:      PriorityTypeLow,
+		BaseThreshold: 100,
+		Children: []Rule{
+			{Scope: Scope{Type: ScopeTypeService, Value: "order_service"}, BaseThreshold: 500},
+		},
+	})
+	var errs CheckErrors
+	assert.ErrorAs(t, err, &errs)
+	assert.ErrorContains(t, err, "rules.children[0]")
+}
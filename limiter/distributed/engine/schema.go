@@ -0,0 +1,217 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// SchemaDraft the JSON Schema draft of the generated schema.
+	SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+	// SchemaID the id of the generated rule config schema.
+	SchemaID = "https://github.com/TimeWtr/gox/limiter/distributed/engine/rule.schema.json"
+)
+
+var (
+	astType     = reflect.TypeOf(AST{})
+	confType    = reflect.TypeOf(Conf{})
+	periodRegex = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+)
+
+// JSONSchema generate the JSON Schema of rule config Conf, editors and CI
+// can validate the rule config against it. The unknown fields are rejected
+// the same as the strict parsers do. The enum of scope types is built when
+// generated, generate it after the custom scope types are registered.
+func JSONSchema() ([]byte, error) {
+	defs := map[string]any{}
+	root := structSchema(confType, defs)
+	root["$schema"] = SchemaDraft
+	root["$id"] = SchemaID
+	root["title"] = "rule config"
+	root["$defs"] = defs
+
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// structSchema generate the object schema of struct type, the nested
+// structs are generated into defs and referenced.
+func structSchema(t reflect.Type, defs map[string]any) map[string]any {
+	properties := map[string]any{}
+	for _, f := range structFields(t, "json") {
+		properties[f.name] = fieldSchema(t, f, defs)
+	}
+
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if required := requiredFields[t]; len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return schema
+}
+
+func fieldSchema(owner reflect.Type, f structField, defs map[string]any) map[string]any {
+	// the fields whose schema can not be derived from type.
+	if owner == reflect.TypeOf(Scope{}) && f.name == "type" {
+		return enumSchema(scopeTypes())
+	}
+
+	return typeSchema(f.tp, defs)
+}
+
+func typeSchema(t reflect.Type, defs map[string]any) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(StrategyType("")):
+		return enumSchema([]string{string(StrategyQPS), string(StrategyConcurrency), string(StrategyTotal)})
+	case reflect.TypeOf(PriorityType("")):
+		return enumSchema([]string{string(PriorityTypeLow), string(PriorityTypeMedium), string(PriorityTypeHigh)})
+	case reflect.TypeOf(AlgorithmType("")):
+		return enumSchema([]string{string(AlgorithmTypeTokenBucket), AlgorithmTypeLeakBucket,
+			AlgorithmTypeFixedWindow, AlgorithmTypeSlidingWindow})
+	case reflect.TypeOf(MissingPolicy("")):
+		return enumSchema([]string{string(MissingPolicyError), string(MissingPolicyFalse),
+			string(MissingPolicyTrue), string(MissingPolicyLastKnown)})
+	case reflect.TypeOf(ModeType("")):
+		return enumSchema([]string{string(ModeEnforce), string(ModeShadow)})
+	case reflect.TypeOf(PeriodType("")):
+		return map[string]any{
+			"type":        "string",
+			"pattern":     periodRegex,
+			"description": "time duration, such as 1s, 500ms, 1m",
+		}
+	case reflect.TypeOf(TriggerType("")):
+		return map[string]any{
+			"type":        "string",
+			"description": "trigger expression, such as cpu_usage > 0.8 OR (mem_usage > 0.8 AND err_rate > 0.2)",
+		}
+	case astType:
+		defs["Expr"] = exprSchema()
+		return ref("Expr")
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := defs[name]; !ok {
+			// placeholder for the recursive type, such as Rule.Children.
+			defs[name] = nil
+			defs[name] = structSchema(t, defs)
+		}
+		return ref(name)
+	case reflect.Slice, reflect.Array:
+		return map[string]any{
+			"type":  "array",
+			"items": typeSchema(t.Elem(), defs),
+		}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	default:
+		return map[string]any{}
+	}
+}
+
+// exprSchema the schema of serialized trigger ast.
+func exprSchema() map[string]any {
+	operators := make([]string, 0, len(operatorsMap)+2)
+	for op := range operatorsMap {
+		operators = append(operators, op)
+	}
+	operators = append(operators, LogicUpperAnd, LogicUpperOr)
+
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"type":     enumSchema([]string{ExprNodeLogical, ExprNodeCondition}),
+			"operator": enumSchema(sortedStrings(operators)),
+			"left":     ref("Expr"),
+			"right":    ref("Expr"),
+			"field":    enumSchema(metricNames()),
+			"value":    map[string]any{"type": "number"},
+		},
+		"required":             []string{"type", "operator"},
+		"additionalProperties": false,
+	}
+}
+
+func sortedStrings(values []string) []string {
+	sort.Strings(values)
+	return values
+}
+
+func enumSchema(values []string) map[string]any {
+	return map[string]any{
+		"type": "string",
+		"enum": values,
+	}
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/$defs/" + name}
+}
+
+// requiredFields the required fields of struct in schema.
+var requiredFields = map[reflect.Type][]string{
+	confType:                       {"redis_cluster", "rules"},
+	reflect.TypeOf(RedisCluster{}): {"addr"},
+	reflect.TypeOf(Rule{}):         {"base_threshold"},
+	reflect.TypeOf(Scope{}):        {"type", "value"},
+}
+
+type structField struct {
+	name string
+	tp   reflect.Type
+}
+
+// structFields return the fields of struct named by the tag, such as json,
+// yaml and toml, the fields without tag use the field name.
+func structFields(t reflect.Type, tag string) []structField {
+	fields := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, structField{name: name, tp: f.Type})
+	}
+
+	return fields
+}
@@ -0,0 +1,79 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateSchema = flag.Bool("update", false, "update the generated rule schema file")
+
+const schemaFile = "./examples/rule.schema.json"
+
+// TestJSONSchema make sure the committed schema file is up to date,
+// run `go test -run TestJSONSchema -update` to regenerate it.
+func TestJSONSchema(t *testing.T) {
+	bs, err := JSONSchema()
+	require.NoError(t, err)
+	bs = append(bs, '\n')
+
+	if *updateSchema {
+		require.NoError(t, os.WriteFile(schemaFile, bs, 0o644))
+	}
+
+	want, err := os.ReadFile(schemaFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(bs), "schema file is stale, regenerate it with -update")
+
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(bs, &schema))
+	assert.Equal(t, SchemaDraft, schema["$schema"])
+	assert.Equal(t, false, schema["additionalProperties"])
+
+	defs := schema["$defs"].(map[string]any)
+	rule := defs["Rule"].(map[string]any)
+	properties := rule["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"$ref": "#/$defs/Rule"},
+		properties["children"].(map[string]any)["items"])
+	assert.Equal(t, map[string]any{"$ref": "#/$defs/Expr"}, properties["trigger_ast"])
+	assert.Contains(t, properties["priority"].(map[string]any)["enum"], "high")
+}
+
+func TestJSONSchema_ScopeTypes(t *testing.T) {
+	const region = "region"
+	require.NoError(t, RegisterScopeType(region, ScopeKind{
+		Extractor: func(req Request, _ string) (string, bool) {
+			v, ok := req.Attrs[region]
+			return v, ok
+		},
+	}))
+	defer unregisterScopeType(region)
+
+	bs, err := JSONSchema()
+	require.NoError(t, err)
+
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal(bs, &schema))
+	scope := schema["$defs"].(map[string]any)["Scope"].(map[string]any)
+	tp := scope["properties"].(map[string]any)["type"].(map[string]any)
+	assert.Contains(t, tp["enum"], region)
+	assert.Contains(t, tp["enum"], ScopeTypeAPI)
+}
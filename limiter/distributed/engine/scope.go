@@ -0,0 +1,271 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// ScopeTypeService type is service
+	ScopeTypeService = "service"
+	// ScopeTypeAPI type is api
+	ScopeTypeAPI = "api"
+	// ScopeTypeUser type is user
+	ScopeTypeUser = "user"
+	// ScopeTypeIP type is ip
+	ScopeTypeIP = "ip"
+	// ScopeTypeTenant type is tenant
+	ScopeTypeTenant = "tenant"
+	// ScopeTypeHeader type is request header, the Key is the header name.
+	ScopeTypeHeader = "header"
+	// ScopeTypeMethod type is http method
+	ScopeTypeMethod = "method"
+	// ScopeTypeGRPC type is grpc full method, such as /pkg.Service/Method.
+	ScopeTypeGRPC = "grpc"
+)
+
+// Scope the scope of the rule, the Value is the pattern matched by request:
+// the api scope supports path template such as /api/v1/order/{id} and
+// wildcard such as /api/v1/*, the ip scope supports CIDR such as 10.0.0.0/8,
+// the user scope supports labels such as group:vip and tier:gold, the grpc
+// scope supports service wildcard such as /pkg.Service/*, and all scopes
+// support * to match any request.
+type Scope struct {
+	Type string `json:"type" yaml:"type" toml:"type"`
+	// the key of request attribute, only used by the scope types require
+	// key, such as the header name of header scope.
+	Key   string `json:"key,omitempty" yaml:"key,omitempty" toml:"key,omitempty"`
+	Value string `json:"value" yaml:"value" toml:"value"`
+}
+
+func (s *Scope) valid() error {
+	kind, ok := LookupScopeType(s.Type)
+	if !ok {
+		return errors.New("unknown scope type")
+	}
+
+	if s.Value == "" {
+		return fmt.Errorf("%s scope must have a value", s.Type)
+	}
+
+	switch {
+	case kind.RequireKey && s.Key == "":
+		return fmt.Errorf("%s scope must have a key", s.Type)
+	case !kind.RequireKey && s.Key != "":
+		return fmt.Errorf("%s scope does not support key", s.Type)
+	}
+
+	if kind.Validate != nil {
+		if err := kind.Validate(s.Value); err != nil {
+			return err
+		}
+	}
+
+	return validScopeValue(*s)
+}
+
+// Request the attributes of the request used to resolve its rule tree node.
+type Request struct {
+	// the service name.
+	Service string
+	// the api path, such as /api/v1/order/1001.
+	API string
+	// the user id.
+	User string
+	// the labels of the user, the key is UserLabelGroup or UserLabelTier.
+	UserLabels map[string]string
+	// the client ip.
+	IP string
+	// the tenant id.
+	Tenant string
+	// the http method, such as GET.
+	Method string
+	// the grpc full method, such as /pkg.Service/Method.
+	GRPCMethod string
+	// the request headers.
+	Headers http.Header
+	// the custom attributes, used by the registered scope types.
+	Attrs map[string]string
+}
+
+// KeyExtractor extract the attribute of request matched against the scope
+// value, the key is Scope.Key such as the header name, it returns false if
+// the request does not carry the attribute.
+type KeyExtractor func(req Request, key string) (string, bool)
+
+// ScopeKind the definition of scope type.
+type ScopeKind struct {
+	// Extractor extract the attribute of request, required.
+	Extractor KeyExtractor
+	// PerEntity the scope limits every entity separately, such as every
+	// user or ip, it requires the keyed algorithms.
+	PerEntity bool
+	// RequireKey the scope requires Scope.Key, such as the header name.
+	RequireKey bool
+	// Validate check the scope value, optional.
+	Validate func(value string) error
+
+	// newMatcher create the matcher of the built-in types, the registered
+	// types match the extracted attribute literally.
+	newMatcher func(extract extractFunc) scopeMatcher
+}
+
+var scopeRegistry = struct {
+	mu    sync.RWMutex
+	kinds map[string]ScopeKind
+	// the names in order of registration.
+	names []string
+}{kinds: map[string]ScopeKind{}}
+
+// RegisterScopeType register the custom scope type, the registered type can
+// be used in rule config after registration, it fails if the name exists.
+func RegisterScopeType(name string, kind ScopeKind) error {
+	if name == "" {
+		return errors.New("scope type name must not be empty")
+	}
+	if kind.Extractor == nil {
+		return fmt.Errorf("scope type %s must have extractor", name)
+	}
+
+	scopeRegistry.mu.Lock()
+	defer scopeRegistry.mu.Unlock()
+
+	if _, ok := scopeRegistry.kinds[name]; ok {
+		return fmt.Errorf("scope type %s already registered", name)
+	}
+	scopeRegistry.kinds[name] = kind
+	scopeRegistry.names = append(scopeRegistry.names, name)
+
+	return nil
+}
+
+// LookupScopeType return the definition of scope type.
+func LookupScopeType(name string) (ScopeKind, bool) {
+	scopeRegistry.mu.RLock()
+	defer scopeRegistry.mu.RUnlock()
+
+	kind, ok := scopeRegistry.kinds[name]
+	return kind, ok
+}
+
+// scopeTypes return all the supported scope types.
+func scopeTypes() []string {
+	scopeRegistry.mu.RLock()
+	defer scopeRegistry.mu.RUnlock()
+
+	return append([]string(nil), scopeRegistry.names...)
+}
+
+// isPerEntity report whether the scope type limits every entity separately.
+func isPerEntity(tp string) bool {
+	kind, ok := LookupScopeType(tp)
+	return ok && kind.PerEntity
+}
+
+func init() {
+	builtins := []struct {
+		name string
+		kind ScopeKind
+	}{
+		{
+			name: ScopeTypeService,
+			kind: ScopeKind{Extractor: field(func(req Request) string { return req.Service })},
+		},
+		{
+			name: ScopeTypeAPI,
+			kind: ScopeKind{
+				Extractor:  field(func(req Request) string { return req.API }),
+				newMatcher: newPathTrie,
+			},
+		},
+		{
+			name: ScopeTypeUser,
+			kind: ScopeKind{
+				Extractor:  field(func(req Request) string { return req.User }),
+				PerEntity:  true,
+				newMatcher: newUserMatcher,
+			},
+		},
+		{
+			name: ScopeTypeIP,
+			kind: ScopeKind{
+				Extractor:  field(func(req Request) string { return req.IP }),
+				PerEntity:  true,
+				newMatcher: newCIDRTrie,
+			},
+		},
+		{
+			name: ScopeTypeTenant,
+			kind: ScopeKind{
+				Extractor: field(func(req Request) string { return req.Tenant }),
+				PerEntity: true,
+			},
+		},
+		{
+			name: ScopeTypeHeader,
+			kind: ScopeKind{
+				Extractor: func(req Request, key string) (string, bool) {
+					v := req.Headers.Get(key)
+					return v, v != ""
+				},
+				PerEntity:  true,
+				RequireKey: true,
+			},
+		},
+		{
+			name: ScopeTypeMethod,
+			kind: ScopeKind{
+				Extractor: field(func(req Request) string { return strings.ToUpper(req.Method) }),
+				Validate:  validMethod,
+			},
+		},
+		{
+			name: ScopeTypeGRPC,
+			kind: ScopeKind{
+				Extractor:  field(func(req Request) string { return req.GRPCMethod }),
+				newMatcher: newGRPCMatcher,
+			},
+		},
+	}
+
+	for _, b := range builtins {
+		if err := RegisterScopeType(b.name, b.kind); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// field create the extractor of the request field without key.
+func field(fn func(req Request) string) KeyExtractor {
+	return func(req Request, _ string) (string, bool) {
+		v := fn(req)
+		return v, v != ""
+	}
+}
+
+func validMethod(value string) error {
+	switch value {
+	case ScopeValueAny, http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return nil
+	default:
+		return fmt.Errorf("method scope %q is not upper case http method", value)
+	}
+}
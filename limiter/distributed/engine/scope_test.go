@@ -0,0 +1,207 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unregisterScopeType remove the scope type registered by test, so that
+// the other tests see the built-in types only.
+func unregisterScopeType(name string) {
+	scopeRegistry.mu.Lock()
+	defer scopeRegistry.mu.Unlock()
+
+	delete(scopeRegistry.kinds, name)
+	scopeRegistry.names = slices.DeleteFunc(scopeRegistry.names, func(n string) bool {
+		return n == name
+	})
+}
+
+func TestRuleMatcher_Match_ScopeTypes(t *testing.T) {
+	rule := Rule{
+		BaseThreshold: 10000,
+		Strategy:      StrategyQPS,
+		Period:        "1s",
+		Priority:      PriorityTypeLow,
+		Children: []Rule{
+			{
+				Scope:         Scope{Type: ScopeTypeGRPC, Value: "/order.OrderService/*"},
+				BaseThreshold: 2000,
+				Children: []Rule{
+					{Scope: Scope{Type: ScopeTypeTenant, Value: "acme"}, BaseThreshold: 500},
+					{Scope: Scope{Type: ScopeTypeTenant, Value: "*"}, BaseThreshold: 100},
+				},
+			},
+			{Scope: Scope{Type: ScopeTypeGRPC, Value: "/order.OrderService/Create"}, BaseThreshold: 1000},
+			{
+				Scope:         Scope{Type: ScopeTypeMethod, Value: "POST"},
+				BaseThreshold: 3000,
+				Children: []Rule{
+					{Scope: Scope{Type: ScopeTypeHeader, Key: "X-Api-Key", Value: "key-1"}, BaseThreshold: 300},
+					{Scope: Scope{Type: ScopeTypeHeader, Key: "X-Client-Version", Value: "1.0.0"}, BaseThreshold: 200},
+				},
+			},
+			{Scope: Scope{Type: ScopeTypeMethod, Value: "*"}, BaseThreshold: 5000},
+		},
+	}
+
+	trees, err := BuildRuleTrees(rule)
+	require.NoError(t, err)
+	m, err := NewRuleMatcher(trees)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		req      Request
+		wantPath []string
+	}{
+		{
+			name:     "grpc method",
+			req:      Request{GRPCMethod: "/order.OrderService/Create", Tenant: "acme"},
+			wantPath: []string{"", "/order.OrderService/Create"},
+		},
+		{
+			name:     "grpc service and tenant",
+			req:      Request{GRPCMethod: "/order.OrderService/Get", Tenant: "acme"},
+			wantPath: []string{"", "/order.OrderService/*", "acme"},
+		},
+		{
+			name:     "any tenant",
+			req:      Request{GRPCMethod: "/order.OrderService/Get", Tenant: "other"},
+			wantPath: []string{"", "/order.OrderService/*", "*"},
+		},
+		{
+			name: "method and header",
+			req: Request{Method: "post", Headers: http.Header{
+				"X-Client-Version": []string{"1.0.0"},
+			}},
+			wantPath: []string{"", "POST", "1.0.0"},
+		},
+		{
+			name: "first header key",
+			req: Request{Method: "POST", Headers: http.Header{
+				"X-Api-Key":        []string{"key-1"},
+				"X-Client-Version": []string{"1.0.0"},
+			}},
+			wantPath: []string{"", "POST", "key-1"},
+		},
+		{
+			name:     "any method",
+			req:      Request{Method: "GET", GRPCMethod: "/user.UserService/Get"},
+			wantPath: []string{"", "*"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			values := make([]string, 0)
+			for _, rt := range m.MatchPath(tc.req) {
+				values = append(values, rt.GetScope().Value)
+			}
+			assert.Equal(t, tc.wantPath, values)
+		})
+	}
+}
+
+func TestRegisterScopeType(t *testing.T) {
+	const region = "region"
+	err := RegisterScopeType(region, ScopeKind{
+		Extractor: func(req Request, _ string) (string, bool) {
+			v, ok := req.Attrs[region]
+			return v, ok
+		},
+		PerEntity: true,
+	})
+	require.NoError(t, err)
+	defer unregisterScopeType(region)
+
+	assert.Error(t, RegisterScopeType(region, ScopeKind{Extractor: field(func(Request) string { return "" })}))
+	assert.Error(t, RegisterScopeType("no_extractor", ScopeKind{}))
+	assert.Contains(t, scopeTypes(), region)
+
+	scope := Scope{Type: region, Value: "us-east"}
+	assert.NoError(t, scope.valid())
+
+	algo := AlgorithmType(AlgorithmTypeFixedWindow)
+	assert.Error(t, algo.Valid(region))
+	algo = AlgorithmTypeTokenBucket
+	assert.NoError(t, algo.Valid(region))
+
+	trees, err := BuildRuleTrees(Rule{
+		Strategy:      StrategyQPS,
+		Period:        "1s",
+		Priority:      PriorityTypeLow,
+		BaseThreshold: 1000,
+		Children:      []Rule{{Scope: scope, BaseThreshold: 10}},
+	})
+	require.NoError(t, err)
+	m, err := NewRuleMatcher(trees)
+	require.NoError(t, err)
+	assert.Equal(t, "us-east", m.Match(Request{Attrs: map[string]string{region: "us-east"}}).GetScope().Value)
+	assert.Equal(t, "", m.Match(Request{Attrs: map[string]string{region: "eu"}}).GetScope().Value)
+}
+
+func TestScope_Valid_ScopeTypes(t *testing.T) {
+	testCases := []struct {
+		name    string
+		scope   Scope
+		wantErr bool
+	}{
+		{name: "tenant", scope: Scope{Type: ScopeTypeTenant, Value: "acme"}},
+		{name: "header", scope: Scope{Type: ScopeTypeHeader, Key: "X-Api-Key", Value: "*"}},
+		{name: "header without key", scope: Scope{Type: ScopeTypeHeader, Value: "*"}, wantErr: true},
+		{name: "key not supported", scope: Scope{Type: ScopeTypeTenant, Key: "id", Value: "*"}, wantErr: true},
+		{name: "method", scope: Scope{Type: ScopeTypeMethod, Value: "GET"}},
+		{name: "lower case method", scope: Scope{Type: ScopeTypeMethod, Value: "get"}, wantErr: true},
+		{name: "grpc method", scope: Scope{Type: ScopeTypeGRPC, Value: "/pkg.Service/Method"}},
+		{name: "grpc service", scope: Scope{Type: ScopeTypeGRPC, Value: "/pkg.Service/*"}},
+		{name: "grpc invalid", scope: Scope{Type: ScopeTypeGRPC, Value: "pkg.Service/Method"}, wantErr: true},
+		{name: "unknown", scope: Scope{Type: "region", Value: "*"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantErr, tc.scope.valid() != nil)
+		})
+	}
+}
+
+func TestAlgorithmType_Valid_PerEntity(t *testing.T) {
+	testCases := []struct {
+		scope   string
+		algo    AlgorithmType
+		wantErr bool
+	}{
+		{scope: ScopeTypeAPI, algo: AlgorithmTypeFixedWindow},
+		{scope: ScopeTypeMethod, algo: AlgorithmTypeLeakBucket},
+		{scope: ScopeTypeGRPC, algo: AlgorithmTypeFixedWindow},
+		{scope: ScopeTypeUser, algo: AlgorithmTypeFixedWindow, wantErr: true},
+		{scope: ScopeTypeTenant, algo: AlgorithmTypeLeakBucket, wantErr: true},
+		{scope: ScopeTypeHeader, algo: AlgorithmTypeFixedWindow, wantErr: true},
+		{scope: ScopeTypeHeader, algo: AlgorithmTypeSlidingWindow},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.scope+"/"+string(tc.algo), func(t *testing.T) {
+			assert.Equal(t, tc.wantErr, tc.algo.Valid(tc.scope) != nil)
+		})
+	}
+}
@@ -44,8 +44,6 @@ func (s CircuitState) String() string {
 	}
 }
 
-var once *sync.Once
-
 type LimitStatus struct {
 	// limit current status
 	state CircuitState
@@ -63,15 +61,69 @@ type LimitStatus struct {
 }
 
 func NewLimitStatus(rollback bool, recoverSteps []int) *LimitStatus {
-	ls := &LimitStatus{}
-	once.Do(func() {
-		ls = &LimitStatus{
-			state:        StatusNormal,
-			recoverSteps: recoverSteps,
-			rollback:     rollback,
-			mu:           new(sync.RWMutex),
-		}
-	})
-
-	return ls
+	return &LimitStatus{
+		state:        StatusNormal,
+		recoverSteps: recoverSteps,
+		rollback:     rollback,
+		mu:           new(sync.RWMutex),
+	}
+}
+
+// State return the current status of limiter.
+func (ls *LimitStatus) State() CircuitState {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	return ls.state
+}
+
+// ThrottleSince return the time of limiter starting to throttle, zero if
+// the status is StatusNormal.
+func (ls *LimitStatus) ThrottleSince() time.Time {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	return ls.throttleSince
+}
+
+// Step return the current recover step.
+func (ls *LimitStatus) Step() int {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	return ls.currentStep
+}
+
+// Transit move the status by the trigger result at now, it returns true if
+// the status changed. the fired trigger throttles the limiter, the recovered
+// trigger moves the throttling limiter to recovering, and the recovering one
+// advances a recover step each time until all steps done. If the trigger
+// fires again while recovering, the limiter goes back to the previous step
+// if rollback is allowed, otherwise it throttles again.
+func (ls *LimitStatus) Transit(fired bool, now time.Time) bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	prev, prevStep := ls.state, ls.currentStep
+	switch {
+	case fired && ls.state == StatusRecovering && ls.rollback && ls.currentStep > 0:
+		ls.currentStep--
+	case fired && ls.state != StatusThrottling:
+		ls.state = StatusThrottling
+		ls.throttleSince = now
+		ls.currentStep = 0
+	case !fired && ls.state == StatusThrottling:
+		ls.state = StatusRecovering
+		ls.currentStep = 0
+	case !fired && ls.state == StatusRecovering:
+		ls.currentStep++
+	}
+
+	if ls.state == StatusRecovering && ls.currentStep >= len(ls.recoverSteps) {
+		ls.state = StatusNormal
+		ls.throttleSince = time.Time{}
+		ls.currentStep = 0
+	}
+
+	return prev != ls.state || prevStep != ls.currentStep
 }
@@ -0,0 +1,62 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitStatus_Transit(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		fired     bool
+		wantState CircuitState
+		wantStep  int
+		changed   bool
+	}{
+		{fired: false, wantState: StatusNormal},
+		{fired: true, wantState: StatusThrottling, changed: true},
+		{fired: true, wantState: StatusThrottling},
+		{fired: false, wantState: StatusRecovering, changed: true},
+		{fired: false, wantState: StatusRecovering, wantStep: 1, changed: true},
+		// rollback to the previous step.
+		{fired: true, wantState: StatusRecovering, changed: true},
+		{fired: false, wantState: StatusRecovering, wantStep: 1, changed: true},
+		{fired: false, wantState: StatusRecovering, wantStep: 2, changed: true},
+		{fired: false, wantState: StatusNormal, changed: true},
+	}
+
+	ls := NewLimitStatus(true, []int{1, 2, 3})
+	for i, step := range steps {
+		now = now.Add(time.Second)
+		assert.Equal(t, step.changed, ls.Transit(step.fired, now), "step %d", i)
+		assert.Equal(t, step.wantState, ls.State(), "step %d", i)
+		assert.Equal(t, step.wantStep, ls.Step(), "step %d", i)
+	}
+	assert.True(t, ls.ThrottleSince().IsZero())
+
+	// throttle again while recovering without rollback.
+	ls = NewLimitStatus(false, []int{1, 2})
+	ls.Transit(true, now)
+	ls.Transit(false, now)
+	ls.Transit(false, now)
+	assert.Equal(t, 1, ls.Step())
+	assert.True(t, ls.Transit(true, now.Add(time.Second)))
+	assert.Equal(t, StatusThrottling, ls.State())
+	assert.Equal(t, now.Add(time.Second), ls.ThrottleSince())
+}
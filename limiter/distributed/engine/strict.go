@@ -0,0 +1,574 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// srcPos the position in source document, both start from 1.
+type srcPos struct {
+	line   int
+	column int
+	// byte offset, only used by json.
+	offset int
+}
+
+// positions the positions of field paths in source document, such as
+// rules.children[1].trigger, it is used to report errors with line numbers.
+type positions map[string]srcPos
+
+// lookup find the position of path, the parent path is used if the path
+// is not in source document, such as the field inherited from parent.
+func (p positions) lookup(path string) (srcPos, bool) {
+	for path != "" {
+		if pos, ok := p[path]; ok {
+			return pos, true
+		}
+
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+
+	return srcPos{}, false
+}
+
+// annotate set the line numbers of the check errors.
+func (p positions) annotate(err error) error {
+	var errs CheckErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	for _, e := range errs {
+		if e.Line != 0 {
+			continue
+		}
+		if pos, ok := p.lookup(e.Path); ok {
+			e.Line, e.Column = pos.line, pos.column
+		}
+	}
+
+	return errs
+}
+
+// onLine return the deepest path located at line, or the last path before
+// line if the line is the value of the field, such as the items of sequence.
+func (p positions) onLine(line int) (string, int) {
+	var res string
+	var at srcPos
+	for path, pos := range p {
+		if pos.line > line || pos.line < at.line {
+			continue
+		}
+		if pos.line > at.line || len(path) > len(res) {
+			res, at = path, pos
+		}
+	}
+
+	return res, at.column
+}
+
+// first return the path of the key named name first in the document.
+func (p positions) first(name string) (string, bool) {
+	var res string
+	found := false
+	for path, pos := range p {
+		if path[strings.LastIndexByte(path, '.')+1:] != name {
+			continue
+		}
+		if !found || pos.offset < p[res].offset {
+			res, found = path, true
+		}
+	}
+
+	return res, found
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// unknownField the error of the unknown field, the similar fields are
+// suggested.
+func unknownField(name string, candidates []string) error {
+	err := fmt.Errorf("unknown field %q", name)
+	if suggestions := suggest(name, candidates); len(suggestions) > 0 {
+		err = fmt.Errorf("%w (did you mean %s?)", err, quoteJoin(suggestions, " or "))
+	}
+
+	return err
+}
+
+// knownTypes return the struct types of Conf by name, such as engine.Rule.
+func knownTypes() map[string]reflect.Type {
+	types := map[string]reflect.Type{}
+	var visit func(t reflect.Type)
+	visit = func(t reflect.Type) {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		// the ast validates itself while unmarshalling.
+		if t.Kind() != reflect.Struct || t == astType {
+			return
+		}
+		if _, ok := types[t.String()]; ok {
+			return
+		}
+
+		types[t.String()] = t
+		for i := 0; i < t.NumField(); i++ {
+			visit(t.Field(i).Type)
+		}
+	}
+	visit(confType)
+
+	return types
+}
+
+// fieldNames return the names of the fields of struct types by the tag, all
+// the types of Conf are used if types is empty.
+func fieldNames(tag string, types ...reflect.Type) []string {
+	if len(types) == 0 {
+		for _, t := range knownTypes() {
+			types = append(types, t)
+		}
+	}
+
+	seen := map[string]struct{}{}
+	var names []string
+	for _, t := range types {
+		for _, f := range structFields(t, tag) {
+			if _, ok := seen[f.name]; !ok {
+				seen[f.name] = struct{}{}
+				names = append(names, f.name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// decodeJSON decode the json document strictly, the unknown fields are
+// rejected by the decoder.
+func decodeJSON(bs []byte, cfg *Conf) (positions, error) {
+	pos, err := jsonPositions(bs)
+	if err != nil {
+		return nil, locateJSONError(bs, nil, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(cfg); err != nil {
+		return pos, locateJSONError(bs, pos, err)
+	}
+
+	return pos, nil
+}
+
+// jsonPositions record the positions of the keys of json document.
+func jsonPositions(bs []byte) (positions, error) {
+	pos := positions{}
+	idx := newLineIndex(bs)
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+
+	if err := jsonValue(dec, bs, idx, pos, ""); err != nil {
+		return nil, err
+	}
+
+	return pos, nil
+}
+
+func jsonValue(dec *json.Decoder, bs []byte, idx lineIndex, pos positions, path string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return nil
+	}
+
+	switch delim {
+	case '{':
+		for dec.More() {
+			offset := skipJSONSeparator(bs, int(dec.InputOffset()))
+			key, er := dec.Token()
+			if er != nil {
+				return er
+			}
+
+			child := joinPath(path, key.(string))
+			pos[child] = idx.locate(offset)
+			if er = jsonValue(dec, bs, idx, pos, child); er != nil {
+				return er
+			}
+		}
+	case '[':
+		for i := 0; dec.More(); i++ {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			pos[child] = idx.locate(skipJSONSeparator(bs, int(dec.InputOffset())))
+			if er := jsonValue(dec, bs, idx, pos, child); er != nil {
+				return er
+			}
+		}
+	}
+
+	// consume the close delimiter.
+	_, err = dec.Token()
+	return err
+}
+
+// skipJSONSeparator skip the spaces and separators before the next token.
+func skipJSONSeparator(bs []byte, offset int) int {
+	for offset < len(bs) {
+		switch bs[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+
+	return offset
+}
+
+var jsonUnknownRegex = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+// locateJSONError report the json decode error with line number, the json
+// package reports the byte offset only. The unknown field is reported
+// without offset, it is located at the first key of the same name, as the
+// decoder stops at the first unknown field in the document.
+func locateJSONError(bs []byte, pos positions, err error) error {
+	if m := jsonUnknownRegex.FindStringSubmatch(err.Error()); m != nil {
+		fe := &FieldError{Err: unknownField(m[1], fieldNames("json"))}
+		if path, ok := pos.first(m[1]); ok {
+			fe.Path, fe.Line, fe.Column = path, pos[path].line, pos[path].column
+		}
+		return fe
+	}
+
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+
+	at := newLineIndex(bs).locate(int(offset))
+	fe := &FieldError{Line: at.line, Column: at.column, Err: err}
+
+	// the last field starting before the error offset is the one failed
+	// to decode, report the line of the field instead of the offset.
+	best := -1
+	for path, p := range pos {
+		if p.offset < int(offset) && p.offset > best {
+			best = p.offset
+			fe.Path, fe.Line, fe.Column = path, p.line, p.column
+		}
+	}
+
+	return fe
+}
+
+// decodeYAML decode the yaml document strictly, the unknown fields are
+// rejected by the decoder.
+func decodeYAML(bs []byte, cfg *Conf) (positions, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(bs, &doc); err != nil {
+		return nil, err
+	}
+
+	keys, values := positions{}, positions{}
+	if len(doc.Content) > 0 {
+		yamlPositions(doc.Content[0], keys, values, "")
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(bs))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return keys, locateYAMLError(keys, values, err)
+	}
+
+	return keys, nil
+}
+
+// yamlPositions record the positions of the keys and the items of yaml
+// document, and the positions of the values except the mappings.
+func yamlPositions(y *yaml.Node, keys, values positions, path string) {
+	for y.Kind == yaml.AliasNode && y.Alias != nil {
+		y = y.Alias
+	}
+
+	if y.Kind != yaml.MappingNode && path != "" {
+		values[path] = srcPos{line: y.Line, column: y.Column}
+	}
+
+	switch y.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(y.Content); i += 2 {
+			key := y.Content[i]
+			child := joinPath(path, key.Value)
+			keys[child] = srcPos{line: key.Line, column: key.Column}
+			yamlPositions(y.Content[i+1], keys, values, child)
+		}
+	case yaml.SequenceNode:
+		for i, item := range y.Content {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			keys[child] = srcPos{line: item.Line, column: item.Column}
+			yamlPositions(item, keys, values, child)
+		}
+	}
+}
+
+// outermost return the shortest path located at line.
+func (p positions) outermost(line int) (string, bool) {
+	var res string
+	found := false
+	for path, pos := range p {
+		if pos.line == line && (!found || len(path) < len(res)) {
+			res, found = path, true
+		}
+	}
+
+	return res, found
+}
+
+var (
+	yamlLineRegex    = regexp.MustCompile(`^line (\d+): `)
+	yamlUnknownRegex = regexp.MustCompile(`^field (.*) not found in type (.*)$`)
+)
+
+// locateYAMLError report the yaml type errors with field path, the yaml
+// package reports the line number only, which is the line of the unknown
+// key, or the line of the value mismatched.
+func locateYAMLError(keys, values positions, err error) error {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+
+	types := knownTypes()
+	errs := make(CheckErrors, 0, len(typeErr.Errors))
+	for _, msg := range typeErr.Errors {
+		fe := &FieldError{Err: errors.New(msg)}
+		m := yamlLineRegex.FindStringSubmatch(msg)
+		if m != nil {
+			msg = strings.TrimPrefix(msg, m[0])
+			fe.Err = errors.New(msg)
+			_, _ = fmt.Sscan(m[1], &fe.Line)
+		}
+
+		unknown := yamlUnknownRegex.FindStringSubmatch(msg)
+		if unknown != nil {
+			var candidates []string
+			if t, ok := types[unknown[2]]; ok {
+				candidates = fieldNames("yaml", t)
+			}
+			fe.Err = unknownField(unknown[1], candidates)
+		}
+
+		if m != nil {
+			path, ok := values.outermost(fe.Line)
+			if !ok || unknown != nil {
+				path, _ = keys.onLine(fe.Line)
+			}
+			if path != "" {
+				fe.Path, fe.Line, fe.Column = path, keys[path].line, keys[path].column
+			}
+		}
+		errs = append(errs, fe)
+	}
+
+	return errs
+}
+
+// decodeTOML decode the toml document strictly, the keys undecoded are
+// reported as unknown. The toml package records the keys in the order of
+// document without positions, the keys are located in the source by order,
+// and the arrays of tables are not indexed in path.
+func decodeTOML(bs []byte, cfg *Conf) error {
+	md, err := toml.Decode(string(bs), cfg)
+	if err != nil {
+		return err
+	}
+
+	undecoded := md.Undecoded()
+	paths := make(map[string]struct{}, len(undecoded))
+	for _, key := range undecoded {
+		paths[key.String()] = struct{}{}
+	}
+
+	keys := md.Keys()
+	at := tomlPositions(bs, keys)
+	var errs CheckErrors
+	reported := map[string]struct{}{}
+	for i, key := range keys {
+		if _, ok := paths[key.String()]; !ok {
+			continue
+		}
+		// only report the outermost unknown key, and once for all the
+		// elements of the arrays of tables.
+		if len(key) > 1 {
+			if _, ok := paths[key[:len(key)-1].String()]; ok {
+				continue
+			}
+		}
+		if _, ok := reported[key.String()]; ok {
+			continue
+		}
+		reported[key.String()] = struct{}{}
+
+		errs = append(errs, &FieldError{
+			Path:   key.String(),
+			Line:   at[i].line,
+			Column: at[i].column,
+			Err:    unknownField(key[len(key)-1], tomlCandidates(key)),
+		})
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// tomlPositions locate the keys of toml document, the keys are in the order
+// of document, each key is searched after the previous one.
+func tomlPositions(bs []byte, keys []toml.Key) []srcPos {
+	idx := newLineIndex(bs)
+	res := make([]srcPos, len(keys))
+	cursor := 0
+	for i, key := range keys {
+		start, end := findTOMLKey(bs, cursor, key[len(key)-1])
+		if start < 0 {
+			continue
+		}
+		res[i], cursor = idx.locate(start), end
+	}
+
+	return res
+}
+
+// findTOMLKey find the first key named name from offset, the key is bare
+// or quoted, return the start and end offsets of the key or -1 if not found.
+func findTOMLKey(bs []byte, offset int, name string) (int, int) {
+	start, end := -1, -1
+	for _, form := range []string{name, strconv.Quote(name), "'" + name + "'"} {
+		for from := offset; ; {
+			i := bytes.Index(bs[from:], []byte(form))
+			if i < 0 {
+				break
+			}
+			i += from
+			if isTOMLKey(bs, i, i+len(form)) {
+				if start < 0 || i < start {
+					start, end = i, i+len(form)
+				}
+				break
+			}
+			from = i + 1
+		}
+	}
+
+	return start, end
+}
+
+// isTOMLKey report whether the text between start and end is a key, which
+// is the first of line, or a part of dotted keys, table headers and inline
+// tables, and followed by '=', '.' or ']'.
+func isTOMLKey(bs []byte, start, end int) bool {
+	before := bytes.TrimRight(bs[:start], " \t")
+	if len(before) > 0 && !bytes.ContainsAny(before[len(before)-1:], "\n[.{,") {
+		return false
+	}
+
+	after := bytes.TrimLeft(bs[end:], " \t")
+	return len(after) > 0 && bytes.ContainsAny(after[:1], "=.]")
+}
+
+// tomlCandidates return the known field names of the struct which the key belongs to.
+func tomlCandidates(key toml.Key) []string {
+	t := confType
+	for _, seg := range key[:len(key)-1] {
+		found := false
+		for _, f := range structFields(t, "toml") {
+			if f.name != seg {
+				continue
+			}
+			t = f.tp
+			for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+				t = t.Elem()
+			}
+			found = true
+			break
+		}
+		if !found || t.Kind() != reflect.Struct {
+			return nil
+		}
+	}
+
+	return fieldNames("toml", t)
+}
+
+// lineIndex the start offsets of lines.
+type lineIndex []int
+
+func newLineIndex(bs []byte) lineIndex {
+	idx := lineIndex{0}
+	for i, b := range bs {
+		if b == '\n' {
+			idx = append(idx, i+1)
+		}
+	}
+
+	return idx
+}
+
+func (l lineIndex) locate(offset int) srcPos {
+	line := sort.Search(len(l), func(i int) bool {
+		return l[i] > offset
+	})
+
+	return srcPos{line: line, column: offset - l[line-1] + 1, offset: offset}
+}
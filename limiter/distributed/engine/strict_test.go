@@ -0,0 +1,210 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParser_Strict(t *testing.T) {
+	const trigger = "cpu_usage > 0.8 OR mem_usage > 0.8 OR err_rate > 0.2"
+
+	testCases := []struct {
+		name      string
+		newParser func([]byte) Parser
+		content   string
+		// the replacements of content, old and new in pairs.
+		replace []string
+		// the path, line and message of the errors.
+		wantErrs []*FieldError
+		wantMsg  string
+	}{
+		{
+			name:      "json",
+			newParser: NewJsonParser,
+			content:   jsonContent,
+		},
+		{
+			name:      "yaml",
+			newParser: NewYamlParser,
+			content:   yamlContent,
+		},
+		{
+			name:      "toml",
+			newParser: NewTomlParser,
+			content:   tomlContent,
+		},
+		{
+			name:      "json unknown field",
+			newParser: NewJsonParser,
+			content:   jsonContent,
+			replace:   []string{`"min_threshold": 300`, `"min_threshod": 300`},
+			// the decoder stops at the first unknown field.
+			wantErrs: []*FieldError{
+				{Path: "rules.min_threshod", Line: 12, Column: 5},
+			},
+			wantMsg: `unknown field "min_threshod" (did you mean "min_threshold"?)`,
+		},
+		{
+			name:      "yaml unknown field",
+			newParser: NewYamlParser,
+			content:   yamlContent,
+			replace:   []string{"min_threshold: 300", "min_threshod: 300"},
+			wantErrs: []*FieldError{
+				{Path: "rules.min_threshod", Line: 10, Column: 3},
+				{Path: "rules.children[0].min_threshod", Line: 17, Column: 7},
+			},
+			wantMsg: `unknown field "min_threshod" (did you mean "min_threshold"?)`,
+		},
+		{
+			name:      "toml unknown field",
+			newParser: NewTomlParser,
+			content:   tomlContent,
+			replace:   []string{"min_threshold = 300", "min_threshod = 300"},
+			// the arrays of tables are not indexed in path.
+			wantErrs: []*FieldError{
+				{Path: "rules.min_threshod", Line: 11, Column: 1},
+				{Path: "rules.children.min_threshod", Line: 17, Column: 1},
+			},
+			wantMsg: `unknown field "min_threshod" (did you mean "min_threshold"?)`,
+		},
+		{
+			name:      "toml quoted key",
+			newParser: NewTomlParser,
+			content:   tomlContent,
+			replace:   []string{"min_threshold = 300", `"min_threshold" = 300`},
+		},
+		{
+			name:      "toml quoted unknown field",
+			newParser: NewTomlParser,
+			content:   tomlContent,
+			replace:   []string{"min_threshold = 300\npriority = \"high\"", "# min_threshod = 300\n'min_threshod' = 300\npriority = \"high\""},
+			wantErrs: []*FieldError{
+				{Path: "rules.min_threshod", Line: 12, Column: 1},
+			},
+			wantMsg: `unknown field "min_threshod" (did you mean "min_threshold"?)`,
+		},
+		{
+			name:      "toml inline table unknown field",
+			newParser: NewTomlParser,
+			content:   tomlContent,
+			replace:   []string{`value = "/api/v1/order"`, `valu = "/api/v1/order"`},
+			wantErrs: []*FieldError{
+				{Path: "rules.children.children.scope.valu", Line: 22, Column: 25},
+			},
+			wantMsg: `unknown field "valu" (did you mean "value"?)`,
+		},
+		{
+			name:      "toml array of tables unknown field",
+			newParser: NewTomlParser,
+			content:   tomlContent,
+			replace:   []string{`period = "1m"`, `periods = "1m"`},
+			wantErrs: []*FieldError{
+				{Path: "rules.children.children.children.periods", Line: 36, Column: 1},
+			},
+			wantMsg: `unknown field "periods" (did you mean "period"?)`,
+		},
+		{
+			name:      "json legacy trigger array",
+			newParser: NewJsonParser,
+			content:   jsonContent,
+			replace:   []string{`"` + trigger + `"`, `[{"metric": "cpu_usage", "threshold": 0.8}]`},
+			wantErrs: []*FieldError{
+				{Path: "rules.children[0].trigger", Line: 23, Column: 9},
+			},
+			wantMsg: "cannot unmarshal array",
+		},
+		{
+			name:      "yaml legacy trigger array",
+			newParser: NewYamlParser,
+			content:   yamlContent,
+			replace:   []string{trigger, "\n        - metric: cpu_usage\n          threshold: 0.8"},
+			wantErrs: []*FieldError{
+				{Path: "rules.children[0].trigger", Line: 19, Column: 7},
+			},
+			wantMsg: "cannot unmarshal !!seq",
+		},
+		{
+			name:      "toml legacy trigger array",
+			newParser: NewTomlParser,
+			content:   tomlContent,
+			replace: []string{`trigger = "` + trigger + `"`,
+				"\n[[rules.children.trigger]]\nmetric = \"cpu_usage\"\nthreshold = 0.8\n"},
+			wantMsg: "line 20",
+		},
+		{
+			name:      "json check error",
+			newParser: NewJsonParser,
+			content:   jsonContent,
+			replace:   []string{`"strategy": "concurrency"`, `"strategy": "concurrent"`},
+			wantErrs: []*FieldError{
+				{Path: "rules.children[0].children[0].strategy", Line: 32, Column: 13},
+			},
+			wantMsg: "concurrent",
+		},
+		{
+			name:      "yaml check error",
+			newParser: NewYamlParser,
+			content:   yamlContent,
+			replace:   []string{"strategy: total", "strategy: totals"},
+			wantErrs: []*FieldError{
+				{Path: "rules.children[0].children[1].children[0].strategy", Line: 37, Column: 15},
+				{Path: "rules.children[0].children[1].children[1].strategy", Line: 43, Column: 15},
+			},
+			wantMsg: "totals",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			content := tc.content
+			for i := 0; i+1 < len(tc.replace); i += 2 {
+				content = strings.ReplaceAll(content, tc.replace[i], tc.replace[i+1])
+			}
+
+			_, err := tc.newParser([]byte(content)).Parse()
+			if tc.wantMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tc.wantMsg)
+
+			var errs []*FieldError
+			var ces CheckErrors
+			var fe *FieldError
+			switch {
+			case errors.As(err, &ces):
+				errs = ces
+			case errors.As(err, &fe):
+				errs = []*FieldError{fe}
+			}
+
+			if tc.wantErrs == nil {
+				return
+			}
+			require.Len(t, errs, len(tc.wantErrs))
+			for i := range errs {
+				assert.Equal(t, tc.wantErrs[i].Path, errs[i].Path)
+				assert.Equal(t, tc.wantErrs[i].Line, errs[i].Line)
+				assert.Equal(t, tc.wantErrs[i].Column, errs[i].Column)
+			}
+		})
+	}
+}
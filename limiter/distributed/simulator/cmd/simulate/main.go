@@ -0,0 +1,109 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command simulate replay the recorded trace against the rule config and
+// print the admit/reject counts and threshold timelines of every rule.
+//
+//	simulate -conf rule.yaml -trace trace.json [-output json]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/TimeWtr/gox/limiter/distributed/engine"
+	"github.com/TimeWtr/gox/limiter/distributed/simulator"
+)
+
+func main() {
+	conf := flag.String("conf", "", "the rule config file, json, yaml or toml")
+	dataType := flag.String("type", "", "the data type of rule config, default by the file extension")
+	trace := flag.String("trace", "", "the json trace file of requests and metrics samples")
+	output := flag.String("output", "text", "the output format, text or json")
+	steps := flag.String("recover-steps", "", "the comma separated recover steps of LimitStatus, such as 10,30,60")
+	rollback := flag.Bool("rollback", false, "go back to the previous recover step if the trigger fires again")
+	flag.Parse()
+
+	if err := run(*conf, *dataType, *trace, *output, *steps, *rollback); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(conf, dataType, trace, output, steps string, rollback bool) error {
+	if conf == "" || trace == "" {
+		return fmt.Errorf("both -conf and -trace are required")
+	}
+
+	if dataType == "" {
+		dataType = strings.TrimPrefix(filepath.Ext(conf), ".")
+		if dataType == "yml" {
+			dataType = string(engine.DataTypeYaml)
+		}
+	}
+
+	p, err := engine.NewParser(engine.NewFileSource(conf, engine.DataType(dataType)))
+	if err != nil {
+		return err
+	}
+
+	var recoverSteps []int
+	for _, s := range strings.Split(steps, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		step, er := strconv.Atoi(s)
+		if er != nil {
+			return fmt.Errorf("recover step %q not valid: %w", s, er)
+		}
+		recoverSteps = append(recoverSteps, step)
+	}
+
+	sim, err := simulator.New(p, simulator.WithRecoverSteps(rollback, recoverSteps))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(trace)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	t, err := simulator.LoadTrace(f)
+	if err != nil {
+		return fmt.Errorf("load trace: %w", err)
+	}
+
+	report, err := sim.Run(t)
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "text":
+		return report.WriteText(os.Stdout)
+	default:
+		return fmt.Errorf("output format %s not valid", output)
+	}
+}
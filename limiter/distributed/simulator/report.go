@@ -0,0 +1,138 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/TimeWtr/gox/limiter/distributed/engine"
+)
+
+// Report the result of replaying trace.
+type Report struct {
+	// the time range of trace.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// the requests admitted and rejected by all matched rules.
+	Admitted uint64 `json:"admitted"`
+	Rejected uint64 `json:"rejected"`
+	// the rules in depth first order.
+	Rules []*RuleReport `json:"rules"`
+	// the errors of evaluating metrics samples.
+	Errors []SampleError `json:"errors,omitempty"`
+}
+
+// RuleReport the decisions and timelines of rule.
+type RuleReport struct {
+	// the path of rule in Conf, such as rules.children[0].
+	Path  string          `json:"path"`
+	Scope engine.Scope    `json:"scope"`
+	Mode  engine.ModeType `json:"mode"`
+	// the requests admitted by the rule, including the would-reject ones
+	// of the shadow rule.
+	Admitted uint64 `json:"admitted"`
+	// the requests rejected by the rule.
+	Rejected uint64 `json:"rejected"`
+	// the requests would be rejected by the shadow rule.
+	WouldReject uint64 `json:"would_reject,omitempty"`
+	// the threshold timeline, the first point is the base threshold.
+	Thresholds []ThresholdPoint `json:"thresholds"`
+	// the LimitStatus timeline of the trigger latitude.
+	States []StatePoint `json:"states,omitempty"`
+}
+
+// ThresholdPoint the threshold of rule changed at time.
+type ThresholdPoint struct {
+	At        time.Time `json:"at"`
+	Threshold uint64    `json:"threshold"`
+	// the threshold is adjusted in shadow mode and not applied.
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+// StatePoint the LimitStatus of rule changed at time.
+type StatePoint struct {
+	At    time.Time `json:"at"`
+	State string    `json:"state"`
+	Step  int       `json:"step,omitempty"`
+}
+
+// SampleError the error of evaluating metrics sample.
+type SampleError struct {
+	At       time.Time `json:"at"`
+	Latitude string    `json:"latitude"`
+	Err      string    `json:"error"`
+}
+
+// WriteText write the report as text tables, the timelines are relative to
+// the start of trace.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "requests: admitted=%d rejected=%d duration=%s\n\n",
+		r.Admitted, r.Rejected, r.End.Sub(r.Start))
+
+	_, _ = fmt.Fprintln(tw, "RULE\tSCOPE\tMODE\tADMITTED\tREJECTED\tWOULD REJECT\tTHRESHOLDS")
+	for _, rule := range r.Rules {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n", rule.Path, scopeString(rule.Scope),
+			rule.Mode, rule.Admitted, rule.Rejected, rule.WouldReject, r.thresholds(rule))
+	}
+
+	for _, rule := range r.Rules {
+		if len(rule.States) == 0 {
+			continue
+		}
+
+		_, _ = fmt.Fprintf(tw, "\n%s states:\n", rule.Path)
+		for _, s := range rule.States {
+			_, _ = fmt.Fprintf(tw, "  +%s\t%s\tstep=%d\n", s.At.Sub(r.Start), s.State, s.Step)
+		}
+	}
+
+	if len(r.Errors) > 0 {
+		_, _ = fmt.Fprintln(tw, "\nerrors:")
+		for _, e := range r.Errors {
+			_, _ = fmt.Fprintf(tw, "  +%s\t%s\t%s\n", e.At.Sub(r.Start), e.Latitude, e.Err)
+		}
+	}
+
+	return tw.Flush()
+}
+
+func (r *Report) thresholds(rule *RuleReport) string {
+	points := make([]string, 0, len(rule.Thresholds))
+	for _, p := range rule.Thresholds {
+		s := fmt.Sprintf("+%s=%d", p.At.Sub(r.Start), p.Threshold)
+		if p.Shadow {
+			s += "(shadow)"
+		}
+		points = append(points, s)
+	}
+
+	return strings.Join(points, " ")
+}
+
+func scopeString(s engine.Scope) string {
+	switch {
+	case s.Type == "":
+		return "global"
+	case s.Key != "":
+		return fmt.Sprintf("%s[%s]=%s", s.Type, s.Key, s.Value)
+	default:
+		return fmt.Sprintf("%s=%s", s.Type, s.Value)
+	}
+}
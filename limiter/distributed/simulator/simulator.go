@@ -0,0 +1,378 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/limiter/distributed"
+	"github.com/TimeWtr/gox/limiter/distributed/engine"
+)
+
+// Option the optional config of Simulator.
+type Option func(*Simulator)
+
+// WithRecoverSteps set the recover steps of the LimitStatus of the trigger
+// latitudes, rollback allows going back to the previous step if the
+// trigger fires again while recovering.
+func WithRecoverSteps(rollback bool, steps []int) Option {
+	return func(s *Simulator) {
+		s.rollback = rollback
+		s.steps = steps
+	}
+}
+
+// Simulator replay the recorded trace against the rule config offline, the
+// requests are limited by the matched rules and the metrics samples drive
+// the triggers and the rate adjustments of the decision strategy, all in
+// the virtual time of trace. The requests are limited by the local
+// limiters of production running on the virtual clock.
+type Simulator struct {
+	p       engine.Parser
+	trees   []engine.RuleTree
+	matcher *engine.RuleMatcher
+	// the LimitStatus config of the trigger latitudes.
+	rollback bool
+	steps    []int
+}
+
+func New(p engine.Parser, opts ...Option) (*Simulator, error) {
+	cf, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	trees, err := cf.RuleTrees()
+	if err != nil {
+		return nil, err
+	}
+
+	matcher, err := engine.NewRuleMatcher(trees)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Simulator{
+		p:       p,
+		trees:   trees,
+		matcher: matcher,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// rule the simulation state of rule.
+type rule struct {
+	tree   *engine.RuleTree
+	report *RuleReport
+	period time.Duration
+	// the current rate of rule.
+	rate uint64
+	// the extractor of entity key, nil if the rule is shared by all requests.
+	extract engine.KeyExtractor
+	// the limiters by entity key, created on the first request of key.
+	windows map[string]window
+	clock   clock.Clock
+}
+
+func (r *rule) allow(er engine.Request) (func(), bool) {
+	key := ""
+	if r.extract != nil {
+		key, _ = r.extract(er, r.tree.GetScope().Key)
+	}
+
+	w, ok := r.windows[key]
+	if !ok {
+		w = newWindow(r.tree, r.rate, r.period, r.clock)
+		r.windows[key] = w
+	}
+
+	return w.allow()
+}
+
+// setRate adjust the rate of rule, the limiters are recreated with the new
+// rate, the same as the rule reloaded.
+func (r *rule) setRate(rate uint64) {
+	if rate == r.rate {
+		return
+	}
+
+	r.rate = rate
+	for key, w := range r.windows {
+		w.close()
+		delete(r.windows, key)
+	}
+}
+
+// release the request in flight finishes at end.
+type release struct {
+	end  time.Time
+	done func()
+}
+
+// run the state of one replay.
+type run struct {
+	matcher   *engine.RuleMatcher
+	rules     map[*engine.RuleTree]*rule
+	latitudes map[string][]*rule
+	statuses  map[string]*engine.LimitStatus
+	stg       distributed.DecisionStrategy
+	report    *Report
+	rollback  bool
+	steps     []int
+	// the virtual clock of limiters.
+	clock *clock.Fake
+	// the requests in flight in order of end.
+	releases []release
+}
+
+// Run replay the trace and report the decisions of every rule, the samples
+// and requests are replayed in order of time, the samples first if at the
+// same time. Every run starts from the base thresholds.
+func (s *Simulator) Run(trace Trace) (*Report, error) {
+	stg, err := distributed.NewBS(s.p)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := append([]Request(nil), trace.Requests...)
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].Timestamp.Before(requests[j].Timestamp)
+	})
+	samples := append([]Sample(nil), trace.Samples...)
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Timestamp.Before(samples[j].Timestamp)
+	})
+
+	r := &run{
+		matcher:   s.matcher,
+		rules:     map[*engine.RuleTree]*rule{},
+		latitudes: map[string][]*rule{},
+		statuses:  map[string]*engine.LimitStatus{},
+		stg:       stg,
+		report:    &Report{},
+		rollback:  s.rollback,
+		steps:     s.steps,
+	}
+	r.report.Start, r.report.End = span(requests, samples)
+	r.clock = clock.NewFake(r.report.Start)
+	if err = r.build(s.trees, "rules"); err != nil {
+		return nil, err
+	}
+
+	i, j := 0, 0
+	for i < len(requests) || j < len(samples) {
+		if j < len(samples) && (i == len(requests) || !requests[i].Timestamp.Before(samples[j].Timestamp)) {
+			r.advance(samples[j].Timestamp)
+			r.sample(samples[j])
+			j++
+			continue
+		}
+
+		r.advance(requests[i].Timestamp)
+		r.request(&requests[i])
+		i++
+	}
+
+	return r.report, nil
+}
+
+func span(requests []Request, samples []Sample) (time.Time, time.Time) {
+	var start, end time.Time
+	update := func(t time.Time) {
+		if start.IsZero() || t.Before(start) {
+			start = t
+		}
+		if t.After(end) {
+			end = t
+		}
+	}
+
+	if len(requests) > 0 {
+		update(requests[0].Timestamp)
+		update(requests[len(requests)-1].Timestamp)
+	}
+	if len(samples) > 0 {
+		update(samples[0].Timestamp)
+		update(samples[len(samples)-1].Timestamp)
+	}
+
+	return start, end
+}
+
+// build create the states of rules in depth first order.
+func (r *run) build(trees []engine.RuleTree, path string) error {
+	for i := range trees {
+		rt := &trees[i]
+		p := path
+		if rt.GetScope().Type != "" {
+			p = fmt.Sprintf("%s.children[%d]", path, i)
+		}
+
+		period, err := time.ParseDuration(string(rt.GetPeriod()))
+		if err != nil {
+			return &engine.FieldError{Path: p + ".period", Err: err}
+		}
+
+		st := &rule{
+			tree:    rt,
+			period:  period,
+			rate:    rt.GetBaseThreshold(),
+			windows: map[string]window{},
+			clock:   r.clock,
+			report: &RuleReport{
+				Path:  p,
+				Scope: rt.GetScope(),
+				Mode:  rt.GetMode(),
+				Thresholds: []ThresholdPoint{{
+					At:        r.report.Start,
+					Threshold: rt.GetBaseThreshold(),
+				}},
+			},
+		}
+		if kind, ok := engine.LookupScopeType(rt.GetScope().Type); ok && kind.PerEntity {
+			st.extract = kind.Extractor
+		}
+
+		r.rules[rt] = st
+		lat := rt.GetScope().Value
+		r.latitudes[lat] = append(r.latitudes[lat], st)
+		r.report.Rules = append(r.report.Rules, st.report)
+
+		if err = r.build(rt.GetChildren(), p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sample report the metrics to the decision strategy, and apply the
+// adjusted rates, the adjustments of the shadow rules are recorded only.
+func (r *run) sample(sample Sample) {
+	m := sample.Metrics
+	if m.Timestamp.IsZero() {
+		m.Timestamp = sample.Timestamp
+	}
+
+	res := r.stg.AdjustRate(context.Background(), sample.Latitude, m)
+	if res.Err != nil {
+		r.report.Errors = append(r.report.Errors, SampleError{
+			At:       sample.Timestamp,
+			Latitude: sample.Latitude,
+			Err:      res.Err.Error(),
+		})
+		return
+	}
+
+	ls, ok := r.statuses[sample.Latitude]
+	if !ok {
+		ls = engine.NewLimitStatus(r.rollback, r.steps)
+		r.statuses[sample.Latitude] = ls
+	}
+	if ls.Transit(res.Trace.Result, sample.Timestamp) {
+		for _, st := range r.latitudes[sample.Latitude] {
+			st.report.States = append(st.report.States, StatePoint{
+				At:    sample.Timestamp,
+				State: ls.State().String(),
+				Step:  ls.Step(),
+			})
+		}
+	}
+
+	for _, adj := range res.Adjustments {
+		for _, st := range r.latitudes[adj.Latitude] {
+			st.report.Thresholds = append(st.report.Thresholds, ThresholdPoint{
+				At:        sample.Timestamp,
+				Threshold: uint64(adj.Rate),
+				Shadow:    adj.Shadow,
+			})
+			if !adj.Shadow {
+				st.setRate(uint64(adj.Rate))
+			}
+		}
+	}
+}
+
+// advance move the virtual clock to now, the requests finished meanwhile
+// are released in order of end.
+func (r *run) advance(now time.Time) {
+	for len(r.releases) > 0 && !r.releases[0].end.After(now) {
+		rel := r.releases[0]
+		r.releases = r.releases[1:]
+		r.clock.Set(rel.end)
+		rel.done()
+	}
+	r.clock.Set(now)
+}
+
+// hold keep the request in flight until end.
+func (r *run) hold(end time.Time, done func()) {
+	i := sort.Search(len(r.releases), func(i int) bool {
+		return r.releases[i].end.After(end)
+	})
+	r.releases = append(r.releases, release{})
+	copy(r.releases[i+1:], r.releases[i:])
+	r.releases[i] = release{end: end, done: done}
+}
+
+// request limit the request by the matched rules from the root to the
+// deepest, it is rejected by the first enforced rule over limit, the
+// shadow rules record the would-reject decisions only. The request
+// admitted holds the concurrency of rules for its duration, and the
+// request rejected releases them at once.
+func (r *run) request(req *Request) {
+	er := req.request()
+	var held []func()
+	for _, rt := range r.matcher.MatchPath(er) {
+		st := r.rules[rt]
+		if done, ok := st.allow(er); ok {
+			st.report.Admitted++
+			if done != nil {
+				held = append(held, done)
+			}
+			continue
+		}
+
+		if rt.IsShadow() {
+			st.report.Admitted++
+			st.report.WouldReject++
+			continue
+		}
+
+		st.report.Rejected++
+		r.report.Rejected++
+		for _, done := range held {
+			done()
+		}
+		return
+	}
+
+	r.report.Admitted++
+	for _, done := range held {
+		if req.Duration > 0 {
+			r.hold(req.Timestamp.Add(req.Duration), done)
+		} else {
+			done()
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/limiter"
+	"github.com/TimeWtr/gox/limiter/distributed/engine"
+	"github.com/TimeWtr/gox/limiter/local"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const conf = `{
+  "redis_cluster": {"addr": ["127.0.0.1:6379"]},
+  "defaults": {"strategy": "qps", "period": "1s", "priority": "low"},
+  "rules": {
+    "base_threshold": 1000,
+    "children": [
+      {
+        "scope": {"type": "service", "value": "order_service"},
+        "base_threshold": 10,
+        "min_threshold": 2,
+        "trigger": "cpu_usage > 0.8",
+        "children": [
+          {
+            "scope": {"type": "api", "value": "/api/v1/order"},
+            "base_threshold": 5,
+            "mode": "shadow"
+          }
+        ]
+      }
+    ]
+  }
+}`
+
+func TestSimulator_Run(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time {
+		return start.Add(d)
+	}
+
+	var trace Trace
+	for i := 0; i < 20; i++ {
+		trace.Requests = append(trace.Requests, Request{
+			Timestamp: at(time.Duration(i) * 10 * time.Millisecond),
+			Service:   "order_service",
+			API:       "/api/v1/order",
+		})
+	}
+	for i := 0; i < 5; i++ {
+		trace.Requests = append(trace.Requests, Request{
+			Timestamp: at(2100*time.Millisecond + time.Duration(i)*time.Millisecond),
+			Service:   "order_service",
+			API:       "/api/v1/user",
+		})
+	}
+	trace.Requests = append(trace.Requests, Request{Timestamp: at(2500 * time.Millisecond), Service: "user_service"})
+	trace.Samples = []Sample{
+		{Timestamp: at(2 * time.Second), Latitude: "order_service", Metrics: engine.Metrics{CPUUsage: 0.9}},
+		{Timestamp: at(3 * time.Second), Latitude: "order_service", Metrics: engine.Metrics{CPUUsage: 0.1}},
+		{Timestamp: at(4 * time.Second), Latitude: "order_service", Metrics: engine.Metrics{CPUUsage: 0.1}},
+		{Timestamp: at(4 * time.Second), Latitude: "unknown_service"},
+	}
+
+	sim, err := New(engine.NewJsonParser([]byte(conf)), WithRecoverSteps(false, []int{1}))
+	require.NoError(t, err)
+	report, err := sim.Run(trace)
+	require.NoError(t, err)
+
+	assert.Equal(t, start, report.Start)
+	assert.Equal(t, at(4*time.Second), report.End)
+	assert.Equal(t, uint64(13), report.Admitted)
+	assert.Equal(t, uint64(13), report.Rejected)
+	require.Len(t, report.Errors, 1)
+	assert.Equal(t, "unknown_service", report.Errors[0].Latitude)
+
+	require.Len(t, report.Rules, 3)
+	root, service, api := report.Rules[0], report.Rules[1], report.Rules[2]
+	assert.Equal(t, "rules", root.Path)
+	assert.Equal(t, uint64(26), root.Admitted)
+
+	assert.Equal(t, "rules.children[0]", service.Path)
+	assert.Equal(t, uint64(12), service.Admitted)
+	assert.Equal(t, uint64(13), service.Rejected)
+	assert.Equal(t, []ThresholdPoint{
+		{At: start, Threshold: 10},
+		{At: at(2 * time.Second), Threshold: 2},
+		{At: at(3 * time.Second), Threshold: 10},
+	}, service.Thresholds)
+	assert.Equal(t, []StatePoint{
+		{At: at(2 * time.Second), State: engine.StatusThrottling.String()},
+		{At: at(3 * time.Second), State: engine.StatusRecovering.String()},
+		{At: at(4 * time.Second), State: engine.StatusNormal.String()},
+	}, service.States)
+
+	// the shadow rule admits all and records the would-reject ones.
+	assert.Equal(t, "rules.children[0].children[0]", api.Path)
+	assert.Equal(t, engine.ModeShadow, api.Mode)
+	assert.Equal(t, uint64(10), api.Admitted)
+	assert.Equal(t, uint64(0), api.Rejected)
+	assert.Equal(t, uint64(5), api.WouldReject)
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteText(&buf))
+	assert.True(t, strings.Contains(buf.String(), "+2s=2"))
+	t.Log("\n" + buf.String())
+}
+
+func TestSimulator_Limiters(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	offsets := []time.Duration{0, 0, 0, 100 * time.Millisecond, 400 * time.Millisecond,
+		600 * time.Millisecond, 950 * time.Millisecond, time.Second, 1100 * time.Millisecond,
+		1500 * time.Millisecond, 2200 * time.Millisecond}
+
+	testCases := []struct {
+		name      string
+		algorithm engine.AlgorithmType
+		// the limiter of production admitting 2 requests per second.
+		newLimiter func(c clock.Clock) limiter.Limiter
+	}{
+		{
+			name:      "token bucket",
+			algorithm: engine.AlgorithmTypeTokenBucket,
+			newLimiter: func(c clock.Clock) limiter.Limiter {
+				return local.NewTokenBucket(2, 2, local.WithClock(c))
+			},
+		},
+		{
+			name:      "leaky bucket",
+			algorithm: engine.AlgorithmTypeLeakBucket,
+			newLimiter: func(c clock.Clock) limiter.Limiter {
+				return local.NewLeakyBucket(500*time.Millisecond, local.WithClock(c))
+			},
+		},
+		{
+			name:      "fixed window",
+			algorithm: engine.AlgorithmTypeFixedWindow,
+			newLimiter: func(c clock.Clock) limiter.Limiter {
+				return local.NewFixedWindow(time.Second, 2, local.WithClock(c))
+			},
+		},
+		{
+			name:      "sliding window",
+			algorithm: engine.AlgorithmTypeSlidingWindow,
+			newLimiter: func(c clock.Clock) limiter.Limiter {
+				return local.NewSlidingWindow(time.Second, 2, local.WithClock(c))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cf := fmt.Sprintf(`{
+			  "redis_cluster": {"addr": ["127.0.0.1:6379"]},
+			  "rules": {
+			    "base_threshold": 1000,
+			    "strategy": "qps",
+			    "period": "1s",
+			    "priority": "low",
+			    "children": [{
+			      "scope": {"type": "api", "value": "/api/v1/order"},
+			      "base_threshold": 2,
+			      "algorithm": %q
+			    }]
+			  }
+			}`, tc.algorithm)
+
+			var trace Trace
+			for _, off := range offsets {
+				trace.Requests = append(trace.Requests, Request{Timestamp: start.Add(off), API: "/api/v1/order"})
+			}
+			sim, err := New(engine.NewJsonParser([]byte(cf)))
+			require.NoError(t, err)
+			report, err := sim.Run(trace)
+			require.NoError(t, err)
+
+			// the simulation admits the same as the limiter of production.
+			c := clock.NewFake(start)
+			l := tc.newLimiter(c)
+			var want uint64
+			for _, off := range offsets {
+				c.Set(start.Add(off))
+				if ok, _ := l.Allow(context.Background()); ok {
+					want++
+				}
+			}
+			assert.Equal(t, want, report.Rules[1].Admitted)
+			assert.Equal(t, uint64(len(offsets))-want, report.Rules[1].Rejected)
+		})
+	}
+}
+
+func TestSimulator_Concurrency(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cf := `{
+	  "redis_cluster": {"addr": ["127.0.0.1:6379"]},
+	  "rules": {
+	    "base_threshold": 1000,
+	    "strategy": "concurrency",
+	    "period": "1s",
+	    "priority": "low",
+	    "children": [{
+	      "scope": {"type": "api", "value": "/api/v1/order"},
+	      "base_threshold": 2
+	    }]
+	  }
+	}`
+
+	var trace Trace
+	for _, off := range []time.Duration{0, 0, 0, 500 * time.Millisecond, 500 * time.Millisecond} {
+		trace.Requests = append(trace.Requests, Request{
+			Timestamp: start.Add(off),
+			API:       "/api/v1/order",
+			Duration:  500 * time.Millisecond,
+		})
+	}
+
+	sim, err := New(engine.NewJsonParser([]byte(cf)))
+	require.NoError(t, err)
+	report, err := sim.Run(trace)
+	require.NoError(t, err)
+
+	// the requests finished at 500ms release the slots.
+	assert.Equal(t, uint64(4), report.Rules[1].Admitted)
+	assert.Equal(t, uint64(1), report.Rules[1].Rejected)
+}
+
+func TestLoadTrace(t *testing.T) {
+	f, err := os.Open("./examples/trace.json")
+	require.NoError(t, err)
+	defer f.Close()
+
+	trace, err := LoadTrace(f)
+	require.NoError(t, err)
+	assert.NotEmpty(t, trace.Requests)
+	assert.NotEmpty(t, trace.Samples)
+
+	_, err = LoadTrace(strings.NewReader(`{"requests": [{"unknown": 1}]}`))
+	assert.Error(t, err)
+}
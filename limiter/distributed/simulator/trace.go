@@ -0,0 +1,92 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/TimeWtr/gox/limiter/distributed/engine"
+)
+
+// Request the recorded request, the attributes are matched against the
+// scopes of rules the same as engine.Request.
+type Request struct {
+	Timestamp  time.Time         `json:"timestamp"`
+	Service    string            `json:"service,omitempty"`
+	API        string            `json:"api,omitempty"`
+	User       string            `json:"user,omitempty"`
+	UserLabels map[string]string `json:"user_labels,omitempty"`
+	IP         string            `json:"ip,omitempty"`
+	Tenant     string            `json:"tenant,omitempty"`
+	Method     string            `json:"method,omitempty"`
+	GRPCMethod string            `json:"grpc_method,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Attrs      map[string]string `json:"attrs,omitempty"`
+	// the time of processing the request, only used by the concurrency
+	// strategy, zero means the request finishes immediately.
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+func (r *Request) request() engine.Request {
+	req := engine.Request{
+		Service:    r.Service,
+		API:        r.API,
+		User:       r.User,
+		UserLabels: r.UserLabels,
+		IP:         r.IP,
+		Tenant:     r.Tenant,
+		Method:     r.Method,
+		GRPCMethod: r.GRPCMethod,
+		Attrs:      r.Attrs,
+	}
+
+	if len(r.Headers) > 0 {
+		req.Headers = make(http.Header, len(r.Headers))
+		for k, v := range r.Headers {
+			req.Headers.Set(k, v)
+		}
+	}
+
+	return req
+}
+
+// Sample the recorded metrics of latitude, it is reported to the decision
+// strategy at Timestamp.
+type Sample struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Latitude  string         `json:"latitude"`
+	Metrics   engine.Metrics `json:"metrics"`
+}
+
+// Trace the recorded requests and metrics samples to replay.
+type Trace struct {
+	Requests []Request `json:"requests"`
+	Samples  []Sample  `json:"samples"`
+}
+
+// LoadTrace decode the json trace.
+func LoadTrace(r io.Reader) (Trace, error) {
+	var t Trace
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return Trace{}, err
+	}
+
+	return t, nil
+}
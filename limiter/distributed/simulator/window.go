@@ -0,0 +1,111 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"context"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/limiter"
+	"github.com/TimeWtr/gox/limiter/distributed/engine"
+	"github.com/TimeWtr/gox/limiter/local"
+)
+
+// window the limiter of rule on the virtual clock, done is called when the
+// request admitted finishes, nil if the limiter holds nothing.
+type window interface {
+	allow() (done func(), ok bool)
+	close()
+}
+
+// newWindow create the local limiter of rule by its strategy and algorithm
+// admitting rate requests per period on the virtual clock, the rule
+// without algorithm uses the fixed window. The limiters are the same as
+// production, so that the simulation predicts their behaviors.
+func newWindow(rt *engine.RuleTree, rate uint64, period time.Duration, c clock.Clock) window {
+	if rate == 0 {
+		return rejectWindow{}
+	}
+
+	if rt.GetStrategy() == engine.StrategyConcurrency {
+		n := int(min(rate, uint64(maxLimit)))
+		return concurrencyWindow{local.NewAdaptiveLimiter(local.NewAIMD(),
+			local.WithLimitBounds(n, n), local.WithInitialLimit(n), local.WithAdaptiveClock(c))}
+	}
+
+	var l limiter.Limiter
+	switch rt.GetAlgorithm() {
+	case engine.AlgorithmTypeTokenBucket:
+		l = local.NewTokenBucket(float64(rate)/period.Seconds(), int64(rate), local.WithClock(c))
+	case engine.AlgorithmTypeLeakBucket:
+		// the rate over one per nanosecond is simulated as the max.
+		l = local.NewLeakyBucket(max(1, period/time.Duration(rate)), local.WithClock(c))
+	case engine.AlgorithmTypeSlidingWindow:
+		l = local.NewSlidingWindow(period, int(rate), local.WithClock(c))
+	default:
+		l = local.NewFixedWindow(period, int64(rate), local.WithClock(c))
+	}
+
+	return rateWindow{l}
+}
+
+// the max concurrency limit of int.
+const maxLimit = int(^uint(0) >> 1)
+
+// rateWindow the rate limiter, the request admitted holds nothing.
+type rateWindow struct {
+	l limiter.Limiter
+}
+
+func (w rateWindow) allow() (func(), bool) {
+	ok, _ := w.l.Allow(context.Background())
+	return nil, ok
+}
+
+func (w rateWindow) close() {
+	w.l.Close()
+}
+
+// concurrencyWindow the concurrency limiter with the fixed limit, the
+// request admitted holds a slot until done.
+type concurrencyWindow struct {
+	l *local.AdaptiveLimiter
+}
+
+func (w concurrencyWindow) allow() (func(), bool) {
+	release, err := w.l.Acquire(context.Background())
+	if err != nil {
+		return nil, false
+	}
+
+	// the outcome is ignored, so that the limit is never tuned.
+	return func() {
+		release(local.OutcomeIgnore)
+	}, true
+}
+
+func (w concurrencyWindow) close() {
+	w.l.Close()
+}
+
+// rejectWindow the rule of zero rate rejects all the requests.
+type rejectWindow struct{}
+
+func (rejectWindow) allow() (func(), bool) {
+	return nil, false
+}
+
+func (rejectWindow) close() {}
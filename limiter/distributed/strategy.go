@@ -16,6 +16,8 @@ package distributed
 
 import (
 	"context"
+	"fmt"
+	"sync"
 
 	"github.com/TimeWtr/gox/limiter/distributed/engine"
 )
@@ -23,21 +25,55 @@ import (
 // DecisionStrategy The decision-making strategy interface decides whether to dynamically
 // adjust the request rate limit based on the real-time incoming indicator data.
 type DecisionStrategy interface {
-	// AdjustRate Calculate and decide whether to adjust the request rate.
-	AdjustRate(ctx context.Context, metrics engine.Metrics) Value
+	// AdjustRate Calculate and decide whether to adjust the request rate of latitude.
+	AdjustRate(ctx context.Context, latitude string, metrics engine.Metrics) Value
 }
 
 type Value struct {
 	// Whether to adjust,if so,it returns true, otherwise it returns false.
 	Adjust bool
-	// if Adjust is true, it returns rate number, normal is zero.
+	// if the latitude itself is adjusted, it returns rate number, normal is zero.
 	Rate float64
+	// all the latitudes adjusted by the decision, the trigger of latitude
+	// sheds its lower priority children first.
+	Adjustments []Adjustment
+	// the evaluated trigger tree of the decision, nil if the rule has no trigger.
+	Trace *engine.Trace
 	// if decision is fail, it returns error.
 	Err error
 }
 
+// Adjustment the adjusted rate of latitude.
+type Adjustment struct {
+	Latitude string
+	Priority engine.PriorityType
+	Rate     float64
+	// the rate is cut down to the min threshold, false if restored.
+	Shed bool
+	// the rule of latitude is in shadow mode, the adjustment is recorded
+	// only and must not be applied.
+	Shadow bool
+}
+
+// BS the basic decision strategy, when the trigger of latitude fires, it
+// sheds the rules in the subtree of latitude by priority: the low priority
+// rules are cut to the min threshold first, then the medium ones if the
+// trigger keeps firing, and the high ones as the last resort. When the
+// trigger recovers, the rules are restored in the reverse order. The
+// adjustments of the rules in shadow mode are marked Shadow.
 type BS struct {
 	conf engine.Conf
+	// the rule trees built from conf.
+	trees []engine.RuleTree
+	// the shed level of the latitudes whose trigger fired, it is the
+	// highest priority rank of the rules cut down in the subtree.
+	levels map[string]int
+	// the latitudes cut down to the min threshold now.
+	shed map[string]*engine.RuleTree
+	// the last known metrics of latitudes.
+	histories map[string]*engine.MetricsHistory
+	// locker
+	mu *sync.Mutex
 }
 
 func NewBS(p engine.Parser) (DecisionStrategy, error) {
@@ -45,12 +81,23 @@ func NewBS(p engine.Parser) (DecisionStrategy, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	trees, err := cf.RuleTrees()
+	if err != nil {
+		return nil, err
+	}
+
 	return &BS{
-		conf: cf,
+		conf:      cf,
+		trees:     trees,
+		levels:    map[string]int{},
+		shed:      map[string]*engine.RuleTree{},
+		histories: map[string]*engine.MetricsHistory{},
+		mu:        new(sync.Mutex),
 	}, nil
 }
 
-func (b *BS) AdjustRate(ctx context.Context, metrics engine.Metrics) Value {
+func (b *BS) AdjustRate(ctx context.Context, latitude string, metrics engine.Metrics) Value {
 	select {
 	case <-ctx.Done():
 		return Value{
@@ -59,10 +106,189 @@ func (b *BS) AdjustRate(ctx context.Context, metrics engine.Metrics) Value {
 	default:
 	}
 
-	return Value{}
+	rt := engine.FindRuleTree(b.trees, latitude)
+	if rt == nil {
+		return Value{
+			Err: fmt.Errorf("latitude %s not found in rules", latitude),
+		}
+	}
+
+	trace, err := b.checker(rt, b.history(latitude), metrics)
+	if err != nil {
+		return Value{
+			Trace: trace,
+			Err:   err,
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// escalate one priority level while the trigger keeps firing, otherwise
+	// de-escalate one level until recovered.
+	level := b.levels[latitude]
+	if trace.Result {
+		level = nextLevel(rt, level)
+	} else {
+		level = prevLevel(rt, level)
+	}
+	if level == 0 {
+		delete(b.levels, latitude)
+	} else {
+		b.levels[latitude] = level
+	}
+
+	res := Value{Trace: trace, Adjustments: b.reconcile()}
+	for _, adj := range res.Adjustments {
+		// the shadow adjustments are recorded only, not adjusted.
+		if adj.Shadow {
+			continue
+		}
+		res.Adjust = true
+		if adj.Latitude == latitude {
+			res.Rate = adj.Rate
+		}
+	}
+
+	return res
 }
 
-func (b *BS) checker(metrics engine.Metrics) (alarm bool, err error) {
+// reconcile cut down the rules whose priority is within the shed level of
+// itself or any ancestor, and restore the others, it returns the changed ones.
+func (b *BS) reconcile() []Adjustment {
+	var adjustments []Adjustment
+	var walk func(trees []engine.RuleTree, parentLevel int)
+	walk = func(trees []engine.RuleTree, parentLevel int) {
+		for i := range trees {
+			rt := &trees[i]
+			lat := rt.GetScope().Value
+			level := max(parentLevel, b.levels[lat])
+
+			_, shed := b.shed[lat]
+			want := sheddable(rt) && priorityRank(rt.GetPriority()) <= level
+			switch {
+			case want && !shed:
+				b.shed[lat] = rt
+				adjustments = append(adjustments, Adjustment{
+					Latitude: lat,
+					Priority: rt.GetPriority(),
+					Rate:     float64(rt.GetMinThreshold()),
+					Shed:     true,
+					Shadow:   rt.IsShadow(),
+				})
+			case !want && shed && b.shed[lat] == rt:
+				delete(b.shed, lat)
+				adjustments = append(adjustments, Adjustment{
+					Latitude: lat,
+					Priority: rt.GetPriority(),
+					Rate:     float64(rt.GetBaseThreshold()),
+					Shadow:   rt.IsShadow(),
+				})
+			}
+
+			walk(rt.GetChildren(), level)
+		}
+	}
+	walk(b.trees, 0)
+
+	return adjustments
+}
+
+// sheddable report whether the rule can be cut down, the rule without min
+// threshold has nothing to cut to.
+func sheddable(rt *engine.RuleTree) bool {
+	return rt.GetMinThreshold() > 0 && rt.GetMinThreshold() < rt.GetBaseThreshold()
+}
+
+// priorityRank the shed order of priority, the lower rank is shed first.
+func priorityRank(p engine.PriorityType) int {
+	switch p {
+	case engine.PriorityTypeHigh:
+		return 3
+	case engine.PriorityTypeMedium:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// levels return the sorted priority ranks of the sheddable rules in subtree.
+func levels(rt *engine.RuleTree) []int {
+	var present [4]bool
+	var walk func(rt *engine.RuleTree)
+	walk = func(rt *engine.RuleTree) {
+		if sheddable(rt) {
+			present[priorityRank(rt.GetPriority())] = true
+		}
+		children := rt.GetChildren()
+		for i := range children {
+			walk(&children[i])
+		}
+	}
+	walk(rt)
+
+	var res []int
+	for rank, ok := range present {
+		if ok {
+			res = append(res, rank)
+		}
+	}
+
+	return res
+}
+
+// nextLevel return the next shed level of subtree, the level without
+// sheddable rules is skipped, it keeps the level if all are shed.
+func nextLevel(rt *engine.RuleTree, level int) int {
+	for _, rank := range levels(rt) {
+		if rank > level {
+			return rank
+		}
+	}
+
+	return level
+}
+
+// prevLevel return the previous shed level of subtree, zero if recovered.
+func prevLevel(rt *engine.RuleTree, level int) int {
+	res := 0
+	for _, rank := range levels(rt) {
+		if rank < level {
+			res = rank
+		}
+	}
+
+	return res
+}
+
+// checker evaluate the trigger of rule, the rule without trigger never fires.
+// the metrics not reported are resolved by the missing policy of rule and
+// the reported ones are recorded as the last known values after evaluation.
+func (b *BS) checker(rt *engine.RuleTree, history *engine.MetricsHistory,
+	metrics engine.Metrics) (*engine.Trace, error) {
+	defer history.Record(metrics)
+
+	ast := rt.GetTriggerAST()
+	if ast == nil {
+		return &engine.Trace{}, nil
+	}
+
+	ctx := engine.NewEvalContext(metrics).
+		WithMissingPolicy(rt.GetMissingPolicy(), history, rt.GetStaleTTL())
+	trace := ast.Explain(ctx)
+	return trace, trace.Err
+}
+
+// history return the last known metrics of latitude.
+func (b *BS) history(latitude string) *engine.MetricsHistory {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h, ok := b.histories[latitude]
+	if !ok {
+		h = engine.NewMetricsHistory()
+		b.histories[latitude] = h
+	}
 
-	return false, nil
+	return h
 }
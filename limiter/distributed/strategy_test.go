@@ -16,6 +16,8 @@ package distributed
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/TimeWtr/gox/limiter/distributed/engine"
@@ -29,5 +31,224 @@ func TestNewBS(t *testing.T) {
 	assert.Nil(t, err)
 	bs, err := NewBS(p)
 	assert.Nil(t, err)
-	bs.AdjustRate(context.Background(), engine.Metrics{})
+	bs.AdjustRate(context.Background(), "order_service", engine.Metrics{})
+}
+
+func TestBS_AdjustRate(t *testing.T) {
+	fs := engine.NewFileSource("./engine/examples/rule.json", engine.DataTypeJson)
+	p, err := engine.NewParser(fs)
+	assert.Nil(t, err)
+	bs, err := NewBS(p)
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		name            string
+		latitude        string
+		metrics         engine.Metrics
+		wantAdjust      bool
+		wantRate        float64
+		wantAdjustments []Adjustment
+		wantFired       []string
+		wantErr         bool
+	}{
+		{
+			name:     "normal",
+			latitude: "order_service",
+			metrics:  engine.Metrics{CPUUsage: 0.5, MemUsage: 0.5},
+		},
+		{
+			name:       "trigger fired, shed low priority",
+			latitude:   "order_service",
+			metrics:    engine.Metrics{CPUUsage: 0.9, MemUsage: 0.5},
+			wantAdjust: true,
+			wantAdjustments: []Adjustment{
+				{Latitude: "/api/v1/order", Priority: engine.PriorityTypeLow, Rate: 100, Shed: true},
+				{Latitude: "/api/v1/user", Priority: engine.PriorityTypeLow, Rate: 100, Shed: true},
+			},
+			wantFired: []string{"cpu_usage > 0.8"},
+		},
+		{
+			name:       "keep firing, shed medium priority",
+			latitude:   "order_service",
+			metrics:    engine.Metrics{CPUUsage: 0.5, MemUsage: 0.9},
+			wantAdjust: true,
+			wantRate:   300,
+			wantAdjustments: []Adjustment{
+				{Latitude: "order_service", Priority: engine.PriorityTypeMedium, Rate: 300, Shed: true},
+			},
+			wantFired: []string{"mem_usage > 0.8"},
+		},
+		{
+			name:      "keep firing, no high priority in subtree",
+			latitude:  "order_service",
+			metrics:   engine.Metrics{CPUUsage: 0.9, MemUsage: 0.9},
+			wantFired: []string{"cpu_usage > 0.8", "mem_usage > 0.8"},
+		},
+		{
+			name:       "recovering, restore medium priority",
+			latitude:   "order_service",
+			metrics:    engine.Metrics{CPUUsage: 0.5, MemUsage: 0.5},
+			wantAdjust: true,
+			wantRate:   1000,
+			wantAdjustments: []Adjustment{
+				{Latitude: "order_service", Priority: engine.PriorityTypeMedium, Rate: 1000},
+			},
+		},
+		{
+			name:       "recovered, restore low priority",
+			latitude:   "order_service",
+			metrics:    engine.Metrics{CPUUsage: 0.5, MemUsage: 0.5},
+			wantAdjust: true,
+			wantAdjustments: []Adjustment{
+				{Latitude: "/api/v1/order", Priority: engine.PriorityTypeLow, Rate: 500},
+				{Latitude: "/api/v1/user", Priority: engine.PriorityTypeLow, Rate: 300},
+			},
+		},
+		{
+			name:     "unknown latitude",
+			latitude: "unknown_service",
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := bs.AdjustRate(context.Background(), tc.latitude, tc.metrics)
+			assert.Equal(t, tc.wantErr, res.Err != nil)
+			if res.Err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantAdjust, res.Adjust)
+			assert.Equal(t, tc.wantRate, res.Rate)
+			assert.Equal(t, tc.wantAdjustments, res.Adjustments)
+
+			var fired []string
+			for _, c := range res.Trace.Fired() {
+				fired = append(fired, c.Expr)
+			}
+			assert.Equal(t, tc.wantFired, fired)
+			t.Logf("trace: %s", res.Trace)
+		})
+	}
+}
+
+func TestBS_AdjustRate_Priority(t *testing.T) {
+	rules := engine.Rule{
+		BaseThreshold: 10000,
+		MinThreshold:  5000,
+		Strategy:      engine.StrategyQPS,
+		Period:        "1s",
+		Priority:      engine.PriorityTypeHigh,
+		Trigger:       "cpu_usage > 0.8",
+		Children: []engine.Rule{
+			{
+				Scope:         engine.Scope{Type: engine.ScopeTypeService, Value: "order_service"},
+				BaseThreshold: 1000,
+				MinThreshold:  100,
+				Priority:      engine.PriorityTypeLow,
+			},
+			{
+				Scope:         engine.Scope{Type: engine.ScopeTypeService, Value: "pay_service"},
+				BaseThreshold: 1000,
+				MinThreshold:  500,
+				Priority:      engine.PriorityTypeMedium,
+			},
+		},
+	}
+	trees, err := engine.BuildRuleTrees(rules)
+	assert.NoError(t, err)
+	bs := &BS{
+		trees:     trees,
+		levels:    map[string]int{},
+		shed:      map[string]*engine.RuleTree{},
+		histories: map[string]*engine.MetricsHistory{},
+		mu:        new(sync.Mutex),
+	}
+
+	fired := engine.Metrics{CPUUsage: 0.9}
+	normal := engine.Metrics{CPUUsage: 0.1}
+	steps := []struct {
+		metrics engine.Metrics
+		want    []string
+	}{
+		{metrics: fired, want: []string{"order_service=100"}},
+		{metrics: fired, want: []string{"pay_service=500"}},
+		{metrics: fired, want: []string{"=5000"}},
+		{metrics: fired},
+		{metrics: normal, want: []string{"=10000"}},
+		{metrics: normal, want: []string{"pay_service=1000"}},
+		{metrics: normal, want: []string{"order_service=1000"}},
+		{metrics: normal},
+	}
+
+	for i, step := range steps {
+		res := bs.AdjustRate(context.Background(), "", step.metrics)
+		assert.NoError(t, res.Err)
+
+		var got []string
+		for _, adj := range res.Adjustments {
+			got = append(got, fmt.Sprintf("%s=%v", adj.Latitude, adj.Rate))
+		}
+		assert.Equal(t, step.want, got, "step %d", i)
+	}
+}
+
+func TestBS_AdjustRate_Shadow(t *testing.T) {
+	rules := engine.Rule{
+		BaseThreshold: 10000,
+		Strategy:      engine.StrategyQPS,
+		Period:        "1s",
+		Priority:      engine.PriorityTypeHigh,
+		Trigger:       "cpu_usage > 0.8",
+		Children: []engine.Rule{
+			{
+				Scope:         engine.Scope{Type: engine.ScopeTypeService, Value: "order_service"},
+				BaseThreshold: 1000,
+				MinThreshold:  100,
+				Priority:      engine.PriorityTypeLow,
+			},
+			{
+				Scope:         engine.Scope{Type: engine.ScopeTypeService, Value: "pay_service"},
+				BaseThreshold: 1000,
+				MinThreshold:  500,
+				Priority:      engine.PriorityTypeLow,
+				Trigger:       "cpu_usage > 0.9",
+				Mode:          engine.ModeShadow,
+			},
+		},
+	}
+	trees, err := engine.BuildRuleTrees(rules)
+	assert.NoError(t, err)
+	bs := &BS{
+		trees:     trees,
+		levels:    map[string]int{},
+		shed:      map[string]*engine.RuleTree{},
+		histories: map[string]*engine.MetricsHistory{},
+		mu:        new(sync.Mutex),
+	}
+
+	res := bs.AdjustRate(context.Background(), "", engine.Metrics{CPUUsage: 0.9})
+	assert.NoError(t, res.Err)
+	assert.Equal(t, []Adjustment{
+		{Latitude: "order_service", Priority: engine.PriorityTypeLow, Rate: 100, Shed: true},
+		{Latitude: "pay_service", Priority: engine.PriorityTypeLow, Rate: 500, Shed: true, Shadow: true},
+	}, res.Adjustments)
+	assert.True(t, res.Adjust)
+
+	// the shadow rule is restored with the enforced ones.
+	res = bs.AdjustRate(context.Background(), "", engine.Metrics{CPUUsage: 0.1})
+	assert.NoError(t, res.Err)
+	assert.Equal(t, []Adjustment{
+		{Latitude: "order_service", Priority: engine.PriorityTypeLow, Rate: 1000},
+		{Latitude: "pay_service", Priority: engine.PriorityTypeLow, Rate: 1000, Shadow: true},
+	}, res.Adjustments)
+
+	// the shadow latitude itself is not adjusted.
+	res = bs.AdjustRate(context.Background(), "pay_service", engine.Metrics{CPUUsage: 0.95})
+	assert.NoError(t, res.Err)
+	assert.Equal(t, []Adjustment{
+		{Latitude: "pay_service", Priority: engine.PriorityTypeLow, Rate: 500, Shed: true, Shadow: true},
+	}, res.Adjustments)
+	assert.False(t, res.Adjust)
+	assert.Zero(t, res.Rate)
 }
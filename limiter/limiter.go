@@ -16,12 +16,19 @@ package limiter
 
 import (
 	"context"
+
+	"github.com/TimeWtr/gox/errorx"
 )
 
 // Limiter signal machine Limiter Unified Interface
 type Limiter interface {
 	// Allow To determine whether to allow the request to be processed
 	Allow(ctx context.Context) (bool, error)
+	// AllowN To determine whether to allow the request costing n units, such
+	// as bytes or rows, it is the same as Allow if n is 1. The zero cost is
+	// always allowed, and errorx.ErrExceedCapacity is returned if n exceeds
+	// the capacity of limiter, that the request is never allowed.
+	AllowN(ctx context.Context, n int) (bool, error)
 	// Close send signal to close the limiter
 	Close()
 }
@@ -31,6 +38,24 @@ type DisLimiter interface {
 	// ctx context.Context
 	// key is required if latitude is IP or User.
 	Allow(ctx context.Context, key ...string) (bool, error)
+	// AllowN To determine whether to allow the request costing n units, the
+	// semantics of n is the same as Limiter.AllowN.
+	AllowN(ctx context.Context, n int, key ...string) (bool, error)
 	// Close send signal to close the limiter
 	Close()
 }
+
+// CheckCost check the cost of request against the capacity of limiter, it
+// returns true if the request costs nothing and is allowed at once.
+func CheckCost(n int, capacity int64) (bool, error) {
+	switch {
+	case n < 0:
+		return false, errorx.ErrInvalidCost
+	case n == 0:
+		return true, nil
+	case int64(n) > capacity:
+		return false, errorx.ErrExceedCapacity
+	default:
+		return false, nil
+	}
+}
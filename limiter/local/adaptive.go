@@ -0,0 +1,382 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+)
+
+// Outcome the outcome of request reported by the release callback.
+type Outcome int
+
+const (
+	// OutcomeSuccess the request succeeded, the latency is sampled.
+	OutcomeSuccess Outcome = iota
+	// OutcomeDropped the request failed by overload, such as timeout or
+	// rejected by the downstream, the limit backs off.
+	OutcomeDropped
+	// OutcomeIgnore the request failed for other reasons, such as a bad
+	// argument, it is not sampled.
+	OutcomeIgnore
+)
+
+// Sample the observation of a request released.
+type Sample struct {
+	// the latency of request.
+	RTT time.Duration
+	// the requests in flight when the request started, including itself.
+	Inflight int
+	// whether the request is dropped.
+	Dropped bool
+}
+
+// LimitAlgorithm compute the concurrency limit from the samples, it is
+// called under the lock of limiter, so that it need not be safe for
+// concurrent use.
+type LimitAlgorithm interface {
+	// Update return the new limit from the current limit and the sample.
+	Update(limit float64, s Sample) float64
+}
+
+// AIMD the additive increase multiplicative decrease algorithm, the limit
+// increases by one on every success, and backs off by ratio on the drop or
+// the latency exceeds timeout.
+type AIMD struct {
+	// the ratio of limit to keep on drop, in (0, 1).
+	Backoff float64
+	// the latency regarded as drop, zero means never.
+	Timeout time.Duration
+}
+
+// NewAIMD return the AIMD backs off to 0.9 of limit on drop.
+func NewAIMD() *AIMD {
+	return &AIMD{Backoff: 0.9}
+}
+
+func (a *AIMD) Update(limit float64, s Sample) float64 {
+	if s.Dropped || (a.Timeout > 0 && s.RTT > a.Timeout) {
+		return limit * a.Backoff
+	}
+
+	// the limit is not the bottleneck while the requests are few.
+	if float64(s.Inflight)*2 < limit {
+		return limit
+	}
+
+	return limit + 1
+}
+
+// Vegas the algorithm similar to TCP Vegas, the queue size is estimated by
+// the limit and the ratio of the no load latency to the latency sampled,
+// the limit increases while the queue is short, and decreases while the
+// queue is long.
+type Vegas struct {
+	// the queue size under alpha*log10(limit) increases the limit.
+	Alpha float64
+	// the queue size over beta*log10(limit) decreases the limit.
+	Beta float64
+	// the weight of the new limit, in (0, 1].
+	Smoothing float64
+	// the samples to probe the no load latency again, since the min latency
+	// may change over time. Zero means never.
+	Probe int
+
+	noLoad  time.Duration
+	samples int
+}
+
+// NewVegas return the Vegas with alpha 3, beta 6, and probes the no load
+// latency every 1000 samples.
+func NewVegas() *Vegas {
+	return &Vegas{Alpha: 3, Beta: 6, Smoothing: 1, Probe: 1000}
+}
+
+func (v *Vegas) Update(limit float64, s Sample) float64 {
+	if v.samples++; v.noLoad == 0 || s.RTT < v.noLoad || (v.Probe > 0 && v.samples >= v.Probe) {
+		v.noLoad = s.RTT
+		v.samples = 0
+		return limit
+	}
+
+	step := max(1, math.Log10(limit))
+	var next float64
+	switch queue := math.Ceil(limit * (1 - float64(v.noLoad)/float64(s.RTT))); {
+	case s.Dropped:
+		next = limit - step
+	case float64(s.Inflight)*2 < limit:
+		return limit
+	case queue <= step:
+		next = limit + v.Beta*step
+	case queue < v.Alpha*step:
+		next = limit + step
+	case queue > v.Beta*step:
+		next = limit - step
+	default:
+		return limit
+	}
+
+	return limit*(1-v.Smoothing) + next*v.Smoothing
+}
+
+// Gradient2 the algorithm adjusts the limit by the gradient of the long
+// term average latency to the latency sampled, the limit decreases as the
+// latency grows over the tolerance, and increases by the queue size
+// otherwise. The long term latency follows the sampled one slowly, so
+// that the limit may creep up under the steady overload, bound it by
+// WithLimitBounds.
+type Gradient2 struct {
+	// the ratio of latency growth tolerated before decreasing, >= 1.
+	Tolerance float64
+	// the samples averaged of the long term latency.
+	Window int
+	// the weight of the new limit, in (0, 1].
+	Smoothing float64
+	// the queue size allowed, zero means sqrt(limit).
+	QueueSize float64
+
+	long float64
+}
+
+// NewGradient2 return the Gradient2 tolerates 1.5 times of the long term
+// latency averaged over 600 samples.
+func NewGradient2() *Gradient2 {
+	return &Gradient2{Tolerance: 1.5, Window: 600, Smoothing: 0.2}
+}
+
+func (g *Gradient2) Update(limit float64, s Sample) float64 {
+	short := float64(s.RTT)
+	if g.long == 0 {
+		g.long = short
+	} else {
+		g.long += (short - g.long) * 2 / float64(g.Window+1)
+	}
+	// the long term latency recovers quickly from the overload.
+	if g.long/short > 2 {
+		g.long *= 0.95
+	}
+
+	if !s.Dropped && float64(s.Inflight)*2 < limit {
+		return limit
+	}
+
+	gradient := 0.5
+	if !s.Dropped {
+		gradient = max(0.5, min(1, g.Tolerance*g.long/short))
+	}
+	queue := g.QueueSize
+	if queue == 0 {
+		queue = math.Sqrt(limit)
+	}
+
+	return limit*(1-g.Smoothing) + (limit*gradient+queue)*g.Smoothing
+}
+
+// AdaptiveOption the optional config of AdaptiveLimiter.
+type AdaptiveOption func(*AdaptiveLimiter)
+
+// WithLimitBounds bound the concurrency limit in [minLimit, maxLimit].
+func WithLimitBounds(minLimit, maxLimit int) AdaptiveOption {
+	return func(a *AdaptiveLimiter) {
+		if minLimit > 0 && minLimit <= maxLimit {
+			a.minLimit, a.maxLimit = float64(minLimit), float64(maxLimit)
+		}
+	}
+}
+
+// WithInitialLimit set the concurrency limit at start, the default is 20.
+func WithInitialLimit(n int) AdaptiveOption {
+	return func(a *AdaptiveLimiter) {
+		if n > 0 {
+			a.limit = float64(n)
+		}
+	}
+}
+
+// WithSampleWindow aggregate the samples until both d elapsed and n
+// samples collected, and update the limit once by the average latency,
+// the max requests in flight, and whether any is dropped. The default is
+// updating on every sample.
+func WithSampleWindow(d time.Duration, n int) AdaptiveOption {
+	return func(a *AdaptiveLimiter) {
+		a.window, a.windowSamples = d, n
+	}
+}
+
+// WithAdaptiveClock set the source of time to measure the latency.
+func WithAdaptiveClock(c clock.Clock) AdaptiveOption {
+	return func(a *AdaptiveLimiter) {
+		if c != nil {
+			a.clock = c
+		}
+	}
+}
+
+// AdaptiveStats the snapshot of AdaptiveLimiter.
+type AdaptiveStats struct {
+	Limit    int
+	Inflight int
+	Accepted int64
+	Rejected int64
+	Dropped  int64
+	// the min and the last latency sampled.
+	MinRTT  time.Duration
+	LastRTT time.Duration
+}
+
+// AdaptiveLimiter the concurrency limiter tunes the limit by itself, every
+// request acquired reports its latency and outcome through the release
+// callback, and the limit is updated by LimitAlgorithm within the bounds.
+type AdaptiveLimiter struct {
+	algo     LimitAlgorithm
+	limit    float64
+	minLimit float64
+	maxLimit float64
+	inflight int
+	stats    AdaptiveStats
+	// the samples aggregated since windowStart.
+	window        time.Duration
+	windowSamples int
+	windowStart   time.Time
+	agg           Sample
+	aggRTT        time.Duration
+	aggN          int
+	closed        bool
+	clock         clock.Clock
+	mu            *sync.Mutex
+}
+
+// NewAdaptiveLimiter create the adaptive concurrency limiter by algo, the
+// limit is bounded in [1, 1000] by default.
+func NewAdaptiveLimiter(algo LimitAlgorithm, opts ...AdaptiveOption) *AdaptiveLimiter {
+	a := &AdaptiveLimiter{
+		algo:     algo,
+		limit:    20,
+		minLimit: 1,
+		maxLimit: 1000,
+		clock:    clock.Real(),
+		mu:       new(sync.Mutex),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.limit = min(a.maxLimit, max(a.minLimit, a.limit))
+	a.windowStart = a.clock.Now()
+
+	return a
+}
+
+// Acquire take a slot of concurrency, the request is rejected if the
+// requests in flight reach the limit. The caller must call release once
+// with the outcome when the request is done.
+func (a *AdaptiveLimiter) Acquire(ctx context.Context) (release func(Outcome), err error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return nil, errorx.ErrClosed
+	}
+
+	if a.inflight >= int(a.limit) {
+		a.stats.Rejected++
+		return nil, errorx.ErrOverMaxLimit
+	}
+	a.inflight++
+	a.stats.Accepted++
+
+	inflight, startTime := a.inflight, a.clock.Now()
+	var once sync.Once
+	return func(o Outcome) {
+		once.Do(func() {
+			a.release(o, Sample{
+				RTT:      a.clock.Since(startTime),
+				Inflight: inflight,
+				Dropped:  o == OutcomeDropped,
+			})
+		})
+	}, nil
+}
+
+func (a *AdaptiveLimiter) release(o Outcome, s Sample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.inflight--
+	if o == OutcomeIgnore {
+		return
+	}
+
+	if s.Dropped {
+		a.stats.Dropped++
+	}
+	if a.stats.MinRTT == 0 || s.RTT < a.stats.MinRTT {
+		a.stats.MinRTT = s.RTT
+	}
+	a.stats.LastRTT = s.RTT
+
+	// aggregate the sample into the window.
+	a.aggN++
+	a.aggRTT += s.RTT
+	a.agg.Inflight = max(a.agg.Inflight, s.Inflight)
+	a.agg.Dropped = a.agg.Dropped || s.Dropped
+	now := a.clock.Now()
+	if a.aggN < a.windowSamples || now.Sub(a.windowStart) < a.window {
+		return
+	}
+
+	a.agg.RTT = a.aggRTT / time.Duration(a.aggN)
+	a.limit = min(a.maxLimit, max(a.minLimit, a.algo.Update(a.limit, a.agg)))
+	a.agg, a.aggRTT, a.aggN, a.windowStart = Sample{}, 0, 0, now
+}
+
+// Limit return the current concurrency limit.
+func (a *AdaptiveLimiter) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return int(a.limit)
+}
+
+// Stats return the snapshot of limiter.
+func (a *AdaptiveLimiter) Stats() AdaptiveStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s := a.stats
+	s.Limit = int(a.limit)
+	s.Inflight = a.inflight
+
+	return s
+}
+
+// Close close the limiter, the requests in flight can still be released.
+func (a *AdaptiveLimiter) Close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.closed = true
+}
@@ -0,0 +1,218 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveLimiter_Acquire(t *testing.T) {
+	c := clock.NewFake(start)
+	a := NewAdaptiveLimiter(NewAIMD(), WithInitialLimit(2), WithLimitBounds(1, 3), WithAdaptiveClock(c))
+
+	r1, err := a.Acquire(context.Background())
+	assert.NoError(t, err)
+	r2, err := a.Acquire(context.Background())
+	assert.NoError(t, err)
+	_, err = a.Acquire(context.Background())
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+
+	// the limit increases on success under load, and never exceeds bound.
+	c.Advance(10 * time.Millisecond)
+	r1(OutcomeSuccess)
+	r1(OutcomeSuccess)
+	assert.Equal(t, 3, a.Limit())
+	r2(OutcomeSuccess)
+	assert.Equal(t, 3, a.Limit())
+
+	// the limit backs off on drop, and never under bound.
+	for i := 0; i < 20; i++ {
+		release, err := a.Acquire(context.Background())
+		assert.NoError(t, err)
+		release(OutcomeDropped)
+	}
+	assert.Equal(t, 1, a.Limit())
+
+	release, err := a.Acquire(context.Background())
+	assert.NoError(t, err)
+	release(OutcomeIgnore)
+	assert.Equal(t, AdaptiveStats{
+		Limit:    1,
+		Accepted: 23,
+		Rejected: 1,
+		Dropped:  20,
+	}, a.Stats())
+
+	a.Close()
+	_, err = a.Acquire(context.Background())
+	assert.Equal(t, errorx.ErrClosed, err)
+}
+
+func TestAIMD_Update(t *testing.T) {
+	testCases := []struct {
+		name   string
+		sample Sample
+		want   float64
+	}{
+		{name: "increase", sample: Sample{RTT: time.Millisecond, Inflight: 10}, want: 11},
+		{name: "app limited", sample: Sample{RTT: time.Millisecond, Inflight: 4}, want: 10},
+		{name: "drop", sample: Sample{RTT: time.Millisecond, Inflight: 10, Dropped: true}, want: 9},
+		{name: "timeout", sample: Sample{RTT: time.Second, Inflight: 10}, want: 9},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &AIMD{Backoff: 0.9, Timeout: 100 * time.Millisecond}
+			assert.InDelta(t, tc.want, a.Update(10, tc.sample), 1e-9)
+		})
+	}
+}
+
+// TestAdaptiveLimiter_Converge drive the limiter against the server serves
+// 50 requests concurrently at 10ms, the latency grows with the requests in
+// flight over the capacity, the limit converges around the capacity.
+func TestAdaptiveLimiter_Converge(t *testing.T) {
+	const capacity = 50
+	testCases := []struct {
+		name string
+		algo LimitAlgorithm
+	}{
+		{name: "aimd", algo: &AIMD{Backoff: 0.9, Timeout: 12 * time.Millisecond}},
+		{name: "vegas", algo: NewVegas()},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := clock.NewFake(start)
+			a := NewAdaptiveLimiter(tc.algo, WithInitialLimit(10),
+				WithSampleWindow(20*time.Millisecond, 10), WithAdaptiveClock(c))
+
+			type pending struct {
+				end     time.Time
+				release func(Outcome)
+			}
+			var (
+				queue  []pending
+				limits []int
+			)
+			for step := 0; step < 3000; step++ {
+				c.Advance(time.Millisecond)
+				now := c.Now()
+				left := queue[:0]
+				for _, p := range queue {
+					if now.Before(p.end) {
+						left = append(left, p)
+						continue
+					}
+					p.release(OutcomeSuccess)
+				}
+				queue = left
+
+				// the clients always have more requests than the limit.
+				for {
+					release, err := a.Acquire(context.Background())
+					if err != nil {
+						break
+					}
+					rtt := 10 * time.Millisecond
+					if n := len(queue) + 1; n > capacity {
+						rtt = rtt * time.Duration(n) / capacity
+					}
+					queue = append(queue, pending{end: now.Add(rtt), release: release})
+				}
+				limits = append(limits, a.Limit())
+			}
+
+			for _, l := range limits[len(limits)-500:] {
+				assert.InDelta(t, capacity, l, capacity*0.5)
+			}
+		})
+	}
+}
+
+func TestGradient2_Update(t *testing.T) {
+	g := NewGradient2()
+	limit := 100.0
+
+	// the limit grows by the queue size while the latency is steady.
+	for i := 0; i < 10; i++ {
+		limit = g.Update(limit, Sample{RTT: 10 * time.Millisecond, Inflight: 100})
+	}
+	assert.InDelta(t, 120, limit, 1)
+
+	// the limit shrinks as the latency grows over the tolerance.
+	prev := limit
+	limit = g.Update(limit, Sample{RTT: 30 * time.Millisecond, Inflight: 120})
+	assert.Less(t, limit, prev)
+
+	// the limit halves at most by the gradient on drop.
+	prev = limit
+	limit = g.Update(limit, Sample{RTT: 10 * time.Millisecond, Inflight: 120, Dropped: true})
+	assert.InDelta(t, prev*0.9+math.Sqrt(prev)*0.2, limit, 1e-9)
+
+	// the limit is kept while the requests are few.
+	assert.Equal(t, limit, g.Update(limit, Sample{RTT: time.Second, Inflight: 1}))
+}
+
+func TestVegas_Update(t *testing.T) {
+	v := NewVegas()
+
+	// the first sample probes the no load latency.
+	assert.Equal(t, 100.0, v.Update(100, Sample{RTT: 10 * time.Millisecond, Inflight: 100}))
+	// no queue, the limit increases fast.
+	assert.Equal(t, 112.0, v.Update(100, Sample{RTT: 10 * time.Millisecond, Inflight: 100}))
+	// the queue is long, the limit decreases.
+	assert.Equal(t, 98.0, v.Update(100, Sample{RTT: 20 * time.Millisecond, Inflight: 100}))
+	assert.Equal(t, 98.0, v.Update(100, Sample{RTT: 10 * time.Millisecond, Inflight: 100, Dropped: true}))
+}
+
+func TestAdaptiveLimiter_Concurrent(t *testing.T) {
+	a := NewAdaptiveLimiter(NewGradient2(), WithLimitBounds(5, 100))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				release, err := a.Acquire(context.Background())
+				if err != nil {
+					continue
+				}
+				if j%10 == 0 {
+					release(OutcomeDropped)
+					continue
+				}
+				release(OutcomeSuccess)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := a.Stats()
+	assert.Zero(t, s.Inflight)
+	assert.Equal(t, int64(16*500), s.Accepted+s.Rejected)
+	assert.GreaterOrEqual(t, s.Limit, 5)
+	assert.LessOrEqual(t, s.Limit, 100)
+}
@@ -0,0 +1,293 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+	"github.com/TimeWtr/gox/proc"
+)
+
+const (
+	// the weight of the cpu usage sampled before.
+	cpuDecay = 0.8
+	// the default ratio of cpu usage to shed the requests.
+	defaultCPUThreshold = 0.8
+)
+
+// CPUSampler sample the cpu usage in [0, 1], proc.CPUUsage implements it.
+type CPUSampler interface {
+	Sample() (float64, error)
+}
+
+// BBROption the optional config of BBR.
+type BBROption func(*BBR)
+
+// WithCPUThreshold set the cpu usage in (0, 1] over which the requests
+// are shed, the default is 0.8.
+func WithCPUThreshold(threshold float64) BBROption {
+	return func(b *BBR) {
+		if threshold > 0 && threshold <= 1 {
+			b.threshold = threshold
+		}
+	}
+}
+
+// WithCPUSampler set the source of cpu usage sampled every interval, the
+// default is the system cpu from /proc/stat every 250ms.
+func WithCPUSampler(s CPUSampler, interval time.Duration) BBROption {
+	return func(b *BBR) {
+		if s != nil && interval > 0 {
+			b.sampler, b.sampleInterval = s, interval
+		}
+	}
+}
+
+// WithBBRWindow set the rolling window of the pass count and the min
+// latency split into buckets, the default is 1s of 10 buckets.
+func WithBBRWindow(window time.Duration, buckets int) BBROption {
+	return func(b *BBR) {
+		if window > 0 && buckets > 0 {
+			b.window, b.buckets = window, make([]bbrBucket, buckets)
+		}
+	}
+}
+
+// WithBBRClock set the source of time.
+func WithBBRClock(c clock.Clock) BBROption {
+	return func(b *BBR) {
+		if c != nil {
+			b.clock = c
+		}
+	}
+}
+
+// BBRStats the snapshot of BBR.
+type BBRStats struct {
+	// the cpu usage smoothed.
+	CPU      float64
+	Inflight int64
+	// the max requests passed in a bucket of window.
+	MaxPass int64
+	// the min latency of window.
+	MinRT time.Duration
+	// the max requests in flight estimated, MaxPass * MinRT / bucket.
+	MaxInflight int64
+	Passed      int64
+	Dropped     int64
+}
+
+// BBR the adaptive load shedding limiter similar to TCP BBR, it tracks the
+// requests in flight, the min latency and the max pass rate over the
+// rolling window, and drops the request while the cpu usage exceeds the
+// threshold and the requests in flight exceed maxPass * minRT, which is
+// the capacity estimated by Little's law. The dropping lasts for a window
+// after the cpu usage falls, to avoid the jitter.
+//
+// The requests are taken by Acquire and tracked in flight until done, BBR
+// is not a limiter.Limiter, as Allow can not report the request is done.
+type BBR struct {
+	threshold float64
+	sampler   CPUSampler
+	// the interval to sample the cpu usage.
+	sampleInterval time.Duration
+	// the time of the last sample in nanoseconds, zero means never.
+	lastSample atomic.Int64
+	// the bits of the cpu usage smoothed.
+	cpu      atomic.Uint64
+	inflight atomic.Int64
+	window   time.Duration
+	// the ring of buckets of window.
+	buckets []bbrBucket
+	// the time of the last drop.
+	dropTime time.Time
+	passed   int64
+	dropped  int64
+	closed   atomic.Bool
+	clock    clock.Clock
+	mu       *sync.Mutex
+}
+
+// bbrBucket the requests passed in a bucket of window.
+type bbrBucket struct {
+	epoch int64
+	pass  int64
+	minRT time.Duration
+}
+
+// NewBBR create the BBR limiter, the cpu usage is sampled lazily on
+// Acquire, there is no background goroutine.
+func NewBBR(opts ...BBROption) *BBR {
+	b := &BBR{
+		threshold:      defaultCPUThreshold,
+		sampler:        proc.NewSystemCPUUsage(proc.DefaultFS()),
+		sampleInterval: 250 * time.Millisecond,
+		window:         time.Second,
+		buckets:        make([]bbrBucket, 10),
+		clock:          clock.Real(),
+		mu:             new(sync.Mutex),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// bucketSize return the duration of a bucket.
+func (b *BBR) bucketSize() int64 {
+	return max(1, b.window.Nanoseconds()/int64(len(b.buckets)))
+}
+
+// CPU return the cpu usage smoothed, it samples the cpu if the interval
+// has elapsed since the last sample. The failed sample is ignored.
+func (b *BBR) CPU() float64 {
+	now := b.clock.Now().UnixNano()
+	last := b.lastSample.Load()
+	if (last == 0 || now-last >= b.sampleInterval.Nanoseconds()) && b.lastSample.CompareAndSwap(last, now) {
+		if usage, err := b.sampler.Sample(); err == nil {
+			if last != 0 {
+				usage = math.Float64frombits(b.cpu.Load())*cpuDecay + usage*(1-cpuDecay)
+			}
+			b.cpu.Store(math.Float64bits(usage))
+		}
+	}
+
+	return math.Float64frombits(b.cpu.Load())
+}
+
+// Acquire allow the request and track it in flight, the caller must call
+// done once when the request is done, the latency is measured from now to
+// the callback.
+func (b *BBR) Acquire(ctx context.Context) (done func(), err error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	if b.closed.Load() {
+		return nil, errorx.ErrClosed
+	}
+
+	if b.shouldDrop(b.CPU()) {
+		return nil, errorx.ErrOverMaxLimit
+	}
+
+	startTime := b.clock.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.done(b.clock.Since(startTime))
+		})
+	}, nil
+}
+
+// done report the request acquired is done with the latency rt.
+func (b *BBR) done(rt time.Duration) {
+	b.inflight.Add(-1)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	epoch := b.clock.Now().UnixNano() / b.bucketSize()
+	bucket := &b.buckets[epoch%int64(len(b.buckets))]
+	if bucket.epoch != epoch {
+		*bucket = bbrBucket{epoch: epoch}
+	}
+	bucket.pass++
+	if bucket.minRT == 0 || rt < bucket.minRT {
+		bucket.minRT = rt
+	}
+}
+
+// shouldDrop decide whether to drop the request, the request not dropped
+// is counted in flight.
+func (b *BBR) shouldDrop(cpu float64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	inflight := b.inflight.Load()
+	overload := inflight > 0 && inflight >= b.maxInflight(now)
+	switch {
+	case cpu >= b.threshold && overload:
+		b.dropTime = now
+	// keep dropping for a window after the cpu falls.
+	case !b.dropTime.IsZero() && now.Sub(b.dropTime) <= b.window && overload:
+	default:
+		b.passed++
+		b.inflight.Add(1)
+		return false
+	}
+
+	b.dropped++
+	return true
+}
+
+// stat return the max requests passed in a bucket and the min latency
+// of the completed buckets in window.
+func (b *BBR) stat(now time.Time) (maxPass int64, minRT time.Duration) {
+	epoch := now.UnixNano() / b.bucketSize()
+	for _, bucket := range b.buckets {
+		if bucket.epoch >= epoch || epoch-bucket.epoch >= int64(len(b.buckets)) || bucket.pass == 0 {
+			continue
+		}
+		maxPass = max(maxPass, bucket.pass)
+		if minRT == 0 || bucket.minRT < minRT {
+			minRT = bucket.minRT
+		}
+	}
+
+	return max(1, maxPass), max(time.Millisecond, minRT)
+}
+
+// maxInflight return the requests in flight the system can hold by
+// Little's law, maxPass per bucket * minRT.
+func (b *BBR) maxInflight(now time.Time) int64 {
+	maxPass, minRT := b.stat(now)
+	return int64(math.Ceil(float64(maxPass) * float64(minRT) / float64(b.bucketSize())))
+}
+
+// Stats return the snapshot of limiter.
+func (b *BBR) Stats() BBRStats {
+	cpu := b.CPU()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	maxPass, minRT := b.stat(now)
+	return BBRStats{
+		CPU:         cpu,
+		Inflight:    b.inflight.Load(),
+		MaxPass:     maxPass,
+		MinRT:       minRT,
+		MaxInflight: b.maxInflight(now),
+		Passed:      b.passed,
+		Dropped:     b.dropped,
+	}
+}
+
+func (b *BBR) Close() {
+	b.closed.Store(true)
+}
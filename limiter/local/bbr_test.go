@@ -0,0 +1,134 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+	"github.com/TimeWtr/gox/proc"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cpuStub the cpu usage set by tests.
+type cpuStub struct {
+	usage atomic.Uint64
+}
+
+func (c *cpuStub) set(usage float64) {
+	c.usage.Store(math.Float64bits(usage))
+}
+
+func (c *cpuStub) Sample() (float64, error) {
+	return math.Float64frombits(c.usage.Load()), nil
+}
+
+func TestBBR_Acquire(t *testing.T) {
+	c := clock.NewFake(start)
+	cpu := &cpuStub{}
+	b := NewBBR(WithCPUSampler(cpu, 10*time.Millisecond), WithBBRClock(c))
+	defer b.Close()
+
+	// 10 requests pass every 100ms bucket at 50ms, the cpu is low, nothing
+	// is dropped.
+	var dones []func()
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			done, err := b.Acquire(context.Background())
+			assert.NoError(t, err)
+			dones = append(dones, done)
+		}
+		c.Advance(50 * time.Millisecond)
+		for _, done := range dones {
+			done()
+		}
+		dones = dones[:0]
+		c.Advance(50 * time.Millisecond)
+	}
+
+	// the cpu is high, the requests over maxPass * minRT are dropped.
+	cpu.set(0.95)
+	for i := 0; i < 100 && b.CPU() < 0.8; i++ {
+		c.Advance(10 * time.Millisecond)
+	}
+	for i := 0; i < 6; i++ {
+		done, err := b.Acquire(context.Background())
+		assert.Equal(t, i >= 5, err != nil, "request %d", i)
+		if err != nil {
+			assert.Equal(t, errorx.ErrOverMaxLimit, err)
+			continue
+		}
+		dones = append(dones, done)
+	}
+	stats := b.Stats()
+	assert.Equal(t, int64(5), stats.MaxInflight)
+	assert.Equal(t, int64(5), stats.Inflight)
+	assert.Equal(t, int64(1), stats.Dropped)
+
+	// the dropping lasts for a window after the cpu falls.
+	cpu.set(0.1)
+	c.Advance(10 * time.Millisecond)
+	assert.Less(t, b.CPU(), 0.8)
+	_, err := b.Acquire(context.Background())
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+
+	c.Advance(time.Second)
+	done, err := b.Acquire(context.Background())
+	assert.NoError(t, err)
+	done()
+
+	b.Close()
+	_, err = b.Acquire(context.Background())
+	assert.Equal(t, errorx.ErrClosed, err)
+}
+
+func TestBBR_ProcCPU(t *testing.T) {
+	b := NewBBR(WithCPUSampler(proc.NewSystemCPUUsage(proc.NewFS("../../proc/testdata/proc")), time.Millisecond))
+	assert.InDelta(t, 1-3722.0/9384, b.CPU(), 1e-9)
+}
+
+func TestBBR_Concurrent(t *testing.T) {
+	cpu := &cpuStub{}
+	cpu.set(0.9)
+	b := NewBBR(WithCPUSampler(cpu, time.Millisecond), WithBBRWindow(100*time.Millisecond, 10))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				done, err := b.Acquire(context.Background())
+				if err != nil {
+					continue
+				}
+				time.Sleep(10 * time.Microsecond)
+				done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := b.Stats()
+	assert.Zero(t, stats.Inflight)
+	assert.Equal(t, int64(16*200), stats.Passed+stats.Dropped)
+}
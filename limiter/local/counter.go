@@ -0,0 +1,196 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+	"github.com/TimeWtr/gox/limiter"
+)
+
+const (
+	// the low bits of slot hold the count, the high bits hold the epoch.
+	countBits = 24
+	maxCount  = 1<<countBits - 1
+	// the epoch packed keeps the low bits only, it wraps around.
+	epochBits = 64 - countBits
+	epochMask = 1<<epochBits - 1
+	// the default sub windows of the sliding window counter.
+	defaultWindowBuckets = 10
+)
+
+var _ limiter.Limiter = (*SlidingWindowCounter)(nil)
+
+// SlidingWindowCounter the sliding window counter limiter, the window is
+// split into sub windows counted in a ring, and the sub window sliding out
+// partially is weighted by the overlap with the window. The memory is
+// constant no matter the rate, and the counters are updated lock-free.
+type SlidingWindowCounter struct {
+	// the nanoseconds of sub window.
+	sub int64
+	// the ring of sub windows, one more than the buckets of window to hold
+	// the sub window sliding out, every slot packs the epoch and count.
+	slots []atomic.Uint64
+	// the request count of this window allowed.
+	rate int64
+	// the requests reserved for high priority requests.
+	reserved int64
+	// the time of epoch 0.
+	startTime int64
+	// the source of time
+	clock clock.Clock
+}
+
+// NewSlidingWindowCounter create the sliding window counter allowing rate
+// requests per interval, the window is split into 10 sub windows by default,
+// and can be changed by WithWindowBuckets. The count of every sub window is
+// packed with the epoch, it returns ErrInvalidRate if the rate is not in
+// [1, 1<<24-1].
+func NewSlidingWindowCounter(interval time.Duration, rate int, opts ...Option) (limiter.Limiter, error) {
+	if rate < 1 || rate > maxCount {
+		return nil, errorx.ErrInvalidRate
+	}
+
+	o := newOptions(opts)
+	buckets := o.buckets
+	if buckets == 0 {
+		buckets = defaultWindowBuckets
+	}
+
+	return &SlidingWindowCounter{
+		sub:       max(1, interval.Nanoseconds()/int64(buckets)),
+		slots:     make([]atomic.Uint64, buckets+1),
+		rate:      int64(rate),
+		reserved:  o.reserved(int64(rate)),
+		startTime: o.clock.Now().UnixNano(),
+		clock:     o.clock,
+	}, nil
+}
+
+func pack(epoch int64, count int64) uint64 {
+	return uint64(epoch)<<countBits | uint64(count)
+}
+
+func unpack(v uint64) (epoch int64, count int64) {
+	return int64(v >> countBits), int64(v & maxCount)
+}
+
+// since return the epochs elapsed from the packed epoch e to epoch, it is
+// negative if e is ahead of epoch by ahead epochs at most. The packed epoch
+// is compared modulo 1<<40, so that the small interval works after the
+// epoch exceeds 40 bits.
+func since(e, epoch, ahead int64) int64 {
+	d := (epoch - e) & epochMask
+	if d != 0 && epochMask+1-d <= ahead {
+		return d - (epochMask + 1)
+	}
+
+	return d
+}
+
+func (l *SlidingWindowCounter) Allow(ctx context.Context) (bool, error) {
+	return l.AllowN(ctx, 1)
+}
+
+// AllowN count n requests at once, the cost exceeds the rate of window is
+// never allowed. The requests are counted before checking the window, and
+// rolled back if the window is over limit, so that the concurrent requests
+// never over admit.
+func (l *SlidingWindowCounter) AllowN(ctx context.Context, n int) (bool, error) {
+	rate := limit(ctx, l.rate, l.reserved)
+	if ok, err := limiter.CheckCost(n, rate); ok || err != nil {
+		return ok, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+	}
+
+	now := max(0, l.clock.Now().UnixNano()-l.startTime)
+	epoch := now / l.sub
+	if !l.add(epoch, int64(n)) {
+		return false, errorx.ErrOverMaxLimit
+	}
+
+	if l.count(epoch, now) > float64(rate) {
+		l.add(epoch, -int64(n))
+		return false, errorx.ErrOverMaxLimit
+	}
+
+	return true, nil
+}
+
+// add add delta to the count of sub window epoch, the slot of expired
+// epoch is reset. It returns false if the slot overflows or has been
+// taken by a later epoch.
+func (l *SlidingWindowCounter) add(epoch, delta int64) bool {
+	slot := &l.slots[epoch%int64(len(l.slots))]
+	for {
+		old := slot.Load()
+		e, c := unpack(old)
+		switch d := since(e, epoch, int64(len(l.slots))); {
+		case d == 0:
+			c += delta
+		case d < 0 || delta < 0:
+			// the sub window has slid out, nothing to roll back.
+			return delta < 0
+		default:
+			c = delta
+		}
+		if c > maxCount {
+			return false
+		}
+
+		if slot.CompareAndSwap(old, pack(epoch, max(0, c))) {
+			return true
+		}
+	}
+}
+
+// count return the requests in the window ended at now, the sub windows
+// in the window are counted fully, and the one sliding out is weighted by
+// the ratio still in the window.
+func (l *SlidingWindowCounter) count(epoch, now int64) float64 {
+	buckets := int64(len(l.slots)) - 1
+	var total float64
+	for k := int64(0); k < buckets && k <= epoch; k++ {
+		total += float64(l.get(epoch - k))
+	}
+
+	if epoch >= buckets {
+		elapsed := float64(now-epoch*l.sub) / float64(l.sub)
+		total += float64(l.get(epoch-buckets)) * (1 - elapsed)
+	}
+
+	return total
+}
+
+// get return the count of sub window epoch.
+func (l *SlidingWindowCounter) get(epoch int64) int64 {
+	e, c := unpack(l.slots[epoch%int64(len(l.slots))].Load())
+	if since(e, epoch, 0) != 0 {
+		return 0
+	}
+
+	return c
+}
+
+func (l *SlidingWindowCounter) Close() {}
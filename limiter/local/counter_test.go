@@ -0,0 +1,242 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+	"github.com/TimeWtr/gox/limiter"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindowCounter_Allow(t *testing.T) {
+	c := clock.NewFake(start)
+	l, err := NewSlidingWindowCounter(time.Second, 10, WithClock(c))
+	assert.NoError(t, err)
+	defer l.Close()
+
+	for i := 0; i < 12; i++ {
+		ok, err := l.Allow(context.Background())
+		assert.Equal(t, i < 10, ok, "request %d", i)
+		assert.Equal(t, i >= 10, err != nil, "request %d", i)
+	}
+
+	// the sub windows in the window are counted fully.
+	c.Advance(900 * time.Millisecond)
+	ok, _ := l.Allow(context.Background())
+	assert.False(t, ok)
+
+	// the first sub window slides out by half, half of the requests in it
+	// are still counted.
+	c.Advance(150 * time.Millisecond)
+	for i := 0; i < 6; i++ {
+		ok, err := l.Allow(context.Background())
+		assert.Equal(t, i < 5, ok, "request %d", i)
+		assert.Equal(t, i >= 5, err != nil, "request %d", i)
+	}
+
+	// the window is empty after a long time.
+	c.Advance(time.Hour)
+	ok, err = l.AllowN(context.Background(), 10)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+
+	_, err = l.AllowN(context.Background(), 11)
+	assert.Equal(t, errorx.ErrExceedCapacity, err)
+}
+
+func TestNewSlidingWindowCounter_InvalidRate(t *testing.T) {
+	for _, rate := range []int{0, -1, maxCount + 1} {
+		l, err := NewSlidingWindowCounter(time.Second, rate)
+		assert.Nil(t, l)
+		assert.Equal(t, errorx.ErrInvalidRate, err)
+	}
+}
+
+func TestSlidingWindowCounter_Allow_EpochWrap(t *testing.T) {
+	c := clock.NewFake(start)
+	// the sub window is 1ns, the epoch exceeds the 40 bits packed.
+	l, err := NewSlidingWindowCounter(10*time.Nanosecond, 10, WithClock(c))
+	assert.NoError(t, err)
+	c.Advance(1<<40 + 5)
+
+	ok, err := l.AllowN(context.Background(), 10)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	ok, err = l.Allow(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+
+	c.Advance(20 * time.Nanosecond)
+	ok, err = l.Allow(context.Background())
+	assert.True(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestSlidingWindowCounter_HighPriorityReserve(t *testing.T) {
+	l, err := NewSlidingWindowCounter(time.Minute, 10, WithHighPriorityReserve(0.2))
+	assert.NoError(t, err)
+	low := context.Background()
+	high := limiter.WithPriority(context.Background(), limiter.PriorityHigh)
+
+	ok, _ := l.AllowN(low, 8)
+	assert.True(t, ok)
+	ok, _ = l.Allow(low)
+	assert.False(t, ok)
+	ok, _ = l.AllowN(high, 2)
+	assert.True(t, ok)
+	ok, _ = l.Allow(high)
+	assert.False(t, ok)
+}
+
+// TestSlidingWindowCounter_Accuracy compare the counter with the exact
+// log of SlidingWindow on the same traffic.
+func TestSlidingWindowCounter_Accuracy(t *testing.T) {
+	testCases := []struct {
+		name string
+		// the interval to the next request.
+		next func(r *rand.Rand) time.Duration
+		// the max requests admitted in any exact sliding window.
+		wantPeak int
+	}{
+		{
+			name:     "uniform",
+			next:     func(*rand.Rand) time.Duration { return 5 * time.Millisecond },
+			wantPeak: 100,
+		},
+		{
+			name: "poisson",
+			next: func(r *rand.Rand) time.Duration {
+				return time.Duration(r.ExpFloat64() * float64(5*time.Millisecond))
+			},
+			wantPeak: 110,
+		},
+		{
+			name: "burst",
+			next: func(r *rand.Rand) time.Duration {
+				if r.Intn(50) == 0 {
+					return time.Duration(r.Intn(500)) * time.Millisecond
+				}
+				return 100 * time.Microsecond
+			},
+			wantPeak: 130,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := clock.NewFake(start)
+			exact := NewSlidingWindow(time.Second, 100, WithClock(c))
+			counter, err := NewSlidingWindowCounter(time.Second, 100, WithClock(c))
+			assert.NoError(t, err)
+
+			r := rand.New(rand.NewSource(1))
+			var exactN, counterN int
+			// the admitted times of counter.
+			var admitted []time.Time
+			for c.Now().Before(start.Add(time.Minute)) {
+				if ok, _ := exact.Allow(context.Background()); ok {
+					exactN++
+				}
+				if ok, _ := counter.Allow(context.Background()); ok {
+					counterN++
+					admitted = append(admitted, c.Now())
+				}
+				c.Advance(tc.next(r))
+			}
+
+			// the total admitted is close to the exact one.
+			assert.InDelta(t, exactN, counterN, float64(exactN)*0.05)
+
+			// the interpolation assumes the requests spread evenly in the
+			// sub window, the bursts may over admit slightly in the exact
+			// sliding window.
+			var peak int
+			for i, j := 0, 0; i < len(admitted); i++ {
+				for admitted[i].Sub(admitted[j]) >= time.Second {
+					j++
+				}
+				peak = max(peak, i-j+1)
+			}
+			assert.LessOrEqual(t, peak, tc.wantPeak)
+			t.Logf("exact: %d, counter: %d, peak: %d", exactN, counterN, peak)
+		})
+	}
+}
+
+func TestSlidingWindowCounter_Concurrent(t *testing.T) {
+	c := clock.NewFake(start)
+	l, err := NewSlidingWindowCounter(time.Second, 1000, WithClock(c))
+	assert.NoError(t, err)
+
+	var admitted atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				if ok, _ := l.Allow(context.Background()); ok {
+					admitted.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the clock is frozen, the concurrent requests never over admit.
+	assert.LessOrEqual(t, admitted.Load(), int64(1000))
+	assert.Greater(t, admitted.Load(), int64(0))
+}
+
+func TestSlidingWindowCounter_Allocs(t *testing.T) {
+	l, err := NewSlidingWindowCounter(time.Second, 1000)
+	assert.NoError(t, err)
+	allocs := testing.AllocsPerRun(1000, func() {
+		_, _ = l.Allow(context.Background())
+	})
+	assert.Zero(t, allocs)
+}
+
+func BenchmarkSlidingWindowCounter_Allow(b *testing.B) {
+	l, err := NewSlidingWindowCounter(time.Second, 1<<20)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = l.Allow(context.Background())
+		}
+	})
+}
+
+func BenchmarkSlidingWindow_Allow_Parallel(b *testing.B) {
+	l := NewSlidingWindow(time.Second, 1<<20)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = l.Allow(context.Background())
+		}
+	})
+}
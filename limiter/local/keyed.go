@@ -0,0 +1,277 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"hash/maphash"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+	"github.com/TimeWtr/gox/limiter"
+)
+
+const defaultShards = 16
+
+// Factory create the limiter of key, it is called lazily on the first
+// request of key.
+type Factory func(key string) limiter.Limiter
+
+// KeyedOption the optional config of KeyedLimiter.
+type KeyedOption func(*KeyedLimiter)
+
+// WithShards set the count of shards, the keys are spread over the shards
+// by hash to reduce lock contention, the default is 16.
+func WithShards(n int) KeyedOption {
+	return func(k *KeyedLimiter) {
+		if n > 0 {
+			k.shards = make([]*shard, n)
+		}
+	}
+}
+
+// WithIdleTTL evict the limiter of key not requested for ttl, zero means
+// never expired.
+func WithIdleTTL(ttl time.Duration) KeyedOption {
+	return func(k *KeyedLimiter) {
+		k.ttl = ttl
+	}
+}
+
+// WithMaxKeys bound the count of keys, the least recently used key is
+// evicted if exceeded, the bound is split evenly over the shards. Zero
+// means unbounded.
+func WithMaxKeys(n int) KeyedOption {
+	return func(k *KeyedLimiter) {
+		k.maxKeys = n
+	}
+}
+
+// WithKeyedClock set the source of time to expire the idle keys.
+func WithKeyedClock(c clock.Clock) KeyedOption {
+	return func(k *KeyedLimiter) {
+		if c != nil {
+			k.clock = c
+		}
+	}
+}
+
+var _ limiter.DisLimiter = (*KeyedLimiter)(nil)
+
+// KeyedLimiter the registry of the limiters by key, such as user or ip, the
+// limiter of key is created by Factory on the first request, and evicted
+// if idle for ttl or the least recently used while the keys are over
+// bound. It implements limiter.DisLimiter, so that the local and the
+// distributed limiters are interchangeable.
+type KeyedLimiter struct {
+	factory Factory
+	shards  []*shard
+	seed    maphash.Seed
+	ttl     time.Duration
+	maxKeys int
+	// the max keys of every shard.
+	shardKeys int
+	clock     clock.Clock
+	closed    atomic.Bool
+}
+
+// shard the part of keys, the limiters are kept in order of last used.
+type shard struct {
+	items map[string]*list.Element
+	// the front is the most recently used.
+	lru *list.List
+	mu  *sync.Mutex
+}
+
+type keyedEntry struct {
+	key  string
+	l    limiter.Limiter
+	last time.Time
+}
+
+func NewKeyedLimiter(factory Factory, opts ...KeyedOption) *KeyedLimiter {
+	k := &KeyedLimiter{
+		factory: factory,
+		shards:  make([]*shard, defaultShards),
+		seed:    maphash.MakeSeed(),
+		clock:   clock.Real(),
+	}
+
+	for _, opt := range opts {
+		opt(k)
+	}
+
+	for i := range k.shards {
+		k.shards[i] = &shard{
+			items: map[string]*list.Element{},
+			lru:   list.New(),
+			mu:    new(sync.Mutex),
+		}
+	}
+	if k.maxKeys > 0 {
+		k.shardKeys = max(1, (k.maxKeys+len(k.shards)-1)/len(k.shards))
+	}
+
+	return k
+}
+
+// Allow To determine whether to allow the request of key, the keys are
+// joined as one, such as tenant and user, the ":" in the keys is escaped.
+func (k *KeyedLimiter) Allow(ctx context.Context, key ...string) (bool, error) {
+	return k.AllowN(ctx, 1, key...)
+}
+
+func (k *KeyedLimiter) AllowN(ctx context.Context, n int, key ...string) (bool, error) {
+	name := joinKey(key)
+	if name == "" {
+		return false, errorx.ErrMissingKey
+	}
+
+	l, err := k.get(name)
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := l.AllowN(ctx, n)
+	// the limiter is evicted and closed by others meanwhile, retry once
+	// with the new one.
+	if errors.Is(err, errorx.ErrClosed) && !k.closed.Load() {
+		if l, err = k.get(name); err != nil {
+			return false, err
+		}
+		ok, err = l.AllowN(ctx, n)
+	}
+
+	return ok, err
+}
+
+// joinKey join the keys by ":", the ":" and `\` in the keys are escaped by
+// `\`, so that ["a:b", "c"] and ["a", "b:c"] are different.
+func joinKey(key []string) string {
+	if !slices.ContainsFunc(key, func(k string) bool { return strings.ContainsAny(k, `:\`) }) {
+		return strings.Join(key, ":")
+	}
+
+	var b strings.Builder
+	for i, k := range key {
+		if i > 0 {
+			b.WriteByte(':')
+		}
+		for j := 0; j < len(k); j++ {
+			if k[j] == ':' || k[j] == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(k[j])
+		}
+	}
+
+	return b.String()
+}
+
+// get return the limiter of key, it is created if not exists. The closed
+// is checked under the lock of shard, so that the limiter is never created
+// after the shard is drained by Close.
+func (k *KeyedLimiter) get(key string) (limiter.Limiter, error) {
+	s := k.shards[maphash.String(k.seed, key)%uint64(len(k.shards))]
+	now := k.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if k.closed.Load() {
+		return nil, errorx.ErrClosed
+	}
+
+	k.expire(s, now)
+	if elem, ok := s.items[key]; ok {
+		e := elem.Value.(*keyedEntry)
+		e.last = now
+		s.lru.MoveToFront(elem)
+		return e.l, nil
+	}
+
+	e := &keyedEntry{key: key, l: k.factory(key), last: now}
+	s.items[key] = s.lru.PushFront(e)
+	for k.shardKeys > 0 && s.lru.Len() > k.shardKeys {
+		k.evict(s, s.lru.Back())
+	}
+
+	return e.l, nil
+}
+
+// expire evict the idle limiters from the least recently used.
+func (k *KeyedLimiter) expire(s *shard, now time.Time) {
+	if k.ttl <= 0 {
+		return
+	}
+
+	for elem := s.lru.Back(); elem != nil; elem = s.lru.Back() {
+		if now.Sub(elem.Value.(*keyedEntry).last) < k.ttl {
+			return
+		}
+		k.evict(s, elem)
+	}
+}
+
+func (k *KeyedLimiter) evict(s *shard, elem *list.Element) {
+	e := s.lru.Remove(elem).(*keyedEntry)
+	delete(s.items, e.key)
+	e.l.Close()
+}
+
+// Sweep evict the idle limiters of all shards, the idle limiters are also
+// evicted lazily while requesting the same shard.
+func (k *KeyedLimiter) Sweep() {
+	now := k.clock.Now()
+	for _, s := range k.shards {
+		s.mu.Lock()
+		k.expire(s, now)
+		s.mu.Unlock()
+	}
+}
+
+// Len return the count of keys.
+func (k *KeyedLimiter) Len() int {
+	n := 0
+	for _, s := range k.shards {
+		s.mu.Lock()
+		n += s.lru.Len()
+		s.mu.Unlock()
+	}
+
+	return n
+}
+
+// Close close the limiters of all keys.
+func (k *KeyedLimiter) Close() {
+	if !k.closed.CompareAndSwap(false, true) {
+		return
+	}
+
+	for _, s := range k.shards {
+		s.mu.Lock()
+		for s.lru.Len() > 0 {
+			k.evict(s, s.lru.Back())
+		}
+		s.mu.Unlock()
+	}
+}
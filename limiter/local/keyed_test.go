@@ -0,0 +1,209 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+	"github.com/TimeWtr/gox/limiter"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyedLimiter_Allow(t *testing.T) {
+	c := clock.NewFake(start)
+	var created []string
+	k := NewKeyedLimiter(func(key string) limiter.Limiter {
+		created = append(created, key)
+		return NewTokenBucket(1, 2, WithClock(c))
+	}, WithShards(1), WithKeyedClock(c))
+	defer k.Close()
+
+	for i := 0; i < 3; i++ {
+		ok, err := k.Allow(context.Background(), "user_1")
+		assert.Equal(t, i < 2, ok)
+		assert.Equal(t, i >= 2, err != nil)
+	}
+
+	// the keys are limited separately.
+	ok, err := k.Allow(context.Background(), "user_2")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+
+	ok, err = k.AllowN(context.Background(), 2, "tenant_1", "user_1")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"user_1", "user_2", "tenant_1:user_1"}, created)
+	assert.Equal(t, 3, k.Len())
+
+	_, err = k.Allow(context.Background())
+	assert.Equal(t, errorx.ErrMissingKey, err)
+}
+
+func TestKeyedLimiter_Allow_Ambiguous(t *testing.T) {
+	c := clock.NewFake(start)
+	var created []string
+	k := NewKeyedLimiter(func(key string) limiter.Limiter {
+		created = append(created, key)
+		return NewFixedWindow(time.Minute, 1, WithClock(c))
+	}, WithShards(1), WithKeyedClock(c))
+	defer k.Close()
+
+	for _, key := range [][]string{{"a:b", "c"}, {"a", "b:c"}, {`a\`, "b"}, {`a\:b`}} {
+		ok, err := k.Allow(context.Background(), key...)
+		assert.True(t, ok)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{`a\:b:c`, `a:b\:c`, `a\\:b`, `a\\\:b`}, created)
+}
+
+func TestKeyedLimiter_Evict(t *testing.T) {
+	c := clock.NewFake(start)
+	var closed []string
+	factory := func(key string) limiter.Limiter {
+		return &closeRecorder{Limiter: NewFixedWindow(time.Minute, 1, WithClock(c)), key: key, closed: &closed}
+	}
+
+	// the least recently used key is evicted over bound.
+	k := NewKeyedLimiter(factory, WithShards(1), WithMaxKeys(2), WithKeyedClock(c))
+	for _, key := range []string{"a", "b", "a", "c"} {
+		_, _ = k.Allow(context.Background(), key)
+	}
+	assert.Equal(t, []string{"b"}, closed)
+	assert.Equal(t, 2, k.Len())
+
+	// the limiter of key is created again after evicted.
+	ok, err := k.Allow(context.Background(), "b")
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "a"}, closed)
+
+	k.Close()
+	assert.ElementsMatch(t, []string{"b", "a", "c", "b"}, closed)
+	_, err = k.Allow(context.Background(), "a")
+	assert.Equal(t, errorx.ErrClosed, err)
+
+	// the idle keys are expired.
+	closed = nil
+	k = NewKeyedLimiter(factory, WithIdleTTL(time.Minute), WithKeyedClock(c))
+	defer k.Close()
+	_, _ = k.Allow(context.Background(), "a")
+	c.Advance(30 * time.Second)
+	_, _ = k.Allow(context.Background(), "b")
+	c.Advance(30 * time.Second)
+	k.Sweep()
+	assert.Equal(t, []string{"a"}, closed)
+	assert.Equal(t, 1, k.Len())
+}
+
+// closeRecorder record the key of limiter closed.
+type closeRecorder struct {
+	limiter.Limiter
+	key    string
+	closed *[]string
+}
+
+func (c *closeRecorder) Close() {
+	*c.closed = append(*c.closed, c.key)
+	c.Limiter.Close()
+}
+
+func TestKeyedLimiter_Concurrent(t *testing.T) {
+	k := NewKeyedLimiter(func(string) limiter.Limiter {
+		return NewFixedWindow(time.Hour, 10)
+	}, WithMaxKeys(64))
+	defer k.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				_, err := k.Allow(context.Background(), fmt.Sprintf("key_%d", (i*1000+j)%100))
+				if err != nil {
+					assert.Equal(t, errorx.ErrOverMaxLimit, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, k.Len(), 64)
+}
+
+// closeCounter count the limiters closed.
+type closeCounter struct {
+	limiter.Limiter
+	closed *atomic.Int64
+}
+
+func (c *closeCounter) Close() {
+	c.closed.Add(1)
+	c.Limiter.Close()
+}
+
+// TestKeyedLimiter_Close_Concurrent run with -race, the limiters created
+// while closing are all closed.
+func TestKeyedLimiter_Close_Concurrent(t *testing.T) {
+	var created, closed atomic.Int64
+	k := NewKeyedLimiter(func(string) limiter.Limiter {
+		created.Add(1)
+		return &closeCounter{Limiter: NewFixedWindow(time.Hour, 10), closed: &closed}
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				_, err := k.Allow(context.Background(), fmt.Sprintf("key_%d_%d", i, j))
+				if errors.Is(err, errorx.ErrClosed) {
+					return
+				}
+			}
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	k.Close()
+	wg.Wait()
+
+	assert.Zero(t, k.Len())
+	assert.Equal(t, created.Load(), closed.Load())
+}
+
+func BenchmarkKeyedLimiter_Allow(b *testing.B) {
+	k := NewKeyedLimiter(func(string) limiter.Limiter {
+		return NewTokenBucket(1e6, 1000)
+	}, WithMaxKeys(10000))
+	defer k.Close()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _ = k.Allow(context.Background(), fmt.Sprintf("user_%d", i%1000))
+			i++
+		}
+	})
+}
@@ -17,158 +17,727 @@ package local
 import (
 	"container/list"
 	"context"
+	"errors"
+	"math"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/TimeWtr/gox/clock"
 	"github.com/TimeWtr/gox/limiter"
 
 	"github.com/TimeWtr/gox/errorx"
 )
 
-// Buckets token bucket limiter
-type Buckets struct {
-	// token bucket
-	ch chan struct{}
-	// close signal channel
-	closeCh chan struct{}
-	// grant token interval
-	interval time.Duration
+// Option the optional config of local limiters.
+type Option func(*options)
+
+type options struct {
+	// the ratio of capacity reserved for high priority requests.
+	reserve float64
+	// the source of time, default is clock.Real.
+	clock clock.Clock
+	// the sub windows of the sliding window counter.
+	buckets int
+	// the queue capacity of the leaky bucket.
+	queue int
 }
 
-func NewBuckets(interval time.Duration, capacity int64) limiter.Limiter {
-	bk := &Buckets{
-		ch:       make(chan struct{}, capacity),
-		closeCh:  make(chan struct{}),
-		interval: interval,
+// WithHighPriorityReserve reserve the ratio of capacity for the high
+// priority requests, the priority is passed by limiter.WithPriority, the
+// low and medium priority requests are rejected while the remaining
+// capacity is within the reserved. The ratio must be in [0, 1).
+func WithHighPriorityReserve(ratio float64) Option {
+	return func(o *options) {
+		if ratio >= 0 && ratio < 1 {
+			o.reserve = ratio
+		}
 	}
+}
 
-	ticker := time.NewTicker(bk.interval)
-
-	go func() {
-		for {
-			select {
-			case <-bk.closeCh:
-				close(bk.ch)
-				ticker.Stop()
-				return
-			case <-ticker.C:
-				select {
-				case bk.ch <- struct{}{}:
-				default:
-				}
-			}
+// WithClock set the source of time of limiter, the tests can use
+// clock.Fake to advance time exactly.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		if c != nil {
+			o.clock = c
 		}
-	}()
+	}
+}
 
-	return bk
+// WithWindowBuckets set the sub windows of the sliding window counter,
+// the more sub windows the more accurate, and the more memory used.
+func WithWindowBuckets(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.buckets = n
+		}
+	}
+}
+
+// WithQueueCapacity set the max requests waiting in the queue of leaky
+// bucket, the request overflows the queue is rejected at once.
+func WithQueueCapacity(n int) Option {
+	return func(o *options) {
+		if n >= 0 {
+			o.queue = n
+		}
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{clock: clock.Real()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// reserved return the capacity reserved for high priority requests.
+func (o options) reserved(capacity int64) int64 {
+	return int64(o.reserve * float64(capacity))
+}
+
+// limit return the capacity available for the request, the high priority
+// requests can use the reserved capacity.
+func limit(ctx context.Context, capacity, reserved int64) int64 {
+	if limiter.PriorityFromContext(ctx) == limiter.PriorityHigh {
+		return capacity
+	}
+
+	return capacity - reserved
+}
+
+var (
+	_ limiter.Reserver = (*Buckets)(nil)
+	_ limiter.Reserver = (*FixedWindow)(nil)
+	_ limiter.Reserver = (*SlidingWindow)(nil)
+)
+
+// Buckets the lazy token bucket limiter, the tokens accrued are computed
+// from the elapsed time on each Allow, so that there is no background
+// goroutine, and the rate can be fractional or sub-millisecond.
+type Buckets struct {
+	// the nanoseconds to grant one token.
+	interval float64
+	// the max tokens, the burst of requests.
+	burst float64
+	// the tokens left at last.
+	tokens float64
+	// the time of the last refill.
+	last time.Time
+	// the tokens reserved for high priority requests.
+	reserved int64
+	// whether the limiter is closed.
+	closed bool
+	// the source of time
+	clock clock.Clock
+	// locker
+	mu *sync.Mutex
+}
+
+// NewBuckets create the token bucket granting one token every interval,
+// it holds capacity tokens at most and starts empty.
+func NewBuckets(interval time.Duration, capacity int64, opts ...Option) limiter.Reserver {
+	return newBuckets(float64(interval), capacity, 0, opts)
+}
+
+// NewTokenBucket create the token bucket granting rate tokens per second,
+// the rate can be fractional, such as 0.5 means one token every 2 seconds.
+// It holds burst tokens at most and starts full. The bucket of non-positive
+// rate never refills, use NewCheckedTokenBucket to reject it.
+func NewTokenBucket(rate float64, burst int64, opts ...Option) limiter.Reserver {
+	interval := math.Inf(1)
+	if rate > 0 {
+		interval = float64(time.Second) / rate
+	}
+
+	return newBuckets(interval, burst, burst, opts)
+}
+
+// NewCheckedTokenBucket create the token bucket the same as NewTokenBucket,
+// it returns ErrInvalidRate if the rate is not positive.
+func NewCheckedTokenBucket(rate float64, burst int64, opts ...Option) (limiter.Reserver, error) {
+	if !(rate > 0) {
+		return nil, errorx.ErrInvalidRate
+	}
+
+	return NewTokenBucket(rate, burst, opts...), nil
+}
+
+func newBuckets(interval float64, burst, tokens int64, opts []Option) *Buckets {
+	o := newOptions(opts)
+	return &Buckets{
+		interval: interval,
+		burst:    float64(burst),
+		tokens:   float64(tokens),
+		last:     o.clock.Now(),
+		reserved: o.reserved(burst),
+		clock:    o.clock,
+		mu:       new(sync.Mutex),
+	}
+}
+
+// refill add the tokens accrued since the last refill, the bucket never
+// exceeds the burst.
+func (b *Buckets) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+float64(elapsed)/b.interval)
+		b.last = now
+	}
 }
 
 func (b *Buckets) Allow(ctx context.Context) (bool, error) {
+	return b.AllowN(ctx, 1)
+}
+
+// AllowN take n tokens at once, the cost exceeds the burst is never allowed.
+func (b *Buckets) AllowN(ctx context.Context, n int) (bool, error) {
+	capacity := limit(ctx, int64(b.burst), b.reserved)
+	if ok, err := limiter.CheckCost(n, capacity); ok || err != nil {
+		return ok, err
+	}
+
 	select {
 	case <-ctx.Done():
 		// context timeout
 		return false, ctx.Err()
-	case <-b.closeCh:
-		// receive close signal
-		return false, errorx.ErrClosed
-	case <-b.ch:
-		// get a token
-		return true, nil
 	default:
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return false, errorx.ErrClosed
+	}
+
+	b.refill(b.clock.Now())
+	// the remaining tokens are reserved for high priority requests.
+	if b.tokens-(b.burst-float64(capacity)) < float64(n) {
 		return false, errorx.ErrOverMaxLimit
 	}
+	b.tokens -= float64(n)
+
+	return true, nil
+}
+
+// Wait block until the token is available or ctx is done.
+func (b *Buckets) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	return b.reserve(limit(ctx, int64(b.burst), b.reserved)).Wait(ctx)
+}
+
+// Reserve reserve the token of a low priority request, the tokens are
+// taken in advance, so that the bucket may go into debt.
+func (b *Buckets) Reserve() *limiter.Reservation {
+	return b.reserve(int64(b.burst) - b.reserved)
+}
+
+// reserve reserve the token with capacity tokens available to the
+// request, the others are reserved for high priority requests.
+func (b *Buckets) reserve(capacity int64) *limiter.Reservation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return limiter.RejectReservation(errorx.ErrClosed)
+	}
+
+	// the bucket never holds enough tokens.
+	if capacity < 1 {
+		return limiter.RejectReservation(errorx.ErrOverMaxLimit)
+	}
+	reserved := b.burst - float64(capacity)
+
+	now := b.clock.Now()
+	b.refill(now)
+
+	timeToAct := now
+	if short := reserved - (b.tokens - 1); short > 0 {
+		wait := short * b.interval
+		// the token is never granted in time, such as the bucket never refills.
+		if wait > math.MaxInt64 {
+			return limiter.RejectReservation(errorx.ErrOverMaxLimit)
+		}
+		timeToAct = now.Add(time.Duration(wait))
+	}
+	b.tokens--
+
+	return limiter.NewReservation(b.clock, timeToAct, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		// the token has been used.
+		now := b.clock.Now()
+		if !now.Before(timeToAct) {
+			return
+		}
+		b.refill(now)
+		b.tokens = min(b.burst, b.tokens+1)
+	})
 }
 
 func (b *Buckets) Close() {
-	close(b.closeCh)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+}
+
+// QueueLimiter the limiter queues the requests, the depth of queue is
+// exposed by Stats.
+type QueueLimiter interface {
+	limiter.Reserver
+	// Stats return the snapshot of queue.
+	Stats() QueueStats
+}
+
+// QueueStats the snapshot of the queue of limiter.
+type QueueStats struct {
+	// the requests waiting in queue.
+	Depth int
+	// the max requests can wait in queue.
+	Capacity int
+	// the requests released, including the ones never queued.
+	Released int64
+	// the requests rejected since the queue is full.
+	Rejected int64
+	// the requests left the queue since the context is done.
+	Canceled int64
 }
 
-// LeakyBucket The leaky bucket algorithm is implemented by ticker.
+var _ QueueLimiter = (*LeakyBucket)(nil)
+
+// LeakyBucket the leaky bucket algorithm with queueing semantics, the
+// requests enter a bounded FIFO queue and are released one per interval,
+// the caller blocks until released or the context is done, and the
+// request overflows the queue is rejected at once. There is no background
+// goroutine, the head of queue waits for its own release and hands over
+// to the next one.
 type LeakyBucket struct {
-	// time duration
-	ticker *time.Ticker
-	// once do
-	once sync.Once
+	// the interval to release one request.
+	interval time.Duration
+	// the max requests can wait in queue.
+	capacity int
+	// the waiting requests, the item is *waiter.
+	queue *list.List
+	// the time of the last release.
+	last time.Time
+	// the stats of queue.
+	released, rejected, canceled int64
+	// closed when the limiter is closed.
+	done   chan struct{}
+	closed bool
+	// the source of time
+	clock clock.Clock
+	// locker
+	mu *sync.Mutex
+}
+
+// waiter the request waiting in queue, head is closed when it becomes the
+// head of queue.
+type waiter struct {
+	head chan struct{}
 }
 
-func NewLeakyBucket(interval time.Duration) limiter.Limiter {
+// NewLeakyBucket create the leaky bucket releasing one request every
+// interval, the requests can not be released at once are queued up to the
+// capacity set by WithQueueCapacity, default is no queue. The bucket of
+// non-positive interval releases nothing, use NewCheckedLeakyBucket to
+// reject it.
+func NewLeakyBucket(interval time.Duration, opts ...Option) QueueLimiter {
+	o := newOptions(opts)
 	return &LeakyBucket{
-		ticker: time.NewTicker(interval),
-		once:   sync.Once{},
+		interval: interval,
+		capacity: o.queue,
+		queue:    list.New(),
+		// the first request is released at once.
+		last:  o.clock.Now().Add(-interval),
+		done:  make(chan struct{}),
+		clock: o.clock,
+		mu:    new(sync.Mutex),
 	}
 }
 
+// NewCheckedLeakyBucket create the leaky bucket the same as NewLeakyBucket,
+// it returns ErrInvalidInterval if the interval is not positive.
+func NewCheckedLeakyBucket(interval time.Duration, opts ...Option) (QueueLimiter, error) {
+	if interval <= 0 {
+		return nil, errorx.ErrInvalidInterval
+	}
+
+	return NewLeakyBucket(interval, opts...), nil
+}
+
+// AllowN the leaky bucket drains one request per interval, the cost more
+// than one is never allowed.
+func (l *LeakyBucket) AllowN(ctx context.Context, n int) (bool, error) {
+	if ok, err := limiter.CheckCost(n, 1); ok || err != nil {
+		return ok, err
+	}
+
+	return l.Allow(ctx)
+}
+
+// Allow release the request at once if the queue is empty and the
+// interval has elapsed since the last release, otherwise the request is
+// queued and blocks until released.
 func (l *LeakyBucket) Allow(ctx context.Context) (bool, error) {
 	select {
 	case <-ctx.Done():
 		return false, ctx.Err()
-	case <-l.ticker.C:
-		return true, nil
 	default:
+	}
+
+	if l.interval <= 0 {
+		return false, errorx.ErrInvalidInterval
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return false, errorx.ErrClosed
+	}
+
+	// fast path
+	now := l.clock.Now()
+	if l.queue.Len() == 0 && !now.Before(l.last.Add(l.interval)) {
+		l.last = now
+		l.released++
+		l.mu.Unlock()
+		return true, nil
+	}
+
+	if l.queue.Len() >= l.capacity {
+		l.rejected++
+		l.mu.Unlock()
 		return false, errorx.ErrOverMaxLimit
 	}
+
+	w := &waiter{head: make(chan struct{})}
+	e := l.queue.PushBack(w)
+	if l.queue.Len() == 1 {
+		close(w.head)
+	}
+	l.mu.Unlock()
+
+	return l.wait(ctx, e, w)
 }
 
-func (l *LeakyBucket) Close() {
-	l.once.Do(func() {
-		l.ticker.Stop()
+// wait block until the waiter becomes the head of queue and the interval
+// has elapsed since the last release.
+func (l *LeakyBucket) wait(ctx context.Context, e *list.Element, w *waiter) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, l.leave(e, ctx.Err())
+	case <-l.done:
+		return false, l.leave(e, errorx.ErrClosed)
+	case <-w.head:
+	}
+
+	for {
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return false, l.leave(e, errorx.ErrClosed)
+		}
+
+		now := l.clock.Now()
+		delay := l.last.Add(l.interval).Sub(now)
+		if delay <= 0 {
+			l.last = now
+			l.released++
+			l.remove(e)
+			l.mu.Unlock()
+			return true, nil
+		}
+		l.mu.Unlock()
+
+		timer := l.clock.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, l.leave(e, ctx.Err())
+		case <-l.done:
+			timer.Stop()
+			return false, l.leave(e, errorx.ErrClosed)
+		case <-timer.C():
+		}
+	}
+}
+
+// Wait block until the request is released or ctx is done, the request
+// waits for the release reserved, so that it is never rejected by the
+// capacity of queue.
+func (l *LeakyBucket) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	return l.Reserve().Wait(ctx)
+}
+
+// Reserve reserve the next release, the release reserved is ahead of the
+// requests waiting in queue, which are released one interval later.
+func (l *LeakyBucket) Reserve() *limiter.Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return limiter.RejectReservation(errorx.ErrClosed)
+	}
+	if l.interval <= 0 {
+		return limiter.RejectReservation(errorx.ErrInvalidInterval)
+	}
+
+	timeToAct := l.clock.Now()
+	if next := l.last.Add(l.interval); next.After(timeToAct) {
+		timeToAct = next
+	}
+	l.last = timeToAct
+	l.released++
+
+	return limiter.NewReservation(l.clock, timeToAct, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		// the release has been used, or the later one has been reserved.
+		if !l.clock.Now().Before(timeToAct) || !l.last.Equal(timeToAct) {
+			return
+		}
+		l.last = timeToAct.Add(-l.interval)
+		l.released--
 	})
 }
 
+// leave remove the waiter not released from queue, and return err.
+func (l *LeakyBucket) leave(e *list.Element, err error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !errors.Is(err, errorx.ErrClosed) {
+		l.canceled++
+	}
+	l.remove(e)
+
+	return err
+}
+
+// remove remove the waiter from queue, the next one becomes the head if
+// the removed is the head.
+func (l *LeakyBucket) remove(e *list.Element) {
+	head := l.queue.Front() == e
+	l.queue.Remove(e)
+	if next := l.queue.Front(); head && next != nil {
+		close(next.Value.(*waiter).head)
+	}
+}
+
+// Stats return the snapshot of queue.
+func (l *LeakyBucket) Stats() QueueStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return QueueStats{
+		Depth:    l.queue.Len(),
+		Capacity: l.capacity,
+		Released: l.released,
+		Rejected: l.rejected,
+		Canceled: l.canceled,
+	}
+}
+
+// Close close the limiter, the waiting requests return ErrClosed.
+func (l *LeakyBucket) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return
+	}
+	l.closed = true
+	close(l.done)
+}
+
 // FixedWindow The fixed window algorithm is implemented by fix window(interval).
+// the windows are aligned to the creation time, and counted by epoch in a
+// ring of slots, every slot packs the epoch and count into a single atomic
+// word, so that the admission of a window is decided by one CAS, and at most
+// rate requests are admitted per window. The ring holds the current and
+// future windows, so that the permits of future windows can be reserved.
 type FixedWindow struct {
 	// window size
-	interval time.Duration
+	interval int64
 	// start time
 	startTime int64
 	// request limit rate
 	rate int64
-	// current window request counter
-	cnt int64
+	// the ring of the current and reserved future windows by epoch.
+	slots []atomic.Uint64
+	// the requests reserved for high priority requests.
+	reserved int64
+	// the source of time
+	clock clock.Clock
 }
 
-func NewFixedWindow(interval time.Duration, rate int64) limiter.Limiter {
+// the windows can be reserved ahead at most.
+const reserveWindows = 64
+
+// MaxFixedWindowRate the max rate of FixedWindow, the count of window is
+// packed with the epoch in one word.
+const MaxFixedWindowRate = maxCount
+
+// NewFixedWindow create the fixed window limiter allowing rate requests
+// per interval, the rate over MaxFixedWindowRate is clamped to it, use
+// NewCheckedFixedWindow to reject it.
+func NewFixedWindow(interval time.Duration, rate int64, opts ...Option) limiter.Reserver {
+	o := newOptions(opts)
+	rate = min(rate, MaxFixedWindowRate)
 	return &FixedWindow{
-		interval:  interval,
-		startTime: time.Now().UnixNano(),
+		interval:  max(1, interval.Nanoseconds()),
+		startTime: o.clock.Now().UnixNano(),
 		rate:      rate,
+		slots:     make([]atomic.Uint64, reserveWindows),
+		reserved:  o.reserved(rate),
+		clock:     o.clock,
+	}
+}
+
+// NewCheckedFixedWindow create the fixed window limiter the same as
+// NewFixedWindow, it returns ErrInvalidRate if the rate is not in
+// [1, MaxFixedWindowRate].
+func NewCheckedFixedWindow(interval time.Duration, rate int64, opts ...Option) (limiter.Reserver, error) {
+	if rate < 1 || rate > MaxFixedWindowRate {
+		return nil, errorx.ErrInvalidRate
+	}
+
+	return NewFixedWindow(interval, rate, opts...), nil
+}
+
+// epoch return the window index of now.
+func (f *FixedWindow) epoch(now time.Time) int64 {
+	return max(0, now.UnixNano()-f.startTime) / f.interval
+}
+
+// add add n requests to the window epoch if the count does not exceed
+// rate, the slot of the expired window is reset. It returns false if the
+// window is full, or the slot has been taken by a later window.
+func (f *FixedWindow) add(epoch, n, rate int64) bool {
+	slot := &f.slots[epoch%int64(len(f.slots))]
+	for {
+		old := slot.Load()
+		e, c := unpack(old)
+		switch d := since(e, epoch, int64(len(f.slots))); {
+		case d < 0:
+			return false
+		case d > 0:
+			c = 0
+		}
+		if c+n > rate {
+			return false
+		}
+
+		if slot.CompareAndSwap(old, pack(epoch, c+n)) {
+			return true
+		}
+	}
+}
+
+// sub remove n requests from the window epoch if it is still in the slot.
+func (f *FixedWindow) sub(epoch, n int64) {
+	slot := &f.slots[epoch%int64(len(f.slots))]
+	for {
+		old := slot.Load()
+		e, c := unpack(old)
+		if since(e, epoch, 0) != 0 || c == 0 {
+			return
+		}
+
+		if slot.CompareAndSwap(old, pack(epoch, max(0, c-n))) {
+			return
+		}
 	}
 }
 
 func (f *FixedWindow) Allow(ctx context.Context) (bool, error) {
+	return f.AllowN(ctx, 1)
+}
+
+// AllowN count n requests at once, the cost exceeds the rate of window
+// is never allowed.
+func (f *FixedWindow) AllowN(ctx context.Context, n int) (bool, error) {
+	rate := limit(ctx, f.rate, f.reserved)
+	if ok, err := limiter.CheckCost(n, rate); ok || err != nil {
+		return ok, err
+	}
+
 	select {
 	case <-ctx.Done():
 		return false, ctx.Err()
 	default:
 	}
 
-	// Determine whether the current timestamp is within the window period.
-	now := time.Now().UnixNano()
-	cnt := atomic.LoadInt64(&f.cnt)
-	if f.startTime+f.interval.Nanoseconds() <= now {
-		// window expired
-		if atomic.CompareAndSwapInt64(&f.startTime, f.startTime, now) {
-			atomic.CompareAndSwapInt64(&f.cnt, cnt, 0)
-		}
+	if !f.add(f.epoch(f.clock.Now()), int64(n), rate) {
+		// over request limit
+		return false, errorx.ErrOverMaxLimit
 	}
 
+	return true, nil
+}
+
+// Wait block until the window has room or ctx is done.
+func (f *FixedWindow) Wait(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
-		return false, ctx.Err()
+		return ctx.Err()
 	default:
 	}
 
-	cnt = atomic.AddInt64(&f.cnt, 1)
-	if cnt >= f.rate {
-		// over request limit
-		return false, errorx.ErrOverMaxLimit
+	return f.reserve(limit(ctx, f.rate, f.reserved)).Wait(ctx)
+}
+
+// Reserve reserve the permit of a low priority request in the first
+// window has room, the current or a future one, the reservation is
+// rejected if the next 64 windows are full.
+func (f *FixedWindow) Reserve() *limiter.Reservation {
+	return f.reserve(f.rate - f.reserved)
+}
+
+func (f *FixedWindow) reserve(rate int64) *limiter.Reservation {
+	if rate < 1 {
+		return limiter.RejectReservation(errorx.ErrOverMaxLimit)
 	}
 
-	// counter ++
-	atomic.AddInt64(&f.cnt, 1)
+	now := f.clock.Now()
+	e := f.epoch(now)
+	k := e
+	for !f.add(k, 1, rate) {
+		if k++; k-e >= int64(len(f.slots)) {
+			return limiter.RejectReservation(errorx.ErrOverMaxLimit)
+		}
+	}
 
-	return true, nil
+	timeToAct := now
+	if k > e {
+		timeToAct = time.Unix(0, f.startTime+k*f.interval)
+	}
+
+	return limiter.NewReservation(f.clock, timeToAct, func() {
+		// the permit has been used.
+		if !f.clock.Now().Before(timeToAct) {
+			return
+		}
+		f.sub(k, 1)
+	})
 }
 
 func (f *FixedWindow) Close() {}
@@ -177,59 +746,160 @@ func (f *FixedWindow) Close() {}
 type SlidingWindow struct {
 	// the request count of this window allowed.
 	rate int
-	// window request queue
+	// window request queue, the item is slot.
 	q *list.List
+	// the request count of the slots in queue.
+	cnt int
 	// locker
 	l *sync.Mutex
 	// window size
 	interval time.Duration
+	// the requests reserved for high priority requests.
+	reserved int64
+	// the source of time
+	clock clock.Clock
 }
 
-func NewSlidingWindow(interval time.Duration, rate int) limiter.Limiter {
+// slot the requests admitted at the same time.
+type slot struct {
+	at int64
+	n  int
+}
+
+func NewSlidingWindow(interval time.Duration, rate int, opts ...Option) limiter.Reserver {
+	o := newOptions(opts)
 	return &SlidingWindow{
 		interval: interval,
 		q:        list.New(),
 		l:        &sync.Mutex{},
 		rate:     rate,
+		reserved: o.reserved(int64(rate)),
+		clock:    o.clock,
+	}
+}
+
+// evict remove the slots slide out of the window ended at now.
+func (l *SlidingWindow) evict(now int64) {
+	startTime := now - l.interval.Nanoseconds()
+	e := l.q.Front()
+	for e != nil && e.Value.(slot).at <= startTime {
+		l.remove(e)
+		e = l.q.Front()
+	}
+}
+
+// push log n requests at the time, the log keeps in order of time, the
+// slots reserved in the future are after the requests admitted now.
+func (l *SlidingWindow) push(at int64, n int) *list.Element {
+	l.cnt += n
+	e := l.q.Back()
+	for e != nil && e.Value.(slot).at > at {
+		e = e.Prev()
+	}
+	if e == nil {
+		return l.q.PushFront(slot{at: at, n: n})
 	}
+
+	return l.q.InsertAfter(slot{at: at, n: n}, e)
+}
+
+func (l *SlidingWindow) remove(e *list.Element) {
+	l.cnt -= l.q.Remove(e).(slot).n
 }
 
 func (l *SlidingWindow) Allow(ctx context.Context) (bool, error) {
+	return l.AllowN(ctx, 1)
+}
+
+// AllowN log n requests at once, the cost exceeds the rate of window is
+// never allowed.
+func (l *SlidingWindow) AllowN(ctx context.Context, n int) (bool, error) {
+	rate := int(limit(ctx, int64(l.rate), l.reserved))
+	if ok, err := limiter.CheckCost(n, int64(rate)); ok || err != nil {
+		return ok, err
+	}
+
 	// whether context timeout
 	select {
 	case <-ctx.Done():
-		return false, nil
+		return false, ctx.Err()
 	default:
 	}
 
 	// now represent the end time of this window.
-	now := time.Now().UnixNano()
+	now := l.clock.Now().UnixNano()
 
-	// fast path
 	l.l.Lock()
-	if l.q.Len() < l.rate {
-		l.q.PushBack(now)
-		l.l.Unlock()
+	defer l.l.Unlock()
+
+	// fast path
+	if l.cnt+n <= rate {
+		l.push(now, n)
 		return true, nil
 	}
 
 	// low path
-	startTime := now - l.interval.Nanoseconds()
-	e := l.q.Front()
-	for e != nil && e.Value.(int64) <= startTime {
-		_ = l.q.Remove(e)
-		e = l.q.Front()
+	l.evict(now)
+	if l.cnt+n > rate {
+		return false, errorx.ErrOverMaxLimit
+	}
+	l.push(now, n)
+
+	return true, nil
+}
+
+// Wait block until the window has room or ctx is done.
+func (l *SlidingWindow) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
 	}
-	l.l.Unlock()
+
+	return l.reserve(int(limit(ctx, int64(l.rate), l.reserved))).Wait(ctx)
+}
+
+// Reserve reserve the permit of a low priority request, the permit is
+// logged at the time to act, so that it slides out of the window later.
+func (l *SlidingWindow) Reserve() *limiter.Reservation {
+	return l.reserve(l.rate - int(l.reserved))
+}
+
+func (l *SlidingWindow) reserve(rate int) *limiter.Reservation {
+	if rate < 1 {
+		return limiter.RejectReservation(errorx.ErrOverMaxLimit)
+	}
+
+	now := l.clock.Now().UnixNano()
 
 	l.l.Lock()
 	defer l.l.Unlock()
-	if l.q.Len() >= l.rate {
-		return false, errorx.ErrOverMaxLimit
+
+	l.evict(now)
+
+	// the permit is available when enough requests from the front slide
+	// out of the window, the log keeps in order of time.
+	timeToAct := now
+	if need := l.cnt - rate + 1; need > 0 {
+		for e := l.q.Front(); e != nil; e = e.Next() {
+			if need -= e.Value.(slot).n; need <= 0 {
+				timeToAct = max(timeToAct, e.Value.(slot).at+l.interval.Nanoseconds())
+				break
+			}
+		}
 	}
-	l.q.PushBack(now)
+	elem := l.push(timeToAct, 1)
 
-	return true, nil
+	return limiter.NewReservation(l.clock, time.Unix(0, timeToAct), func() {
+		l.l.Lock()
+		defer l.l.Unlock()
+
+		// the permit has been used, the unused one is still in the window.
+		if l.clock.Now().UnixNano() >= timeToAct {
+			return
+		}
+		l.remove(elem)
+	})
 }
 
 func (l *SlidingWindow) Close() {}
@@ -16,295 +16,543 @@ package local
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/TimeWtr/gox/clock"
 	"github.com/TimeWtr/gox/errorx"
+	"github.com/TimeWtr/gox/limiter"
 
 	"github.com/stretchr/testify/assert"
 )
 
+var start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
 func TestNewBuckets(t *testing.T) {
-	buckets := NewBuckets(time.Millisecond*5, 10)
+	c := clock.NewFake(start)
+	buckets := NewBuckets(time.Millisecond*5, 10, WithClock(c))
+	defer buckets.Close()
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	closeCh := make(chan struct{})
-	go func() {
-		defer wg.Done()
-
-		for {
-			time.Sleep(5 * time.Millisecond)
-			select {
-			case <-closeCh:
-				return
-			default:
-			}
+	// no token before the first interval.
+	ok, err := buckets.Allow(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
-			ok, err := buckets.Allow(ctx)
-			cancel()
-			if err != nil {
-				t.Log("error:", err)
-				continue
-			}
+	c.Advance(15 * time.Millisecond)
 
-			t.Log("ok:", ok)
-			if !ok {
-				continue
-			}
-		}
-	}()
-
-	go func() {
-		defer wg.Done()
-		time.Sleep(time.Second * 10)
-		buckets.Close()
-		close(closeCh)
-	}()
+	for i := 0; i < 3; i++ {
+		ok, err = buckets.Allow(context.Background())
+		assert.True(t, ok)
+		assert.NoError(t, err)
+	}
 
-	wg.Wait()
+	ok, err = buckets.Allow(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
 }
 
 func TestNewBuckets_limit(t *testing.T) {
-	buckets := NewBuckets(time.Millisecond*100, 2)
+	c := clock.NewFake(start)
+	buckets := NewBuckets(time.Millisecond*100, 2, WithClock(c))
+	defer buckets.Close()
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	closeCh := make(chan struct{})
-	go func() {
-		defer wg.Done()
-
-		for {
-			time.Sleep(5 * time.Millisecond)
-			select {
-			case <-closeCh:
-				return
-			default:
-			}
+	// the tokens never exceed the capacity.
+	c.Advance(500 * time.Millisecond)
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
-			ok, err := buckets.Allow(ctx)
-			cancel()
-			if err != nil {
-				t.Log("error:", err)
-				continue
-			}
+	for i := 0; i < 2; i++ {
+		ok, err := buckets.Allow(context.Background())
+		assert.True(t, ok)
+		assert.NoError(t, err)
+	}
+
+	ok, err := buckets.Allow(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+}
+
+func TestNewTokenBucket(t *testing.T) {
+	testCases := []struct {
+		name  string
+		rate  float64
+		burst int64
+		step  time.Duration
+		// the results of the requests after every step.
+		want []bool
+	}{
+		{
+			name:  "fractional rate",
+			rate:  0.5,
+			burst: 1,
+			step:  time.Second,
+			// the bucket starts full, and grants one token every 2 seconds.
+			want: []bool{true, false, true, false, true},
+		},
+		{
+			name:  "sub-millisecond rate",
+			rate:  4000,
+			burst: 1,
+			step:  250 * time.Microsecond,
+			want:  []bool{true, true, true, true},
+		},
+		{
+			name:  "burst",
+			rate:  1,
+			burst: 3,
+			step:  0,
+			want:  []bool{true, true, true, false},
+		},
+	}
 
-			t.Log("ok:", ok)
-			if !ok {
-				continue
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := clock.NewFake(start)
+			tb := NewTokenBucket(tc.rate, tc.burst, WithClock(c))
+			defer tb.Close()
+
+			var got []bool
+			for range tc.want {
+				ok, _ := tb.Allow(context.Background())
+				got = append(got, ok)
+				c.Advance(tc.step)
 			}
-		}
-	}()
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
 
-	go func() {
-		defer wg.Done()
-		time.Sleep(time.Second * 10)
-		buckets.Close()
-		close(closeCh)
-	}()
+func TestNewCheckedTokenBucket(t *testing.T) {
+	for _, rate := range []float64{0, -1, math.NaN()} {
+		tb, err := NewCheckedTokenBucket(rate, 1)
+		assert.Nil(t, tb)
+		assert.Equal(t, errorx.ErrInvalidRate, err)
+	}
 
-	wg.Wait()
+	tb, err := NewCheckedTokenBucket(0.5, 1)
+	assert.NoError(t, err)
+	assert.NotNil(t, tb)
 }
 
-func TestLeakyBucket_Allow(t *testing.T) {
-	lb := NewLeakyBucket(50 * time.Nanosecond)
-	var wg sync.WaitGroup
-	wg.Add(2)
-	closeCh := make(chan struct{})
-	go func() {
-		defer wg.Done()
-		for {
-			select {
-			case <-closeCh:
-				t.Log("receive close signal")
-				return
-			default:
-			}
+func TestNewTokenBucket_InvalidRate(t *testing.T) {
+	c := clock.NewFake(start)
+	for _, rate := range []float64{0, -1, math.NaN()} {
+		// the burst is admitted, and the bucket never refills.
+		tb := NewTokenBucket(rate, 1, WithClock(c))
+		ok, err := tb.Allow(context.Background())
+		assert.True(t, ok)
+		assert.NoError(t, err)
+
+		c.Advance(time.Hour)
+		ok, err = tb.Allow(context.Background())
+		assert.False(t, ok)
+		assert.Equal(t, errorx.ErrOverMaxLimit, err)
+
+		r := tb.Reserve()
+		assert.False(t, r.OK())
+		assert.Equal(t, errorx.ErrOverMaxLimit, r.Err())
+	}
+}
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
-			ok, err := lb.Allow(ctx)
-			cancel()
-			if err != nil {
-				t.Log("error:", err)
-				continue
-			}
+func TestBuckets_Close(t *testing.T) {
+	tb := NewTokenBucket(1, 1)
+	tb.Close()
+	tb.Close()
 
-			t.Log("ok:", ok)
-			if !ok {
-				continue
-			}
-		}
-	}()
+	ok, err := tb.Allow(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrClosed, err)
+}
 
-	go func() {
-		defer wg.Done()
-		time.Sleep(time.Second * 5)
-		lb.Close()
-		close(closeCh)
-	}()
+func BenchmarkBuckets_Allow(b *testing.B) {
+	tb := NewTokenBucket(1e9, 1000)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = tb.Allow(context.Background())
+		}
+	})
+}
 
-	wg.Wait()
+func TestLeakyBucket_Allow(t *testing.T) {
+	c := clock.NewFake(start)
+	lb := NewLeakyBucket(50*time.Millisecond, WithClock(c))
+	defer lb.Close()
+
+	for i := 0; i < 3; i++ {
+		ok, err := lb.Allow(context.Background())
+		assert.True(t, ok)
+		assert.NoError(t, err)
+
+		// one request leaks every interval, no queue by default.
+		ok, err = lb.Allow(context.Background())
+		assert.False(t, ok)
+		assert.Equal(t, errorx.ErrOverMaxLimit, err)
+		c.Advance(50 * time.Millisecond)
+	}
 }
 
 func TestLeakyBucket_Context_Deadline_Exceeded(t *testing.T) {
-	lb := NewLeakyBucket(time.Millisecond * 5)
-	var wg sync.WaitGroup
-	wg.Add(2)
-	closeCh := make(chan struct{})
-	go func() {
-		defer wg.Done()
-		for {
-			select {
-			case <-closeCh:
-				return
-			default:
-			}
+	c := clock.NewFake(start)
+	lb := NewLeakyBucket(time.Millisecond*5, WithClock(c))
+	defer lb.Close()
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
-			_, err := lb.Allow(ctx)
-			cancel()
-			assert.Error(t, context.DeadlineExceeded, err)
-		}
-	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
 
-	go func() {
-		defer wg.Done()
-		time.Sleep(time.Second * 2)
-		lb.Close()
-		close(closeCh)
+	_, err := lb.Allow(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestLeakyBucket_Err_Limit(t *testing.T) {
+	c := clock.NewFake(start)
+	lb := NewLeakyBucket(time.Second*5, WithClock(c))
+	defer lb.Close()
+
+	ok, _ := lb.Allow(context.Background())
+	assert.True(t, ok)
+	for i := 0; i < 4; i++ {
+		c.Advance(time.Second)
+		_, err := lb.Allow(context.Background())
+		assert.Equal(t, errorx.ErrOverMaxLimit, err)
+	}
+}
 
+// enqueue call Allow in background, and wait until the request is queued.
+func enqueue(ctx context.Context, lb QueueLimiter, name string, res chan<- string) {
+	depth := lb.Stats().Depth
+	go func() {
+		ok, err := lb.Allow(ctx)
+		res <- fmt.Sprintf("%s:%t:%v", name, ok, err)
 	}()
+	for lb.Stats().Depth == depth {
+		time.Sleep(time.Millisecond)
+	}
+}
 
-	wg.Wait()
+func TestLeakyBucket_Queue(t *testing.T) {
+	c := clock.NewFake(start)
+	lb := NewLeakyBucket(time.Second, WithQueueCapacity(2), WithClock(c))
+	defer lb.Close()
+
+	ok, _ := lb.Allow(context.Background())
+	assert.True(t, ok)
+
+	res := make(chan string, 2)
+	enqueue(context.Background(), lb, "a", res)
+	enqueue(context.Background(), lb, "b", res)
+
+	// the queue overflows.
+	ok, err := lb.Allow(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+	assert.Equal(t, QueueStats{Depth: 2, Capacity: 2, Released: 1, Rejected: 1}, lb.Stats())
+
+	// the requests are released in order, one per interval.
+	for _, want := range []string{"a:true:<nil>", "b:true:<nil>"} {
+		c.BlockUntil(1)
+		c.Advance(time.Second)
+		assert.Equal(t, want, <-res)
+	}
+	assert.Equal(t, QueueStats{Capacity: 2, Released: 3, Rejected: 1}, lb.Stats())
 }
 
-func TestLeakyBucket_Err_Limit(t *testing.T) {
-	lb := NewLeakyBucket(time.Second * 5)
-	var wg sync.WaitGroup
-	wg.Add(2)
+func TestLeakyBucket_Queue_Cancel(t *testing.T) {
+	c := clock.NewFake(start)
+	lb := NewLeakyBucket(time.Second, WithQueueCapacity(3), WithClock(c))
+
+	ok, _ := lb.Allow(context.Background())
+	assert.True(t, ok)
+
+	res := make(chan string, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	enqueue(ctx, lb, "a", res)
+	enqueue(context.Background(), lb, "b", res)
+	enqueue(context.Background(), lb, "c", res)
+
+	// the head leaves, the next one becomes the head.
+	c.BlockUntil(1)
+	cancel()
+	assert.Equal(t, "a:false:context canceled", <-res)
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	assert.Equal(t, "b:true:<nil>", <-res)
+
+	// the waiting requests return when closed.
+	lb.Close()
+	assert.Equal(t, "c:false:limiter closed", <-res)
+	assert.Equal(t, QueueStats{Capacity: 3, Released: 2, Canceled: 1}, lb.Stats())
+
+	_, err := lb.Allow(context.Background())
+	assert.Equal(t, errorx.ErrClosed, err)
+}
 
-	closeCh := make(chan struct{})
-	go func() {
-		defer wg.Done()
-		for {
-			select {
-			case <-closeCh:
-				return
-			default:
-			}
+func TestLeakyBucket_Reserve(t *testing.T) {
+	c := clock.NewFake(start)
+	lb := NewLeakyBucket(time.Second, WithClock(c))
+	defer lb.Close()
+
+	var delays []time.Duration
+	var rs []*limiter.Reservation
+	for i := 0; i < 3; i++ {
+		r := lb.Reserve()
+		assert.True(t, r.OK())
+		delays = append(delays, r.Delay())
+		rs = append(rs, r)
+	}
+	assert.Equal(t, []time.Duration{0, time.Second, 2 * time.Second}, delays)
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-			_, err := lb.Allow(ctx)
-			cancel()
-			assert.Error(t, errorx.ErrOverMaxLimit, err)
-		}
-	}()
+	// only the last release reserved is returned.
+	rs[1].Cancel()
+	rs[2].Cancel()
+	assert.Equal(t, 2*time.Second, lb.Reserve().Delay())
+
+	// the request waits for the releases reserved.
+	c.Advance(2 * time.Second)
+	ok, err := lb.Allow(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+	assert.Equal(t, int64(3), lb.Stats().Released)
+}
+
+func TestLeakyBucket_Wait(t *testing.T) {
+	c := clock.NewFake(start)
+	lb := NewLeakyBucket(time.Second, WithClock(c))
+	defer lb.Close()
 
+	ok, _ := lb.Allow(context.Background())
+	assert.True(t, ok)
+
+	// the request waits without the queue.
+	done := make(chan error)
 	go func() {
-		defer wg.Done()
-		time.Sleep(time.Second * 2)
-		lb.Close()
-		close(closeCh)
+		done <- lb.Wait(context.Background())
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	assert.NoError(t, <-done)
 
+	// the release is returned if ctx is done while waiting.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- lb.Wait(ctx)
 	}()
+	c.BlockUntil(1)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Equal(t, time.Second, lb.Reserve().Delay())
+}
+
+func TestNewLeakyBucket_InvalidInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		lb, err := NewCheckedLeakyBucket(interval)
+		assert.Nil(t, lb)
+		assert.Equal(t, errorx.ErrInvalidInterval, err)
+
+		// the bucket releases nothing.
+		lb = NewLeakyBucket(interval)
+		ok, err := lb.Allow(context.Background())
+		assert.False(t, ok)
+		assert.Equal(t, errorx.ErrInvalidInterval, err)
+		assert.Equal(t, errorx.ErrInvalidInterval, lb.Reserve().Err())
+	}
+}
+
+func TestLeakyBucket_Concurrent(t *testing.T) {
+	lb := NewLeakyBucket(time.Millisecond, WithQueueCapacity(100))
+	defer lb.Close()
 
+	var released atomic.Int64
+	var wg sync.WaitGroup
+	begin := time.Now()
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := lb.Allow(context.Background()); ok {
+				released.Add(1)
+			}
+		}()
+	}
 	wg.Wait()
+
+	// all the requests are queued, and released at the drain rate.
+	assert.Equal(t, int64(20), released.Load())
+	assert.GreaterOrEqual(t, time.Since(begin), 19*time.Millisecond)
 }
 
 func TestNewFixedWindow(t *testing.T) {
-	fw := NewFixedWindow(time.Second*5, 1)
-	var wg sync.WaitGroup
-	wg.Add(2)
-	closeCh := make(chan struct{})
-	go func() {
-		defer wg.Done()
+	c := clock.NewFake(start)
+	fw := NewFixedWindow(time.Second*5, 4, WithClock(c))
+	defer fw.Close()
 
-		ticker := time.NewTicker(2 * time.Second)
-		defer ticker.Stop()
+	ok, err := fw.Allow(context.Background())
+	assert.True(t, ok)
+	assert.NoError(t, err)
 
-		for {
-			select {
-			case <-closeCh:
-				return
-			case <-ticker.C:
-			}
+	// exhaust the window.
+	for i := 0; i < 4 && ok; i++ {
+		ok, err = fw.Allow(context.Background())
+	}
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-			ok, err := fw.Allow(ctx)
-			cancel()
-			if err != nil {
-				t.Log("error:", err)
-			}
+	c.Advance(4 * time.Second)
+	ok, _ = fw.Allow(context.Background())
+	assert.False(t, ok)
 
-			t.Log("ok:", ok)
-			if !ok {
-				continue
-			}
-		}
-	}()
+	// the next window starts.
+	c.Advance(time.Second)
+	ok, err = fw.Allow(context.Background())
+	assert.True(t, ok)
+	assert.NoError(t, err)
+}
 
-	go func() {
-		defer wg.Done()
-		defer close(closeCh)
-		defer fw.Close()
+func TestNewCheckedFixedWindow(t *testing.T) {
+	for _, rate := range []int64{0, -1, MaxFixedWindowRate + 1} {
+		fw, err := NewCheckedFixedWindow(time.Second, rate)
+		assert.Nil(t, fw)
+		assert.Equal(t, errorx.ErrInvalidRate, err)
+	}
 
-		time.Sleep(time.Second * 5)
-	}()
+	fw, err := NewCheckedFixedWindow(time.Second, MaxFixedWindowRate)
+	assert.NoError(t, err)
+	assert.NotNil(t, fw)
+}
 
-	wg.Wait()
+// TestFixedWindow_Concurrent run with -race, the requests admitted are
+// attributed to the window by the time read before and after Allow, and
+// every window admits at most rate requests.
+func TestFixedWindow_Allow_EpochWrap(t *testing.T) {
+	c := clock.NewFake(start)
+	fw := NewFixedWindow(time.Nanosecond, 2, WithClock(c))
+	// the epoch exceeds the 40 bits packed.
+	c.Advance(1<<40 + 5)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := fw.Allow(context.Background())
+		assert.Equal(t, i < 2, ok, "request %d", i)
+	}
+
+	c.Advance(time.Nanosecond)
+	ok, err := fw.Allow(context.Background())
+	assert.True(t, ok)
+	assert.NoError(t, err)
 }
 
-func TestSlidingWindow_Allow(t *testing.T) {
-	lb := NewSlidingWindow(time.Second*5, 5)
-	var wg sync.WaitGroup
+func TestFixedWindow_Concurrent(t *testing.T) {
+	const rate = 50
+	c := clock.NewFake(start)
+	fw := NewFixedWindow(time.Second, rate, WithClock(c))
+
+	var (
+		mu       sync.Mutex
+		admitted = map[int64]int{}
+		wg       sync.WaitGroup
+		done     = make(chan struct{})
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
 
-	wg.Add(2)
-	closeCh := make(chan struct{})
-	go func() {
-		defer wg.Done()
-
-		ticker := time.NewTicker(500 * time.Millisecond)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-closeCh:
-				t.Log("receive close signal")
-				return
-			case <-ticker.C:
-				ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
-				ok, err := lb.Allow(ctx)
-				cancel()
-				if err != nil {
-					t.Log("error:", err)
-				} else {
-					t.Log("ok:", ok)
+				before := c.Now()
+				ok, _ := fw.Allow(context.Background())
+				after := c.Now()
+				epoch := before.Sub(start) / time.Second
+				if !ok || epoch != after.Sub(start)/time.Second {
+					continue
 				}
-			default:
+				mu.Lock()
+				admitted[int64(epoch)]++
+				mu.Unlock()
 			}
-		}
-	}()
+		}()
+	}
 
-	go func() {
-		defer wg.Done()
+	for i := 0; i < 20; i++ {
+		time.Sleep(time.Millisecond)
+		c.Advance(time.Second)
+	}
+	close(done)
+	wg.Wait()
 
-		time.Sleep(time.Second * 11)
-		lb.Close()
-		close(closeCh)
-	}()
+	assert.NotEmpty(t, admitted)
+	for epoch, n := range admitted {
+		assert.LessOrEqual(t, n, rate, "window %d", epoch)
+	}
+}
+
+// TestFixedWindow_Concurrent_Exact the clock is frozen, exactly rate of
+// the concurrent requests are admitted.
+func TestFixedWindow_Concurrent_Exact(t *testing.T) {
+	c := clock.NewFake(start)
+	fw := NewFixedWindow(time.Second, 1000, WithClock(c))
 
+	var admitted atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if ok, _ := fw.Allow(context.Background()); ok {
+					admitted.Add(1)
+				}
+			}
+		}()
+	}
 	wg.Wait()
+	assert.Equal(t, int64(1000), admitted.Load())
+}
+
+func BenchmarkFixedWindow_Allow(b *testing.B) {
+	fw := NewFixedWindow(time.Second, maxCount)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = fw.Allow(context.Background())
+		}
+	})
+}
+
+func TestSlidingWindow_Allow(t *testing.T) {
+	c := clock.NewFake(start)
+	lb := NewSlidingWindow(time.Second*5, 5, WithClock(c))
+	defer lb.Close()
+
+	for i := 0; i < 10; i++ {
+		ok, err := lb.Allow(context.Background())
+		assert.Equal(t, i < 5, ok, "request %d", i)
+		assert.Equal(t, i >= 5, err != nil, "request %d", i)
+		c.Advance(500 * time.Millisecond)
+	}
+
+	// the first request slides out of the window.
+	ok, err := lb.Allow(context.Background())
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	ok, _ = lb.Allow(context.Background())
+	assert.False(t, ok)
 }
 
 func TestSlidingWindow_Context_Timeout(t *testing.T) {
 	lb := NewSlidingWindow(time.Second*5, 1)
 	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
 	defer cancel()
+	<-ctx.Done()
+
 	ok, err := lb.Allow(ctx)
 	assert.False(t, ok)
-	assert.Error(t, context.DeadlineExceeded, err)
+	assert.Equal(t, context.DeadlineExceeded, err)
 }
 
 func BenchmarkSlidingWindow_Allow(b *testing.B) {
@@ -320,3 +568,344 @@ func BenchmarkSlidingWindow_Allow(b *testing.B) {
 		b.Log("ok:", ok)
 	}
 }
+
+func TestSlidingWindow_HighPriorityReserve(t *testing.T) {
+	lb := NewSlidingWindow(time.Minute, 10, WithHighPriorityReserve(0.2))
+	low := context.Background()
+	high := limiter.WithPriority(context.Background(), limiter.PriorityHigh)
+
+	for i := 0; i < 8; i++ {
+		ok, err := lb.Allow(low)
+		assert.True(t, ok)
+		assert.NoError(t, err)
+	}
+
+	// the reserved capacity is only for high priority requests.
+	ok, err := lb.Allow(limiter.WithPriority(context.Background(), limiter.PriorityMedium))
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+
+	for i := 0; i < 2; i++ {
+		ok, err = lb.Allow(high)
+		assert.True(t, ok)
+		assert.NoError(t, err)
+	}
+
+	ok, err = lb.Allow(high)
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+}
+
+func TestBuckets_HighPriorityReserve(t *testing.T) {
+	c := clock.NewFake(start)
+	buckets := NewBuckets(time.Second, 2, WithHighPriorityReserve(0.5), WithClock(c))
+	defer buckets.Close()
+
+	// wait for the bucket full.
+	c.Advance(2 * time.Second)
+
+	ok, err := buckets.Allow(context.Background())
+	assert.True(t, ok)
+	assert.NoError(t, err)
+
+	// the last token is reserved for high priority requests.
+	ok, err = buckets.Allow(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+
+	ok, err = buckets.Allow(limiter.WithPriority(context.Background(), limiter.PriorityHigh))
+	assert.True(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestBuckets_Reserve(t *testing.T) {
+	c := clock.NewFake(start)
+	tb := NewTokenBucket(1, 1, WithClock(c))
+
+	var delays []time.Duration
+	var rs []*limiter.Reservation
+	for i := 0; i < 3; i++ {
+		r := tb.Reserve()
+		assert.True(t, r.OK())
+		delays = append(delays, r.Delay())
+		rs = append(rs, r)
+	}
+	assert.Equal(t, []time.Duration{0, time.Second, 2 * time.Second}, delays)
+
+	// the canceled token is returned to bucket.
+	rs[2].Cancel()
+	rs[2].Cancel()
+	assert.Equal(t, 2*time.Second, tb.Reserve().Delay())
+
+	// the used token is not returned.
+	c.Advance(time.Second)
+	rs[1].Cancel()
+	assert.Equal(t, 2*time.Second, tb.Reserve().Delay())
+
+	ok, err := tb.Allow(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+
+	tb.Close()
+	r := tb.Reserve()
+	assert.False(t, r.OK())
+	assert.Equal(t, errorx.ErrClosed, r.Err())
+	assert.Equal(t, errorx.ErrClosed, r.Wait(context.Background()))
+}
+
+func TestBuckets_Wait(t *testing.T) {
+	c := clock.NewFake(start)
+	tb := NewTokenBucket(1, 1, WithClock(c))
+	defer tb.Close()
+
+	// the bucket starts full.
+	assert.NoError(t, tb.Wait(context.Background()))
+
+	done := make(chan error)
+	go func() {
+		done <- tb.Wait(context.Background())
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	assert.NoError(t, <-done)
+
+	// the token is returned if ctx is done while waiting.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- tb.Wait(ctx)
+	}()
+	c.BlockUntil(1)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Equal(t, time.Second, tb.Reserve().Delay())
+
+	// fail fast if the deadline is before the time to act.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	hourly := NewTokenBucket(1.0/3600, 1)
+	assert.NoError(t, hourly.Wait(ctx))
+	assert.Equal(t, errorx.ErrExceedDeadline, hourly.Wait(ctx))
+}
+
+// TestReservation_Wait_Deadline the deadline is compared with the clock of
+// limiter, the fake clock is an hour ahead of the real one.
+func TestReservation_Wait_Deadline(t *testing.T) {
+	c := clock.NewFake(time.Now().Add(time.Hour))
+	tb := NewTokenBucket(1, 1, WithClock(c))
+	defer tb.Close()
+	assert.NoError(t, tb.Wait(context.Background()))
+
+	ctx, cancel := context.WithDeadline(context.Background(), c.Now().Add(500*time.Millisecond))
+	defer cancel()
+	assert.Equal(t, errorx.ErrExceedDeadline, tb.Wait(ctx))
+
+	ctx, cancel = context.WithDeadline(context.Background(), c.Now().Add(2*time.Second))
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- tb.Wait(ctx)
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	assert.NoError(t, <-done)
+}
+
+func TestFixedWindow_Reserve(t *testing.T) {
+	c := clock.NewFake(start)
+	fw := NewFixedWindow(time.Second, 2, WithClock(c))
+
+	var delays []time.Duration
+	var rs []*limiter.Reservation
+	for i := 0; i < 5; i++ {
+		r := fw.Reserve()
+		assert.True(t, r.OK())
+		delays = append(delays, r.Delay())
+		rs = append(rs, r)
+	}
+	assert.Equal(t, []time.Duration{0, 0, time.Second, time.Second, 2 * time.Second}, delays)
+
+	rs[4].Cancel()
+	assert.Equal(t, 2*time.Second, fw.Reserve().Delay())
+
+	// the next window is full of reservations.
+	c.Advance(time.Second)
+	ok, err := fw.Allow(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+
+	done := make(chan error)
+	go func() {
+		done <- fw.Wait(context.Background())
+	}()
+	c.BlockUntil(1)
+	c.Advance(2 * time.Second)
+	assert.NoError(t, <-done)
+
+	// the reservation is rejected when all the windows ahead are full.
+	fw = NewFixedWindow(time.Second, 1, WithClock(c))
+	for i := 0; i < reserveWindows; i++ {
+		assert.True(t, fw.Reserve().OK())
+	}
+	assert.Equal(t, errorx.ErrOverMaxLimit, fw.Reserve().Err())
+}
+
+func TestSlidingWindow_Reserve(t *testing.T) {
+	c := clock.NewFake(start)
+	sw := NewSlidingWindow(time.Second, 2, WithClock(c))
+
+	ok, err := sw.Allow(context.Background())
+	assert.True(t, ok)
+	assert.NoError(t, err)
+
+	c.Advance(300 * time.Millisecond)
+	var delays []time.Duration
+	var rs []*limiter.Reservation
+	for i := 0; i < 3; i++ {
+		r := sw.Reserve()
+		assert.True(t, r.OK())
+		delays = append(delays, r.Delay())
+		rs = append(rs, r)
+	}
+	assert.Equal(t, []time.Duration{0, 700 * time.Millisecond, time.Second}, delays)
+
+	rs[2].Cancel()
+	ok, err = sw.Allow(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, errorx.ErrOverMaxLimit, err)
+
+	done := make(chan error)
+	go func() {
+		done <- sw.Wait(context.Background())
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	assert.NoError(t, <-done)
+}
+
+// TestSlidingWindow_Reserve_Order the slot reserved in the future does not
+// stop the earlier slots logged after it from sliding out.
+func TestSlidingWindow_Reserve_Order(t *testing.T) {
+	c := clock.NewFake(start)
+	sw := NewSlidingWindow(time.Second, 4, WithHighPriorityReserve(0.5), WithClock(c))
+	high := limiter.WithPriority(context.Background(), limiter.PriorityHigh)
+
+	ok, _ := sw.AllowN(context.Background(), 2)
+	assert.True(t, ok)
+	c.Advance(500 * time.Millisecond)
+	// the reservation acts at 1s, and the high priority request at 0.5s.
+	assert.Equal(t, 500*time.Millisecond, sw.Reserve().Delay())
+	ok, _ = sw.Allow(high)
+	assert.True(t, ok)
+
+	// only the reservation is in the window (0.6s, 1.6s].
+	c.Advance(1100 * time.Millisecond)
+	ok, err := sw.Allow(context.Background())
+	assert.True(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestLimiter_AllowN(t *testing.T) {
+	c := clock.NewFake(start)
+	testCases := []struct {
+		name string
+		l    limiter.Limiter
+	}{
+		{name: "token bucket", l: NewTokenBucket(1, 10, WithClock(c))},
+		{name: "fixed window", l: NewFixedWindow(time.Minute, 10, WithClock(c))},
+		{name: "sliding window", l: NewSlidingWindow(time.Minute, 10, WithClock(c))},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer tc.l.Close()
+
+			ok, err := tc.l.AllowN(context.Background(), 6)
+			assert.True(t, ok)
+			assert.NoError(t, err)
+
+			// over limit now, but can be allowed later.
+			ok, err = tc.l.AllowN(context.Background(), 5)
+			assert.False(t, ok)
+			assert.Equal(t, errorx.ErrOverMaxLimit, err)
+
+			ok, err = tc.l.AllowN(context.Background(), 4)
+			assert.True(t, ok)
+			assert.NoError(t, err)
+
+			// the zero cost is always allowed.
+			ok, err = tc.l.AllowN(context.Background(), 0)
+			assert.True(t, ok)
+			assert.NoError(t, err)
+
+			// the cost exceeds the capacity is never allowed.
+			ok, err = tc.l.AllowN(context.Background(), 11)
+			assert.False(t, ok)
+			assert.Equal(t, errorx.ErrExceedCapacity, err)
+
+			_, err = tc.l.AllowN(context.Background(), -1)
+			assert.Equal(t, errorx.ErrInvalidCost, err)
+		})
+	}
+
+	lb := NewLeakyBucket(time.Second, WithClock(c))
+	defer lb.Close()
+	_, err := lb.AllowN(context.Background(), 2)
+	assert.Equal(t, errorx.ErrExceedCapacity, err)
+	c.Advance(time.Second)
+	ok, err := lb.AllowN(context.Background(), 1)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+}
+
+// TestLimiter_AllowN_Reserved the capacity of low priority requests
+// excludes the reserved, the cost exceeds it is never allowed.
+func TestLimiter_AllowN_Reserved(t *testing.T) {
+	c := clock.NewFake(start)
+	opts := []Option{WithHighPriorityReserve(0.5), WithClock(c)}
+	testCases := []struct {
+		name string
+		l    limiter.Limiter
+	}{
+		{name: "token bucket", l: NewTokenBucket(1, 10, opts...)},
+		{name: "fixed window", l: NewFixedWindow(time.Minute, 10, opts...)},
+		{name: "sliding window", l: NewSlidingWindow(time.Minute, 10, opts...)},
+	}
+
+	high := limiter.WithPriority(context.Background(), limiter.PriorityHigh)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer tc.l.Close()
+
+			ok, err := tc.l.AllowN(context.Background(), 6)
+			assert.False(t, ok)
+			assert.Equal(t, errorx.ErrExceedCapacity, err)
+
+			ok, err = tc.l.AllowN(high, 6)
+			assert.True(t, ok)
+			assert.NoError(t, err)
+
+			ok, err = tc.l.AllowN(context.Background(), 4)
+			assert.False(t, ok)
+			assert.Equal(t, errorx.ErrOverMaxLimit, err)
+		})
+	}
+}
+
+func TestSlidingWindow_AllowN_Slide(t *testing.T) {
+	c := clock.NewFake(start)
+	sw := NewSlidingWindow(time.Second, 10, WithClock(c))
+
+	ok, _ := sw.AllowN(context.Background(), 6)
+	assert.True(t, ok)
+	c.Advance(500 * time.Millisecond)
+	ok, _ = sw.AllowN(context.Background(), 4)
+	assert.True(t, ok)
+
+	// the first 6 requests slide out of the window together.
+	assert.Equal(t, 500*time.Millisecond, sw.Reserve().Delay())
+	c.Advance(500 * time.Millisecond)
+	ok, _ = sw.AllowN(context.Background(), 5)
+	assert.True(t, ok)
+	ok, _ = sw.AllowN(context.Background(), 1)
+	assert.False(t, ok)
+}
@@ -0,0 +1,129 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+	"github.com/TimeWtr/gox/errorx"
+)
+
+// Reserver the limiter supports waiting for the permit instead of
+// rejecting the request at once.
+type Reserver interface {
+	Limiter
+	// Wait block until the request is allowed or ctx is done, the priority
+	// of request is passed by WithPriority.
+	Wait(ctx context.Context) error
+	// Reserve reserve the permit of a low priority request, the caller must
+	// wait for Delay before acting, or Cancel the reservation if it will
+	// not act.
+	Reserve() *Reservation
+}
+
+// Reservation the permit reserved from limiter, it is similar to the
+// reservation of x/time/rate.
+type Reservation struct {
+	ok        bool
+	err       error
+	timeToAct time.Time
+	clock     clock.Clock
+	cancel    func()
+	once      sync.Once
+}
+
+// NewReservation return the reservation permitted at timeToAct, the cancel
+// returns the permit to limiter, it is called once at most.
+func NewReservation(c clock.Clock, timeToAct time.Time, cancel func()) *Reservation {
+	return &Reservation{
+		ok:        true,
+		timeToAct: timeToAct,
+		clock:     c,
+		cancel:    cancel,
+	}
+}
+
+// RejectReservation return the reservation never permitted, such as the
+// limiter closed or the request exceeds the capacity of limiter.
+func RejectReservation(err error) *Reservation {
+	return &Reservation{err: err}
+}
+
+// OK report whether the permit is reserved.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Err return the reason why the permit can not be reserved.
+func (r *Reservation) Err() error {
+	return r.err
+}
+
+// TimeToAct return the time the permit is available.
+func (r *Reservation) TimeToAct() time.Time {
+	return r.timeToAct
+}
+
+// Delay return the duration to wait before acting, zero if the permit is
+// available now, and the max duration if not OK.
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return time.Duration(1<<63 - 1)
+	}
+
+	return max(0, r.timeToAct.Sub(r.clock.Now()))
+}
+
+// Cancel return the permit to limiter, it does nothing if the permit has
+// been used, which is decided by limiter.
+func (r *Reservation) Cancel() {
+	if !r.ok || r.cancel == nil {
+		return
+	}
+
+	r.once.Do(r.cancel)
+}
+
+// Wait block until the permit is available, the reservation is canceled
+// if ctx is done first, or the ctx deadline is before the time to act.
+func (r *Reservation) Wait(ctx context.Context) error {
+	if !r.ok {
+		return r.err
+	}
+
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(r.clock.Now()) < delay {
+		r.Cancel()
+		return errorx.ErrExceedDeadline
+	}
+
+	timer := r.clock.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
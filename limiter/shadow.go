@@ -0,0 +1,157 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/TimeWtr/gox/errorx"
+)
+
+// ShadowRecorder record the decisions of the limiters in shadow mode.
+type ShadowRecorder interface {
+	// Record record the decision of the named limiter, rejected is true if
+	// the request would be rejected in enforce mode.
+	Record(name string, rejected bool)
+}
+
+// ShadowStat the decisions of limiter in shadow mode.
+type ShadowStat struct {
+	// the requests evaluated.
+	Total uint64
+	// the requests would be rejected in enforce mode.
+	WouldReject uint64
+}
+
+// ShadowStats the default ShadowRecorder, it counts the decisions by name.
+type ShadowStats struct {
+	stats map[string]ShadowStat
+	mu    *sync.RWMutex
+}
+
+func NewShadowStats() *ShadowStats {
+	return &ShadowStats{
+		stats: map[string]ShadowStat{},
+		mu:    new(sync.RWMutex),
+	}
+}
+
+func (s *ShadowStats) Record(name string, rejected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stat := s.stats[name]
+	stat.Total++
+	if rejected {
+		stat.WouldReject++
+	}
+	s.stats[name] = stat
+}
+
+// Get return the decisions of the named limiter.
+func (s *ShadowStats) Get(name string) ShadowStat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.stats[name]
+}
+
+// Snapshot return the decisions of all limiters.
+func (s *ShadowStats) Snapshot() map[string]ShadowStat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	res := make(map[string]ShadowStat, len(s.stats))
+	for name, stat := range s.stats {
+		res[name] = stat
+	}
+
+	return res
+}
+
+// shadowed convert the decision of limiter in shadow mode, the over limit
+// and over capacity rejections are recorded and admitted, the other errors,
+// such as context canceled or limiter closed, are returned as is.
+func shadowed(name string, r ShadowRecorder, ok bool, err error) (bool, error) {
+	if err != nil && !errors.Is(err, errorx.ErrOverMaxLimit) && !errors.Is(err, errorx.ErrExceedCapacity) {
+		return ok, err
+	}
+
+	r.Record(name, !ok || err != nil)
+	return true, nil
+}
+
+// Shadow the limiter in shadow mode, it evaluates the wrapped limiter and
+// records the would-reject decisions, but always admits the request.
+type Shadow struct {
+	name string
+	l    Limiter
+	r    ShadowRecorder
+}
+
+func NewShadow(name string, l Limiter, r ShadowRecorder) Limiter {
+	return &Shadow{
+		name: name,
+		l:    l,
+		r:    r,
+	}
+}
+
+func (s *Shadow) Allow(ctx context.Context) (bool, error) {
+	ok, err := s.l.Allow(ctx)
+	return shadowed(s.name, s.r, ok, err)
+}
+
+func (s *Shadow) AllowN(ctx context.Context, n int) (bool, error) {
+	ok, err := s.l.AllowN(ctx, n)
+	return shadowed(s.name, s.r, ok, err)
+}
+
+func (s *Shadow) Close() {
+	s.l.Close()
+}
+
+// DisShadow the distributed limiter in shadow mode, it evaluates the
+// wrapped limiter and records the would-reject decisions, but always
+// admits the request.
+type DisShadow struct {
+	name string
+	l    DisLimiter
+	r    ShadowRecorder
+}
+
+func NewDisShadow(name string, l DisLimiter, r ShadowRecorder) DisLimiter {
+	return &DisShadow{
+		name: name,
+		l:    l,
+		r:    r,
+	}
+}
+
+func (s *DisShadow) Allow(ctx context.Context, key ...string) (bool, error) {
+	ok, err := s.l.Allow(ctx, key...)
+	return shadowed(s.name, s.r, ok, err)
+}
+
+func (s *DisShadow) AllowN(ctx context.Context, n int, key ...string) (bool, error) {
+	ok, err := s.l.AllowN(ctx, n, key...)
+	return shadowed(s.name, s.r, ok, err)
+}
+
+func (s *DisShadow) Close() {
+	s.l.Close()
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limiter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/TimeWtr/gox/errorx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countLimiter allow the first limit requests, and reject the others.
+type countLimiter struct {
+	limit int
+	count int
+}
+
+func (c *countLimiter) Allow(ctx context.Context) (bool, error) {
+	return c.AllowN(ctx, 1)
+}
+
+func (c *countLimiter) AllowN(ctx context.Context, n int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if n > c.limit {
+		return false, errorx.ErrExceedCapacity
+	}
+	if c.count+n > c.limit {
+		return false, errorx.ErrOverMaxLimit
+	}
+
+	c.count += n
+	return true, nil
+}
+
+func (c *countLimiter) Close() {}
+
+// disCountLimiter the DisLimiter ignoring the keys.
+type disCountLimiter struct {
+	countLimiter
+}
+
+func (d *disCountLimiter) Allow(ctx context.Context, _ ...string) (bool, error) {
+	return d.countLimiter.Allow(ctx)
+}
+
+func (d *disCountLimiter) AllowN(ctx context.Context, n int, _ ...string) (bool, error) {
+	return d.countLimiter.AllowN(ctx, n)
+}
+
+func TestShadow_Allow(t *testing.T) {
+	stats := NewShadowStats()
+	l := NewShadow("count", &countLimiter{limit: 2}, stats)
+	defer l.Close()
+
+	for i := 0; i < 5; i++ {
+		ok, err := l.Allow(context.Background())
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, ShadowStat{Total: 5, WouldReject: 3}, stats.Get("count"))
+
+	// the cost over capacity is shadowed too.
+	ok, err := l.AllowN(context.Background(), 3)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, ShadowStat{Total: 6, WouldReject: 4}, stats.Get("count"))
+
+	// the errors other than over limit are not shadowed.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ok, err = NewShadow("canceled", &countLimiter{limit: 2}, stats).Allow(ctx)
+	assert.False(t, ok)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, map[string]ShadowStat{"count": {Total: 6, WouldReject: 4}}, stats.Snapshot())
+}
+
+func TestDisShadow_Allow(t *testing.T) {
+	stats := NewShadowStats()
+	l := NewDisShadow("count", &disCountLimiter{countLimiter{limit: 1}}, stats)
+	defer l.Close()
+
+	for i := 0; i < 3; i++ {
+		ok, err := l.Allow(context.Background(), "user")
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, ShadowStat{Total: 3, WouldReject: 2}, stats.Get("count"))
+}
@@ -0,0 +1,256 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+)
+
+// the memory limit of cgroup v1 over it is regarded as unlimited.
+const unlimitedMemory = 1 << 62
+
+// Cgroup the cgroup of the process mounted at root, the version is
+// detected by the cgroup.controllers file only exists in cgroup v2.
+type Cgroup struct {
+	root string
+	v2   bool
+}
+
+// NewCgroup return the cgroup mounted at root.
+func NewCgroup(root string) *Cgroup {
+	_, err := os.Stat(filepath.Join(root, "cgroup.controllers"))
+	return &Cgroup{root: root, v2: err == nil}
+}
+
+// DefaultCgroup return the cgroup mounted at /sys/fs/cgroup.
+func DefaultCgroup() *Cgroup {
+	return NewCgroup("/sys/fs/cgroup")
+}
+
+// Version return the version of cgroup, 1 or 2.
+func (c *Cgroup) Version() int {
+	if c.v2 {
+		return 2
+	}
+
+	return 1
+}
+
+func (c *Cgroup) read(elem ...string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(append([]string{c.root}, elem...)...))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (c *Cgroup) readUint(elem ...string) (uint64, error) {
+	s, err := c.read(elem...)
+	if err != nil {
+		return 0, err
+	}
+
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", filepath.Join(elem...), err)
+	}
+
+	return v, nil
+}
+
+// readStat read the value of key in the flat keyed file, such as
+// memory.stat and cpu.stat.
+func (c *Cgroup) readStat(key string, elem ...string) (uint64, error) {
+	f, err := os.Open(filepath.Join(append([]string{c.root}, elem...)...))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("no %s in %s", key, filepath.Join(elem...))
+}
+
+// CgroupMemory the memory of cgroup in bytes.
+type CgroupMemory struct {
+	// the working set, the memory used excluding the inactive file cache.
+	Used uint64
+	// the memory limit, zero means unlimited.
+	Limit uint64
+}
+
+// Usage return the ratio of memory used to the limit, zero if unlimited.
+func (m CgroupMemory) Usage() float64 {
+	if m.Limit == 0 {
+		return 0
+	}
+
+	return min(1, float64(m.Used)/float64(m.Limit))
+}
+
+// Memory read the memory used and the limit of cgroup.
+func (c *Cgroup) Memory() (CgroupMemory, error) {
+	current, limit, stat, inactive := []string{"memory.current"}, []string{"memory.max"},
+		[]string{"memory.stat"}, "inactive_file"
+	if !c.v2 {
+		current, limit, stat, inactive = []string{"memory", "memory.usage_in_bytes"},
+			[]string{"memory", "memory.limit_in_bytes"}, []string{"memory", "memory.stat"}, "total_inactive_file"
+	}
+
+	used, err := c.readUint(current...)
+	if err != nil {
+		return CgroupMemory{}, err
+	}
+	// the inactive file cache can be reclaimed, it is optional.
+	if n, err := c.readStat(inactive, stat...); err == nil {
+		used -= min(used, n)
+	}
+
+	var m CgroupMemory
+	m.Used = used
+	s, err := c.read(limit...)
+	if err != nil {
+		return CgroupMemory{}, err
+	}
+	if s != "max" {
+		if m.Limit, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return CgroupMemory{}, fmt.Errorf("parse %s: %w", filepath.Join(limit...), err)
+		}
+		if m.Limit >= unlimitedMemory {
+			m.Limit = 0
+		}
+	}
+
+	return m, nil
+}
+
+// CPUTime read the cumulative cpu time used by cgroup.
+func (c *Cgroup) CPUTime() (time.Duration, error) {
+	if c.v2 {
+		usec, err := c.readStat("usage_usec", "cpu.stat")
+		return time.Duration(usec) * time.Microsecond, err
+	}
+
+	ns, err := c.readUint("cpuacct", "cpuacct.usage")
+	return time.Duration(ns), err
+}
+
+// CPULimit read the cpu cores the cgroup can use by the quota, zero means
+// unlimited.
+func (c *Cgroup) CPULimit() (float64, error) {
+	var quota, period string
+	if c.v2 {
+		// $MAX $PERIOD
+		s, err := c.read("cpu.max")
+		if err != nil {
+			return 0, err
+		}
+		fields := strings.Fields(s)
+		if len(fields) != 2 {
+			return 0, fmt.Errorf("malformed cpu.max %q", s)
+		}
+		quota, period = fields[0], fields[1]
+	} else {
+		var err error
+		if quota, err = c.read("cpu", "cpu.cfs_quota_us"); err != nil {
+			return 0, err
+		}
+		if period, err = c.read("cpu", "cpu.cfs_period_us"); err != nil {
+			return 0, err
+		}
+	}
+
+	if quota == "max" || quota == "-1" {
+		return 0, nil
+	}
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse cpu quota: %w", err)
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, fmt.Errorf("parse cpu period %q", period)
+	}
+
+	return q / p, nil
+}
+
+// CgroupCPUUsage sample the cpu usage of cgroup since the last sample, the
+// usage is the ratio of the cpu time used to the cores can be used, which
+// is the quota or all the cpus if unlimited.
+type CgroupCPUUsage struct {
+	cg       *Cgroup
+	clock    clock.Clock
+	last     time.Duration
+	lastTime time.Time
+	mu       *sync.Mutex
+}
+
+// NewCgroupCPUUsage return the cpu usage of cgroup, the elapsed time is
+// measured by c.
+func NewCgroupCPUUsage(cg *Cgroup, c clock.Clock) *CgroupCPUUsage {
+	return &CgroupCPUUsage{cg: cg, clock: c, mu: new(sync.Mutex)}
+}
+
+// Sample return the cpu usage since the last sample, the first sample
+// returns zero.
+func (u *CgroupCPUUsage) Sample() (float64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	used, err := u.cg.CPUTime()
+	if err != nil {
+		return 0, err
+	}
+	cores, err := u.cg.CPULimit()
+	if err != nil {
+		return 0, err
+	}
+	if cores == 0 {
+		cores = float64(runtime.NumCPU())
+	}
+
+	now := u.clock.Now()
+	first := u.lastTime.IsZero()
+	elapsed := now.Sub(u.lastTime)
+	delta := used - u.last
+	u.last, u.lastTime = used, now
+	if first || elapsed <= 0 {
+		return 0, nil
+	}
+
+	return min(1, max(0, float64(delta)/(float64(elapsed)*cores))), nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FS the proc file system mounted at root, the tests can use a fixture
+// tree instead of /proc.
+type FS struct {
+	root string
+}
+
+// NewFS return the proc file system mounted at root.
+func NewFS(root string) FS {
+	return FS{root: root}
+}
+
+// DefaultFS return the proc file system mounted at /proc.
+func DefaultFS() FS {
+	return NewFS("/proc")
+}
+
+func (fs FS) path(elem ...string) string {
+	return filepath.Join(append([]string{fs.root}, elem...)...)
+}
+
+// CPUTimes the cumulative time of all the cpus in clock ticks.
+type CPUTimes struct {
+	// the time of all the states.
+	Total uint64
+	// the time of idle and iowait.
+	Idle uint64
+}
+
+// SystemCPU read the cumulative time of all the cpus from /proc/stat.
+func (fs FS) SystemCPU() (CPUTimes, error) {
+	f, err := os.Open(fs.path("stat"))
+	if err != nil {
+		return CPUTimes{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		var t CPUTimes
+		// user nice system idle iowait irq softirq steal, the guest time
+		// is included in user already.
+		for i, field := range fields[1:min(len(fields), 9)] {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return CPUTimes{}, fmt.Errorf("parse %s: %w", fs.path("stat"), err)
+			}
+			t.Total += v
+			if i == 3 || i == 4 {
+				t.Idle += v
+			}
+		}
+
+		return t, nil
+	}
+	if err = scanner.Err(); err != nil {
+		return CPUTimes{}, err
+	}
+
+	return CPUTimes{}, fmt.Errorf("no cpu line in %s", fs.path("stat"))
+}
+
+// ProcessCPU read the user and system time of process pid in clock ticks
+// from /proc/<pid>/stat, pid can be "self".
+func (fs FS) ProcessCPU(pid string) (uint64, error) {
+	data, err := os.ReadFile(fs.path(pid, "stat"))
+	if err != nil {
+		return 0, err
+	}
+
+	// the command may contain spaces, the fields start after ")".
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("malformed %s", fs.path(pid, "stat"))
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	// the utime and stime are the 14th and 15th fields, the fields
+	// counted from the state, the 3rd one.
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("malformed %s", fs.path(pid, "stat"))
+	}
+
+	var ticks uint64
+	for _, field := range fields[11:13] {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse %s: %w", fs.path(pid, "stat"), err)
+		}
+		ticks += v
+	}
+
+	return ticks, nil
+}
+
+// CPUUsage sample the cpu usage since the last sample, the usage is the
+// ratio of all the cpus of the machine in [0, 1].
+type CPUUsage struct {
+	fs FS
+	// the process sampled, empty means the whole system.
+	pid      string
+	last     CPUTimes
+	lastProc uint64
+	mu       *sync.Mutex
+}
+
+// NewSystemCPUUsage return the usage of the whole system.
+func NewSystemCPUUsage(fs FS) *CPUUsage {
+	return &CPUUsage{fs: fs, mu: new(sync.Mutex)}
+}
+
+// NewProcessCPUUsage return the usage of process pid, "self" means the
+// current process.
+func NewProcessCPUUsage(fs FS, pid string) *CPUUsage {
+	return &CPUUsage{fs: fs, pid: pid, mu: new(sync.Mutex)}
+}
+
+// Sample return the cpu usage since the last sample, the first sample
+// returns the usage since boot.
+func (c *CPUUsage) Sample() (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, err := c.fs.SystemCPU()
+	if err != nil {
+		return 0, err
+	}
+
+	var proc uint64
+	if c.pid != "" {
+		if proc, err = c.fs.ProcessCPU(c.pid); err != nil {
+			return 0, err
+		}
+	}
+
+	total := t.Total - c.last.Total
+	if total == 0 {
+		return 0, nil
+	}
+
+	var usage float64
+	if c.pid != "" {
+		usage = float64(proc-c.lastProc) / float64(total)
+	} else {
+		usage = 1 - float64(t.Idle-c.last.Idle)/float64(total)
+	}
+	c.last, c.lastProc = t, proc
+
+	return min(1, max(0, usage)), nil
+}
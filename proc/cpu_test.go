@@ -0,0 +1,77 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFS_SystemCPU(t *testing.T) {
+	times, err := NewFS("testdata/proc").SystemCPU()
+	assert.NoError(t, err)
+	assert.Equal(t, CPUTimes{Total: 9384, Idle: 3722}, times)
+
+	_, err = NewFS("testdata/none").SystemCPU()
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFS_ProcessCPU(t *testing.T) {
+	ticks, err := NewFS("testdata/proc").ProcessCPU("self")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1000), ticks)
+}
+
+// writeStat write the cpu line of /proc/stat and /proc/self/stat with the
+// times given.
+func writeStat(t *testing.T, root string, user, idle, proc int) {
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "self"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "stat"),
+		[]byte(fmt.Sprintf("cpu  %d 0 0 %d 0 0 0 0 0 0\n", user, idle)), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "self", "stat"),
+		[]byte(fmt.Sprintf("1 (app) S 1 1 1 0 -1 0 0 0 0 0 %d 0 0 0 20 0 1 0 0 0 0\n", proc)), 0o644))
+}
+
+func TestCPUUsage_Sample(t *testing.T) {
+	root := t.TempDir()
+	fs := NewFS(root)
+	system, process := NewSystemCPUUsage(fs), NewProcessCPUUsage(fs, "self")
+
+	writeStat(t, root, 100, 100, 50)
+	usage, err := system.Sample()
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.5, usage, 1e-9)
+	usage, err = process.Sample()
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.25, usage, 1e-9)
+
+	// the usage since the last sample.
+	writeStat(t, root, 400, 200, 250)
+	usage, err = system.Sample()
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.75, usage, 1e-9)
+	usage, err = process.Sample()
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.5, usage, 1e-9)
+
+	// no time elapsed.
+	usage, err = system.Sample()
+	assert.NoError(t, err)
+	assert.Zero(t, usage)
+}
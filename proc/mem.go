@@ -0,0 +1,90 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MemInfo the memory of the system in bytes.
+type MemInfo struct {
+	Total     uint64
+	Available uint64
+}
+
+// Used return the memory used.
+func (m MemInfo) Used() uint64 {
+	return m.Total - min(m.Total, m.Available)
+}
+
+// Usage return the ratio of memory used in [0, 1].
+func (m MemInfo) Usage() float64 {
+	if m.Total == 0 {
+		return 0
+	}
+
+	return float64(m.Used()) / float64(m.Total)
+}
+
+// Memory read the memory of the system from /proc/meminfo, the available
+// memory is estimated by MemFree, Buffers and Cached on the old kernels
+// without MemAvailable.
+func (fs FS) Memory() (MemInfo, error) {
+	f, err := os.Open(fs.path("meminfo"))
+	if err != nil {
+		return MemInfo{}, err
+	}
+	defer f.Close()
+
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemTotal:       16337800 kB
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return MemInfo{}, fmt.Errorf("parse %s: %w", fs.path("meminfo"), err)
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			v *= 1024
+		}
+		values[key] = v
+	}
+	if err = scanner.Err(); err != nil {
+		return MemInfo{}, err
+	}
+
+	total, ok := values["MemTotal"]
+	if !ok {
+		return MemInfo{}, fmt.Errorf("no MemTotal in %s", fs.path("meminfo"))
+	}
+	available, ok := values["MemAvailable"]
+	if !ok {
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+
+	return MemInfo{Total: total, Available: available}, nil
+}
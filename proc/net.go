@@ -0,0 +1,71 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// the state of the established tcp connection in /proc/net/tcp.
+const tcpEstablished = "01"
+
+// Connections count the established tcp connections of ipv4 and ipv6 from
+// /proc/net/tcp and /proc/net/tcp6, the files not exist are skipped, such
+// as tcp6 while ipv6 is disabled.
+func (fs FS) Connections() (uint64, error) {
+	var total uint64
+	var found bool
+	for _, name := range []string{"tcp", "tcp6"} {
+		n, err := fs.countTCP(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += n
+		found = true
+	}
+
+	if !found {
+		return 0, &os.PathError{Op: "open", Path: fs.path("net", "tcp"), Err: os.ErrNotExist}
+	}
+
+	return total, nil
+}
+
+func (fs FS) countTCP(name string) (uint64, error) {
+	f, err := os.Open(fs.path("net", name))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var n uint64
+	scanner := bufio.NewScanner(f)
+	// skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		// sl local_address rem_address st ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 3 && fields[3] == tcpEstablished {
+			n++
+		}
+	}
+
+	return n, scanner.Err()
+}
@@ -0,0 +1,117 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TimeWtr/gox/clock"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFS_Memory(t *testing.T) {
+	m, err := NewFS("testdata/proc").Memory()
+	assert.NoError(t, err)
+	assert.Equal(t, MemInfo{Total: 8000000 * 1024, Available: 2000000 * 1024}, m)
+	assert.Equal(t, uint64(6000000*1024), m.Used())
+	assert.InDelta(t, 0.75, m.Usage(), 1e-9)
+
+	// the available memory is estimated on the old kernels.
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "meminfo"),
+		[]byte("MemTotal: 1000 kB\nMemFree: 100 kB\nBuffers: 50 kB\nCached: 100 kB\n"), 0o644))
+	m, err = NewFS(root).Memory()
+	assert.NoError(t, err)
+	assert.Equal(t, MemInfo{Total: 1000 * 1024, Available: 250 * 1024}, m)
+}
+
+func TestFS_Connections(t *testing.T) {
+	n, err := NewFS("testdata/proc").Connections()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), n)
+
+	_, err = NewFS(t.TempDir()).Connections()
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCgroup(t *testing.T) {
+	testCases := []struct {
+		root        string
+		wantVersion int
+		wantMem     CgroupMemory
+		wantCPU     time.Duration
+		wantLimit   float64
+	}{
+		{
+			root:        "testdata/cgroup/v2",
+			wantVersion: 2,
+			wantMem:     CgroupMemory{Used: 500000000, Limit: 1 << 30},
+			wantCPU:     5 * time.Second,
+			wantLimit:   2,
+		},
+		{
+			root:        "testdata/cgroup/v1",
+			wantVersion: 1,
+			wantMem:     CgroupMemory{Used: 200000000},
+			wantCPU:     3 * time.Second,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.root, func(t *testing.T) {
+			cg := NewCgroup(tc.root)
+			assert.Equal(t, tc.wantVersion, cg.Version())
+
+			m, err := cg.Memory()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantMem, m)
+
+			used, err := cg.CPUTime()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantCPU, used)
+
+			limit, err := cg.CPULimit()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantLimit, limit)
+		})
+	}
+}
+
+func TestCgroupCPUUsage_Sample(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "cgroup.controllers"), nil, 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "cpu.max"), []byte("200000 100000\n"), 0o644))
+	writeUsage := func(usec string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(root, "cpu.stat"), []byte("usage_usec "+usec+"\n"), 0o644))
+	}
+
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	u := NewCgroupCPUUsage(NewCgroup(root), c)
+	writeUsage("1000000")
+	usage, err := u.Sample()
+	assert.NoError(t, err)
+	assert.Zero(t, usage)
+
+	// 1s of cpu in 1s of the 2 cores quota.
+	c.Advance(time.Second)
+	writeUsage("2000000")
+	usage, err = u.Sample()
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.5, usage, 1e-9)
+}